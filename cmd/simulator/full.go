@@ -214,7 +214,7 @@ func runFullSimulation(logger *log.Logger, config *SimulatorConfig) error {
 func makePlugin(address common.Address, controller *OCRController, logger *log.Logger, rpcClient *rpc.Client, i int8, n int) types.ReportingPlugin {
 	client := chain.NewEVMClient(rpcClient, 10)
 
-	reg, err := chain.NewEVMRegistryV2_0(address, client)
+	reg, encoder, err := chain.NewEVMRegistry(address, client, logger)
 	if err != nil {
 		panic(err)
 	}
@@ -236,7 +236,7 @@ func makePlugin(address common.Address, controller *OCRController, logger *log.L
 		ServiceQueueLength:    1000,
 	}
 
-	factory := keepers.NewReportingPluginFactory(client, reg, pLogs, chain.NewEVMReportEncoder(), logger, config)
+	factory := keepers.NewReportingPluginFactory(client, reg, pLogs, encoder, logger, config)
 	plugin, info, err := factory.NewReportingPlugin(types.ReportingPluginConfig{
 		ConfigDigest:   [32]byte{},
 		OracleID:       commontypes.OracleID(i),
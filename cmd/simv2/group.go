@@ -252,6 +252,8 @@ func (g *NodeGroup) ReportResults() {
 	var avgPerformDelay float64 = -1
 	var avgCheckDelay float64 = -1
 	idCheckData := []int{}
+	neverChecked := 0
+	checkGaps := []int{}
 
 	for _, id := range ub.UpkeepIDs() {
 		stats := ub.UpkeepStats(id)
@@ -280,8 +282,10 @@ func (g *NodeGroup) ReportResults() {
 		if checked {
 			totalIDChecks += len(checks)
 			idCheckData = append(idCheckData, len(checks))
+			checkGaps = append(checkGaps, findBlockGaps(checks)...)
 		} else {
 			idCheckData = append(idCheckData, 0)
+			neverChecked++
 		}
 
 		if stats.Missed != 0 {
@@ -353,6 +357,24 @@ func (g *NodeGroup) ReportResults() {
 
 	g.logger.Printf(" ---- end ---")
 
+	// compare coverage of samplers by the blocks between checks of each id
+	g.logger.Printf(" ---- Statistics / Blocks between Checks per ID ---")
+	g.logger.Printf("ids never checked: %d", neverChecked)
+	if len(checkGaps) > 0 {
+		sort.Ints(checkGaps)
+
+		var totalGaps int
+		for _, gap := range checkGaps {
+			totalGaps += gap
+		}
+
+		g.logger.Printf("average: %0.2f", float64(totalGaps)/float64(len(checkGaps)))
+		g.logger.Printf("highest value: %d", checkGaps[len(checkGaps)-1])
+	} else {
+		g.logger.Printf("no ids were checked more than once")
+	}
+	g.logger.Printf(" ---- end ---")
+
 	g.logger.Printf(" ---- Statistics / Transmits per Node (account) ---")
 	accStats := ub.Transmits()
 	for _, acc := range accStats {
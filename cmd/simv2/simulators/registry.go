@@ -4,11 +4,11 @@ import (
 	"context"
 	"fmt"
 	"math/big"
-	"strings"
 	"sync"
 
 	"go.uber.org/multierr"
 
+	"github.com/smartcontractkit/ocr2keepers/pkg/chain"
 	"github.com/smartcontractkit/ocr2keepers/pkg/types"
 )
 
@@ -21,15 +21,20 @@ type SimulatedUpkeep struct {
 func (ct *SimulatedContract) GetActiveUpkeepKeys(ctx context.Context, key types.BlockKey) ([]types.UpkeepKey, error) {
 
 	ct.mu.RLock()
-	ct.logger.Printf("getting keys at block %s", ct.lastBlock)
 
+	// the head that triggered sampling is used if provided; otherwise the
+	// latest block is used
 	block := ct.lastBlock.String()
+	if len(key) > 0 && string(key) != "0" {
+		block = string(key)
+	}
+
+	ct.logger.Printf("getting keys at block %s", block)
 	keys := []types.UpkeepKey{}
 
 	// TODO: filter out cancelled upkeeps
 	for key := range ct.upkeeps {
-		k := types.UpkeepKey([]byte(fmt.Sprintf("%s|%s", block, key)))
-		keys = append(keys, k)
+		keys = append(keys, ct.MakeKey(types.BlockKey(block), types.UpkeepIdentifier(key)))
 	}
 	ct.mu.RUnlock()
 
@@ -64,18 +69,19 @@ func (ct *SimulatedContract) CheckUpkeep(ctx context.Context, keys ...types.Upke
 		go func(i int, key types.UpkeepKey) {
 			defer wg.Done()
 
-			parts := strings.Split(string(key), "|")
-			if len(parts) != 2 {
-				panic("upkeep key does not contain block and id")
+			blockKey, id, err := chain.BlockAndIdFromKey(key)
+			if err != nil {
+				mErr = multierr.Append(mErr, err)
+				return
 			}
 
-			block, ok := new(big.Int).SetString(parts[0], 10)
+			block, ok := new(big.Int).SetString(string(blockKey), 10)
 			if !ok {
 				mErr = multierr.Append(mErr, fmt.Errorf("block in key not parsable as big int"))
 				return
 			}
 
-			up, ok := ct.upkeeps[parts[1]]
+			up, ok := ct.upkeeps[id.String()]
 			if !ok {
 				mErr = multierr.Append(mErr, fmt.Errorf("upkeep not registered"))
 				return
@@ -149,11 +155,31 @@ func (ct *SimulatedContract) CheckUpkeep(ctx context.Context, keys ...types.Upke
 	return results, nil
 }
 
+// The simulated contract uses the key layout and block order of the EVM
+// registry because reports are encoded with the EVM report encoder.
+// Identifiers are decimal upkeep ids.
+
+func (ct *SimulatedContract) BlockFromKey(key types.UpkeepKey) (types.BlockKey, error) {
+	block, _, err := chain.BlockAndIdFromKey(key)
+	return block, err
+}
+
 func (ct *SimulatedContract) IdentifierFromKey(key types.UpkeepKey) (types.UpkeepIdentifier, error) {
-	parts := strings.Split(string(key), "|")
-	if len(parts) != 2 {
-		panic("upkeep key does not contain block and id")
+	_, id, err := chain.BlockAndIdFromKey(key)
+	if err != nil {
+		return nil, err
 	}
 
-	return types.UpkeepIdentifier(parts[1]), nil
+	return types.UpkeepIdentifier(id.String()), nil
+}
+
+func (ct *SimulatedContract) CompareBlocks(a, b types.BlockKey) (int, error) {
+	return chain.CompareBlockKeys(a, b)
+}
+
+func (ct *SimulatedContract) MakeKey(block types.BlockKey, id types.UpkeepIdentifier) types.UpkeepKey {
+	b, _ := new(big.Int).SetString(string(block), 10)
+	i, _ := new(big.Int).SetString(string(id), 10)
+
+	return chain.BlockAndIdToKey(b, i)
 }
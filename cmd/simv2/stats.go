@@ -4,10 +4,10 @@ import (
 	"fmt"
 	"math/big"
 	"sort"
-	"strings"
 
 	"github.com/smartcontractkit/ocr2keepers/cmd/simv2/blocks"
 	"github.com/smartcontractkit/ocr2keepers/cmd/simv2/simulators"
+	"github.com/smartcontractkit/ocr2keepers/pkg/chain"
 	"github.com/smartcontractkit/ocr2keepers/pkg/types"
 )
 
@@ -54,9 +54,14 @@ func newUpkeepStatsBuilder(
 
 		// tr.SendingAddress
 		for _, trResult := range reported {
-			parts := strings.Split(string(trResult.Key), "|")
-			performsByID[parts[1]] = append(performsByID[parts[1]], block.String())
-			trsByID[parts[1]] = append(trsByID[parts[1]], tr)
+			_, upkeepID, err := chain.BlockAndIdFromKey(trResult.Key)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing reported key: %s", err)
+			}
+
+			id := upkeepID.String()
+			performsByID[id] = append(performsByID[id], block.String())
+			trsByID[id] = append(trsByID[id], tr)
 		}
 	}
 
@@ -261,3 +266,25 @@ type transmitStats struct {
 	Count   int
 	Pct     float64
 }
+
+// findBlockGaps returns the number of blocks between consecutive blocks.
+// blocks that are not parsable are ignored.
+func findBlockGaps(blocks []string) []int {
+	numbers := make([]*big.Int, 0, len(blocks))
+	for _, block := range blocks {
+		if n, ok := new(big.Int).SetString(block, 10); ok {
+			numbers = append(numbers, n)
+		}
+	}
+
+	sort.Slice(numbers, func(i, j int) bool {
+		return numbers[i].Cmp(numbers[j]) < 0
+	})
+
+	gaps := make([]int, 0, len(numbers))
+	for i := 1; i < len(numbers); i++ {
+		gaps = append(gaps, int(new(big.Int).Sub(numbers[i], numbers[i-1]).Int64()))
+	}
+
+	return gaps
+}
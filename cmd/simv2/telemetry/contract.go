@@ -2,8 +2,9 @@ package telemetry
 
 import (
 	"io"
-	"strings"
 	"sync"
+
+	"github.com/smartcontractkit/ocr2keepers/pkg/chain"
 )
 
 type ContractEventCollector struct {
@@ -97,7 +98,6 @@ func (wc *WrappedContractCollector) CheckKey(key []byte) {
 	defer wc.mu.Unlock()
 
 	k := string(key)
-	parts := strings.Split(k, "|")
 
 	_, ok := wc.keyChecks[k]
 	if !ok {
@@ -105,19 +105,26 @@ func (wc *WrappedContractCollector) CheckKey(key []byte) {
 	}
 	wc.keyChecks[k]++
 
-	val, ok := wc.keyIDLookup[parts[1]]
+	blockKey, upkeepID, err := chain.BlockAndIdFromKey(key)
+	if err != nil {
+		return
+	}
+
+	block, id := string(blockKey), upkeepID.String()
+
+	val, ok := wc.keyIDLookup[id]
 	if !ok {
-		wc.keyIDLookup[parts[1]] = []string{parts[0]}
+		wc.keyIDLookup[id] = []string{block}
 	} else {
 		var found bool
 		for _, v := range val {
-			if v == parts[0] {
+			if v == block {
 				found = true
 			}
 		}
 
 		if !found {
-			wc.keyIDLookup[parts[1]] = append(val, parts[0])
+			wc.keyIDLookup[id] = append(val, block)
 		}
 	}
 }
@@ -2,7 +2,14 @@ package keepers
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/sha3"
+
+	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
 )
 
 // encode is a convenience method that uses json encoding to
@@ -28,3 +35,523 @@ func decode[T any](b []byte, value *T) error {
 	dec := json.NewDecoder(bts)
 	return dec.Decode(value)
 }
+
+const (
+	// queryVersion1 is a query containing a single leader proposed block key
+	queryVersion1 byte = 1
+	// maxBlockKeyLength is the max length of a block key that can be proposed
+	// in a query. a uint256 block number is at most 78 decimal digits.
+	maxBlockKeyLength = 127
+	// maxQueryLength is the version byte plus the longest allowed block key
+	maxQueryLength = 1 + maxBlockKeyLength
+)
+
+var (
+	ErrInvalidQuery = fmt.Errorf("invalid query")
+)
+
+// ocrQuery is the content of an OCR query as proposed by the round leader. An
+// empty block indicates that the leader had no block to propose and followers
+// should observe on their own latest sampled block.
+type ocrQuery struct {
+	Block ktypes.BlockKey
+}
+
+// encodeQuery produces a version byte followed by the raw block key. A query
+// with no block is encoded as an empty byte array to remain compatible with
+// nodes that produce empty queries.
+func encodeQuery(q ocrQuery) ([]byte, error) {
+	if len(q.Block) == 0 {
+		return []byte{}, nil
+	}
+
+	if len(q.Block) > maxBlockKeyLength {
+		return nil, fmt.Errorf("%w: block key length %d exceeds max of %d", ErrInvalidQuery, len(q.Block), maxBlockKeyLength)
+	}
+
+	b := make([]byte, 0, 1+len(q.Block))
+	b = append(b, queryVersion1)
+	b = append(b, []byte(q.Block)...)
+
+	return b, nil
+}
+
+// decodeQuery reverses encodeQuery. Empty queries decode to an empty block.
+func decodeQuery(b []byte) (ocrQuery, error) {
+	if len(b) == 0 {
+		return ocrQuery{}, nil
+	}
+
+	if len(b) > maxQueryLength {
+		return ocrQuery{}, fmt.Errorf("%w: length %d exceeds max of %d", ErrInvalidQuery, len(b), maxQueryLength)
+	}
+
+	switch b[0] {
+	case queryVersion1:
+		if len(b) == 1 {
+			return ocrQuery{}, fmt.Errorf("%w: missing block key", ErrInvalidQuery)
+		}
+
+		return ocrQuery{Block: ktypes.BlockKey(b[1:])}, nil
+	default:
+		return ocrQuery{}, fmt.Errorf("%w: unknown version %d", ErrInvalidQuery, b[0])
+	}
+}
+
+const (
+	// observationVersion1 is a binary observation where upkeep keys are
+	// grouped by block and upkeep ids are encoded as varints
+	observationVersion1 byte = 1
+	// observationVersion2 is a version 1 observation where each key is
+	// followed by a digest of the check result
+	observationVersion2 byte = 2
+	// maxVarintLength limits the number of bytes read for a single upkeep id.
+	// a uint256 requires 37 bytes.
+	maxVarintLength = 64
+	// resultDigestLength is the length of a check result digest
+	resultDigestLength = 32
+)
+
+var (
+	ErrInvalidObservation = fmt.Errorf("invalid observation")
+)
+
+// observedKey is an upkeep key decoded from an observation. The digest is only
+// set for observations that carry check result digests.
+type observedKey struct {
+	Key    ktypes.UpkeepKey
+	Digest *[resultDigestLength]byte
+}
+
+// observationBuilder collects upkeep keys for a binary observation and tracks
+// the exact length of the encoded result. The encoded format is:
+//
+//	version byte
+//	uvarint number of block groups
+//	  uvarint block length, block bytes
+//	  uvarint number of upkeep ids
+//	    varint upkeep id, [digest]
+//	uvarint number of raw keys
+//	  uvarint key length, key bytes, [digest]
+//
+// Keys are split into a block and upkeep id by the key codec of the registry
+// and rebuilt by the codec when decoded. Keys that the codec cannot split or
+// cannot rebuild exactly are encoded as raw keys. Digests are only included in
+// version 2 observations.
+type observationBuilder struct {
+	version byte
+	codec   ktypes.KeyCodec
+	groups  []*observationGroup
+	byBlock map[string]*observationGroup
+	raw     []observedKey
+	length  int
+}
+
+type observationGroup struct {
+	block   string
+	ids     []*big.Int
+	digests [][resultDigestLength]byte
+}
+
+func newObservationBuilder(codec ktypes.KeyCodec) *observationBuilder {
+	return &observationBuilder{
+		version: observationVersion1,
+		codec:   codec,
+		byBlock: make(map[string]*observationGroup),
+		// version byte, zero groups, zero raw keys
+		length: 3,
+	}
+}
+
+// newResultObservationBuilder provides a builder for observations where each
+// key is followed by a digest of the check result
+func newResultObservationBuilder(codec ktypes.KeyCodec) *observationBuilder {
+	ob := newObservationBuilder(codec)
+	ob.version = observationVersion2
+
+	return ob
+}
+
+// Len returns the exact length of the encoded observation
+func (ob *observationBuilder) Len() int {
+	return ob.length
+}
+
+// LenWith returns the exact length of the encoded observation if the provided
+// key were added
+func (ob *observationBuilder) LenWith(key ktypes.UpkeepKey) int {
+	return ob.length + ob.delta(key)
+}
+
+// Add adds a key to the observation. Adding a key without a digest to a
+// version 2 observation results in a zero digest.
+func (ob *observationBuilder) Add(key ktypes.UpkeepKey) {
+	ob.AddWithDigest(key, [resultDigestLength]byte{})
+}
+
+// AddWithDigest adds a key and result digest to the observation. The digest
+// is dropped for version 1 observations.
+func (ob *observationBuilder) AddWithDigest(key ktypes.UpkeepKey, digest [resultDigestLength]byte) {
+	ob.length += ob.delta(key)
+
+	block, id, ok := splitKey(key, ob.codec)
+	if !ok {
+		ob.raw = append(ob.raw, observedKey{Key: key, Digest: &digest})
+		return
+	}
+
+	group, exists := ob.byBlock[block]
+	if !exists {
+		group = &observationGroup{block: block}
+		ob.byBlock[block] = group
+		ob.groups = append(ob.groups, group)
+	}
+
+	group.ids = append(group.ids, id)
+	group.digests = append(group.digests, digest)
+}
+
+func (ob *observationBuilder) delta(key ktypes.UpkeepKey) int {
+	var digestLen int
+	if ob.version == observationVersion2 {
+		digestLen = resultDigestLength
+	}
+
+	block, id, ok := splitKey(key, ob.codec)
+	if !ok {
+		return uvarintLen(len(ob.raw)+1) - uvarintLen(len(ob.raw)) + uvarintLen(len(key)) + len(key) + digestLen
+	}
+
+	idLen := bigUvarintLen(id) + digestLen
+	if group, exists := ob.byBlock[block]; exists {
+		return uvarintLen(len(group.ids)+1) - uvarintLen(len(group.ids)) + idLen
+	}
+
+	return uvarintLen(len(ob.groups)+1) - uvarintLen(len(ob.groups)) +
+		uvarintLen(len(block)) + len(block) + uvarintLen(1) + idLen
+}
+
+// Encode produces the encoded observation
+func (ob *observationBuilder) Encode() []byte {
+	b := make([]byte, 0, ob.length)
+	b = append(b, ob.version)
+
+	b = binary.AppendUvarint(b, uint64(len(ob.groups)))
+	for _, group := range ob.groups {
+		b = binary.AppendUvarint(b, uint64(len(group.block)))
+		b = append(b, []byte(group.block)...)
+		b = binary.AppendUvarint(b, uint64(len(group.ids)))
+
+		for i, id := range group.ids {
+			b = appendBigUvarint(b, id)
+
+			if ob.version == observationVersion2 {
+				b = append(b, group.digests[i][:]...)
+			}
+		}
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(ob.raw)))
+	for _, raw := range ob.raw {
+		b = binary.AppendUvarint(b, uint64(len(raw.Key)))
+		b = append(b, raw.Key...)
+
+		if ob.version == observationVersion2 {
+			b = append(b, raw.Digest[:]...)
+		}
+	}
+
+	return b
+}
+
+// encodeObservation encodes upkeep keys into a version 1 observation
+func encodeObservation(keys []ktypes.UpkeepKey, codec ktypes.KeyCodec) []byte {
+	ob := newObservationBuilder(codec)
+	for _, key := range keys {
+		ob.Add(key)
+	}
+
+	return ob.Encode()
+}
+
+// decodeObservation decodes upkeep keys from any observation version
+func decodeObservation(b []byte, codec ktypes.KeyCodec) ([]ktypes.UpkeepKey, error) {
+	observed, err := decodeObservedKeys(b, codec)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]ktypes.UpkeepKey, len(observed))
+	for i, o := range observed {
+		keys[i] = o.Key
+	}
+
+	return keys, nil
+}
+
+// decodeObservedKeys decodes upkeep keys and result digests from a binary
+// observation or upkeep keys from a legacy json encoded observation. Keys of
+// a binary observation are built by the provided key codec.
+func decodeObservedKeys(b []byte, codec ktypes.KeyCodec) ([]observedKey, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%w: empty observation", ErrInvalidObservation)
+	}
+
+	switch b[0] {
+	case observationVersion1, observationVersion2:
+		return decodeBinaryObservation(b[1:], b[0] == observationVersion2, codec)
+	case '[', 'n', ' ', '\t', '\r', '\n':
+		// legacy observations are a json encoded array of keys
+		var keys []ktypes.UpkeepKey
+		if err := decode(b, &keys); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidObservation, err)
+		}
+
+		observed := make([]observedKey, len(keys))
+		for i, key := range keys {
+			observed[i] = observedKey{Key: key}
+		}
+
+		return observed, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown version %d", ErrInvalidObservation, b[0])
+	}
+}
+
+func decodeBinaryObservation(b []byte, withDigests bool, codec ktypes.KeyCodec) ([]observedKey, error) {
+	r := &byteReader{b: b}
+
+	readDigest := func() (*[resultDigestLength]byte, error) {
+		if !withDigests {
+			return nil, nil
+		}
+
+		raw, err := r.fixed(resultDigestLength)
+		if err != nil {
+			return nil, err
+		}
+
+		var digest [resultDigestLength]byte
+		copy(digest[:], raw)
+
+		return &digest, nil
+	}
+
+	groups, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+
+	observed := make([]observedKey, 0)
+	for i := 0; i < groups; i++ {
+		block, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+
+		ids, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+
+		for j := 0; j < ids; j++ {
+			id, err := r.bigUvarint()
+			if err != nil {
+				return nil, err
+			}
+
+			digest, err := readDigest()
+			if err != nil {
+				return nil, err
+			}
+
+			observed = append(observed, observedKey{
+				Key:    codec.MakeKey(ktypes.BlockKey(block), id.Bytes()),
+				Digest: digest,
+			})
+		}
+	}
+
+	raw, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < raw; i++ {
+		key, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+
+		digest, err := readDigest()
+		if err != nil {
+			return nil, err
+		}
+
+		observed = append(observed, observedKey{Key: ktypes.UpkeepKey(key), Digest: digest})
+	}
+
+	if len(r.b) > 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrInvalidObservation, len(r.b))
+	}
+
+	return observed, nil
+}
+
+// resultDigest produces a digest of the parts of a check result that are
+// expected to be identical for all nodes checking the same key: the perform
+// data hash, gas used, check block number, and check block hash.
+func resultDigest(result ktypes.UpkeepResult) [resultDigestLength]byte {
+	// variable length values are length prefixed
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(binary.AppendUvarint(nil, uint64(len(result.Key))))
+	hash.Write(result.Key)
+
+	performHash := sha3.NewLegacyKeccak256()
+	performHash.Write(result.PerformData)
+	hash.Write(performHash.Sum(nil))
+
+	var gasUsed []byte
+	if result.GasUsed != nil {
+		gasUsed = result.GasUsed.Bytes()
+	}
+	hash.Write(binary.AppendUvarint(nil, uint64(len(gasUsed))))
+	hash.Write(gasUsed)
+
+	var block [4]byte
+	binary.BigEndian.PutUint32(block[:], result.CheckBlockNumber)
+	hash.Write(block[:])
+	hash.Write(result.CheckBlockHash[:])
+
+	var digest [resultDigestLength]byte
+	copy(digest[:], hash.Sum(nil))
+
+	return digest
+}
+
+// splitKey splits a key into a block and an upkeep id read as a big endian
+// number with the key codec. Keys are only split if the codec reproduces the
+// key exactly from the split values and the id fits in a varint that can be
+// decoded.
+func splitKey(key ktypes.UpkeepKey, codec ktypes.KeyCodec) (string, *big.Int, bool) {
+	block, err := codec.BlockFromKey(key)
+	if err != nil {
+		return "", nil, false
+	}
+
+	identifier, err := codec.IdentifierFromKey(key)
+	if err != nil {
+		return "", nil, false
+	}
+
+	// leading zero bytes are not kept by the numeric id
+	id := new(big.Int).SetBytes(identifier)
+	if !bytes.Equal(id.Bytes(), identifier) || bigUvarintLen(id) > maxVarintLength {
+		return "", nil, false
+	}
+
+	if !bytes.Equal(codec.MakeKey(block, id.Bytes()), key) {
+		return "", nil, false
+	}
+
+	return string(block), id, true
+}
+
+func uvarintLen(v int) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], uint64(v))
+}
+
+func bigUvarintLen(v *big.Int) int {
+	if v.Sign() == 0 {
+		return 1
+	}
+
+	return (v.BitLen() + 6) / 7
+}
+
+// appendBigUvarint appends a base 128 varint of arbitrary size. The encoding
+// is identical to binary.AppendUvarint for values that fit in a uint64.
+func appendBigUvarint(b []byte, v *big.Int) []byte {
+	if v.IsUint64() {
+		return binary.AppendUvarint(b, v.Uint64())
+	}
+
+	x := new(big.Int).Set(v)
+	for {
+		lo := byte(x.Uint64() & 0x7f)
+		x.Rsh(x, 7)
+
+		if x.Sign() == 0 {
+			return append(b, lo)
+		}
+
+		b = append(b, lo|0x80)
+	}
+}
+
+type byteReader struct {
+	b []byte
+}
+
+func (r *byteReader) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		return 0, fmt.Errorf("%w: malformed varint", ErrInvalidObservation)
+	}
+
+	r.b = r.b[n:]
+	return v, nil
+}
+
+// count reads a uvarint that is bounded by the remaining bytes as every
+// counted item is at least one byte
+func (r *byteReader) count() (int, error) {
+	v, err := r.uvarint()
+	if err != nil {
+		return 0, err
+	}
+
+	if v > uint64(len(r.b)) {
+		return 0, fmt.Errorf("%w: count %d exceeds remaining length", ErrInvalidObservation, v)
+	}
+
+	return int(v), nil
+}
+
+func (r *byteReader) bytes() ([]byte, error) {
+	l, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+
+	v := r.b[:l]
+	r.b = r.b[l:]
+
+	return v, nil
+}
+
+func (r *byteReader) fixed(l int) ([]byte, error) {
+	if l > len(r.b) {
+		return nil, fmt.Errorf("%w: expected %d bytes", ErrInvalidObservation, l)
+	}
+
+	v := r.b[:l]
+	r.b = r.b[l:]
+
+	return v, nil
+}
+
+func (r *byteReader) bigUvarint() (*big.Int, error) {
+	v := new(big.Int)
+	for i := 0; i < len(r.b) && i < maxVarintLength; i++ {
+		v.Or(v, new(big.Int).Lsh(big.NewInt(int64(r.b[i]&0x7f)), uint(7*i)))
+
+		if r.b[i] < 0x80 {
+			r.b = r.b[i+1:]
+			return v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: malformed upkeep id varint", ErrInvalidObservation)
+}
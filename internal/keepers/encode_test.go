@@ -1,11 +1,183 @@
 package keepers
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
 	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
 )
 
+func TestEncodeObservation(t *testing.T) {
+	tests := []struct {
+		Name string
+		Keys []ktypes.UpkeepKey
+	}{
+		{Name: "Empty", Keys: []ktypes.UpkeepKey{}},
+		{Name: "Single Block", Keys: []ktypes.UpkeepKey{ktypes.UpkeepKey("1|1"), ktypes.UpkeepKey("1|2"), ktypes.UpkeepKey("1|300")}},
+		{Name: "Multiple Blocks", Keys: []ktypes.UpkeepKey{ktypes.UpkeepKey("1|1"), ktypes.UpkeepKey("2|1"), ktypes.UpkeepKey("1|2")}},
+		{Name: "Large Upkeep ID", Keys: []ktypes.UpkeepKey{ktypes.UpkeepKey("128943862|115792089237316195423570985008687907853269984665640564039457584007913129639935")}},
+		{Name: "Raw Keys", Keys: []ktypes.UpkeepKey{ktypes.UpkeepKey("1|01"), ktypes.UpkeepKey("1|abc"), ktypes.UpkeepKey("no separator"), ktypes.UpkeepKey("")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			ob := newObservationBuilder(testKeyCodec{})
+			for _, key := range test.Keys {
+				ob.Add(key)
+			}
+
+			b := ob.Encode()
+			assert.Equal(t, ob.Len(), len(b))
+			assert.Equal(t, observationVersion1, b[0])
+
+			keys, err := decodeObservation(b, testKeyCodec{})
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, test.Keys, keys)
+		})
+	}
+}
+
+func TestEncodeObservation_Digests(t *testing.T) {
+	results := ktypes.UpkeepResults{
+		{Key: ktypes.UpkeepKey("1|1"), State: ktypes.Eligible, PerformData: []byte("abcd"), CheckBlockNumber: 1},
+		{Key: ktypes.UpkeepKey("1|abc"), State: ktypes.Eligible, PerformData: []byte("efgh"), CheckBlockNumber: 1},
+	}
+
+	ob := newResultObservationBuilder(testKeyCodec{})
+	for _, result := range results {
+		ob.AddWithDigest(result.Key, resultDigest(result))
+	}
+
+	b := ob.Encode()
+	assert.Equal(t, ob.Len(), len(b))
+	assert.Equal(t, observationVersion2, b[0])
+
+	observed, err := decodeObservedKeys(b, testKeyCodec{})
+	assert.NoError(t, err)
+	assert.Len(t, observed, len(results))
+
+	for i, result := range results {
+		assert.Equal(t, result.Key, observed[i].Key)
+		if assert.NotNil(t, observed[i].Digest) {
+			assert.Equal(t, resultDigest(result), *observed[i].Digest)
+		}
+	}
+
+	// key only decoding ignores digests
+	keys, err := decodeObservation(b, testKeyCodec{})
+	assert.NoError(t, err)
+	assert.Equal(t, []ktypes.UpkeepKey{results[0].Key, results[1].Key}, keys)
+}
+
+func TestEncodeObservation_KeyCodec(t *testing.T) {
+	// keys are split by the provided codec and not by a fixed layout
+	keys := []ktypes.UpkeepKey{ktypes.UpkeepKey("1:1"), ktypes.UpkeepKey("1:2"), ktypes.UpkeepKey("1|3")}
+
+	ob := newObservationBuilder(colonKeyCodec{})
+	for _, key := range keys {
+		ob.Add(key)
+	}
+
+	b := ob.Encode()
+	assert.Equal(t, ob.Len(), len(b))
+
+	decoded, err := decodeObservation(b, colonKeyCodec{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, keys, decoded)
+
+	// keys the codec cannot split are kept as raw keys
+	raw := newObservationBuilder(colonKeyCodec{})
+	raw.Add(ktypes.UpkeepKey("1|3"))
+
+	split := newObservationBuilder(testKeyCodec{})
+	split.Add(ktypes.UpkeepKey("1|3"))
+
+	assert.NotEqual(t, raw.Encode(), split.Encode())
+}
+
+func TestResultDigest(t *testing.T) {
+	result := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("1|1"), State: ktypes.Eligible, PerformData: []byte("abcd"), CheckBlockNumber: 1}
+	assert.Equal(t, resultDigest(result), resultDigest(result))
+
+	changed := result
+	changed.PerformData = []byte("abce")
+	assert.NotEqual(t, resultDigest(result), resultDigest(changed))
+
+	changed = result
+	changed.CheckBlockNumber = 2
+	assert.NotEqual(t, resultDigest(result), resultDigest(changed))
+}
+
+func TestDecodeObservation_Legacy(t *testing.T) {
+	keys := []ktypes.UpkeepKey{ktypes.UpkeepKey("1|1"), ktypes.UpkeepKey("1|2")}
+
+	decoded, err := decodeObservation(mustEncodeLegacyKeys(keys), testKeyCodec{})
+	assert.NoError(t, err)
+	assert.Equal(t, keys, decoded)
+}
+
+func TestDecodeObservation_Error(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Bytes []byte
+	}{
+		{Name: "Empty", Bytes: []byte{}},
+		{Name: "Unknown Version", Bytes: []byte{0xff}},
+		{Name: "Truncated", Bytes: []byte{observationVersion1, 1, 1, '1', 2, 1}},
+		{Name: "Count Too Large", Bytes: []byte{observationVersion1, 100}},
+		{Name: "Trailing Bytes", Bytes: []byte{observationVersion1, 0, 0, 0}},
+		{Name: "Malformed Legacy", Bytes: []byte("[\"abc")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			_, err := decodeObservation(test.Bytes, testKeyCodec{})
+			assert.ErrorIs(t, err, ErrInvalidObservation)
+		})
+	}
+}
+
+func TestEncodeQuery(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Query       ocrQuery
+		ExpectedErr error
+	}{
+		{Name: "Empty Block", Query: ocrQuery{}},
+		{Name: "Numeric Block", Query: ocrQuery{Block: ktypes.BlockKey("128943862")}},
+		{Name: "Max Length Block", Query: ocrQuery{Block: ktypes.BlockKey(strings.Repeat("9", maxBlockKeyLength))}},
+		{Name: "Block Too Long", Query: ocrQuery{Block: ktypes.BlockKey(strings.Repeat("9", maxBlockKeyLength+1))}, ExpectedErr: ErrInvalidQuery},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			b, err := encodeQuery(test.Query)
+			if test.ExpectedErr != nil {
+				assert.ErrorIs(t, err, test.ExpectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, len(b), maxQueryLength)
+
+			q, err := decodeQuery(b)
+			assert.NoError(t, err)
+			assert.Equal(t, test.Query, q)
+		})
+	}
+}
+
+func TestDecodeQuery_Error(t *testing.T) {
+	_, err := decodeQuery([]byte{queryVersion1})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+
+	_, err = decodeQuery([]byte{0xff, '1'})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
 func BenchmarkDecode(b *testing.B) {
 	key1 := ktypes.UpkeepKey([]byte("1239487928374|18768923479234987"))
 	key2 := ktypes.UpkeepKey([]byte("1239487928374|18768923479234989"))
@@ -15,10 +187,8 @@ func BenchmarkDecode(b *testing.B) {
 
 	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
-		var keys []ktypes.UpkeepKey
-
 		b.StartTimer()
-		err := decode(encoded, &keys)
+		_, err := decodeObservation(encoded, testKeyCodec{})
 		b.StopTimer()
 
 		if err != nil {
@@ -26,3 +196,28 @@ func BenchmarkDecode(b *testing.B) {
 		}
 	}
 }
+
+// colonKeyCodec is a key layout of a block and an upkeep id separated by ":"
+type colonKeyCodec struct{}
+
+func (colonKeyCodec) BlockFromKey(key ktypes.UpkeepKey) (ktypes.BlockKey, error) {
+	block, _, ok := strings.Cut(string(key), ":")
+	if !ok {
+		return "", fmt.Errorf("key '%s' has no separator", key)
+	}
+
+	return ktypes.BlockKey(block), nil
+}
+
+func (colonKeyCodec) IdentifierFromKey(key ktypes.UpkeepKey) (ktypes.UpkeepIdentifier, error) {
+	_, id, ok := strings.Cut(string(key), ":")
+	if !ok {
+		return nil, fmt.Errorf("key '%s' has no separator", key)
+	}
+
+	return ktypes.UpkeepIdentifier(id), nil
+}
+
+func (colonKeyCodec) MakeKey(block ktypes.BlockKey, id ktypes.UpkeepIdentifier) ktypes.UpkeepKey {
+	return ktypes.UpkeepKey(fmt.Sprintf("%s:%s", block, id))
+}
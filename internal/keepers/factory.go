@@ -2,23 +2,48 @@ package keepers
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/smartcontractkit/libocr/offchainreporting2/types"
+	"go.uber.org/multierr"
+
 	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
 )
 
 const maxObservationLength = 1_000
 
-var _ types.ReportingPluginFactory = (*keepersReportingFactory)(nil)
+var _ ReportingPluginFactory = (*keepersReportingFactory)(nil)
+
+// ReportingPluginFactory is an OCR ReportingPluginFactory that closes all
+// plugins it created and that are still open when the factory is closed
+type ReportingPluginFactory interface {
+	types.ReportingPluginFactory
+	io.Closer
+	// Healthy returns an error naming the background processes of open
+	// plugins and registry states that failed and are waiting to be
+	// restarted
+	Healthy() error
+}
 
 type ReportingFactoryConfig struct {
 	CacheExpiration       time.Duration
 	CacheEvictionInterval time.Duration
 	MaxServiceWorkers     int
 	ServiceQueueLength    int
+	// RPCCallsPerSecond limits registry calls; 0 disables the limit
+	RPCCallsPerSecond float64
+	// RPCBatchElementsPerSecond limits upkeeps checked across registry calls;
+	// 0 disables the limit
+	RPCBatchElementsPerSecond float64
+	// RPCReportShare is the share of both limits reserved for the report phase
+	RPCReportShare float64
+	// CoordinatorStore persists perform lockouts; lockouts are kept in
+	// memory only when nil
+	CoordinatorStore ktypes.CoordinatorStore
 }
 
 type keepersReportingFactory struct {
@@ -28,13 +53,24 @@ type keepersReportingFactory struct {
 	perfLogs       ktypes.PerformLogProvider
 	logger         *log.Logger
 	config         ReportingFactoryConfig
+	// limiter is shared by all plugin instances created by the factory such
+	// that the rate limits apply to the node as a whole
+	limiter    *rpcLimiter
+	limiterErr error
+	mu         sync.Mutex
+	// plugins holds the plugins created by the factory that are still open
+	plugins map[*keepers]struct{}
+	// states holds the cache and report coordinator of each registry. the
+	// state is handed to each new plugin instance such that it is carried
+	// across config changes.
+	states map[ktypes.Registry]*registryState
 }
 
 // NewReportingPluginFactory returns an OCR ReportingPluginFactory. When the plugin
-// starts, a separate service is started as a separate go-routine automatically. There
-// is no start or stop function for this service so stopping this service relies on
-// releasing references to the plugin such that the Go garbage collector cleans up
-// hanging routines automatically.
+// starts, a separate service is started as a separate go-routine automatically. The
+// service is stopped when OCR closes the plugin and any plugins left open are
+// stopped when the factory is closed. Cached check results and transmit
+// lockouts are owned by the factory and shared by the plugins it creates.
 func NewReportingPluginFactory(
 	headSubscriber ktypes.HeadSubscriber,
 	registry ktypes.Registry,
@@ -42,7 +78,11 @@ func NewReportingPluginFactory(
 	encoder ktypes.ReportEncoder,
 	logger *log.Logger,
 	config ReportingFactoryConfig,
-) types.ReportingPluginFactory {
+) ReportingPluginFactory {
+	// an invalid limiter config is returned as an error when creating a
+	// plugin
+	limiter, err := newRPCLimiter(config.RPCCallsPerSecond, config.RPCBatchElementsPerSecond, config.RPCReportShare)
+
 	return &keepersReportingFactory{
 		headSubscriber: headSubscriber,
 		registry:       registry,
@@ -50,11 +90,17 @@ func NewReportingPluginFactory(
 		encoder:        encoder,
 		logger:         logger,
 		config:         config,
+		limiter:        limiter,
+		limiterErr:     err,
 	}
 }
 
 // NewReportingPlugin implements the libocr/offchainreporting2/types ReportingPluginFactory interface
 func (d *keepersReportingFactory) NewReportingPlugin(c types.ReportingPluginConfig) (types.ReportingPlugin, types.ReportingPluginInfo, error) {
+	if d.limiterErr != nil {
+		return nil, types.ReportingPluginInfo{}, fmt.Errorf("%w: failed to create rpc rate limiter", d.limiterErr)
+	}
+
 	offChainCfg, err := ktypes.DecodeOffchainConfig(c.OffchainConfig)
 	if err != nil {
 		return nil, types.ReportingPluginInfo{}, fmt.Errorf("%w: failed to decode off chain config", err)
@@ -65,26 +111,26 @@ func (d *keepersReportingFactory) NewReportingPlugin(c types.ReportingPluginConf
 	info := types.ReportingPluginInfo{
 		Name: fmt.Sprintf("Oracle %d: Keepers Plugin Instance w/ Digest '%s'", c.OracleID, c.ConfigDigest),
 		Limits: types.ReportingPluginLimits{
-			// queries should be empty anyway with the current implementation
-			MaxQueryLength: 0,
-			// an upkeep key is composed of a block number and upkeep id (~40 bytes)
-			// an observation is multiple upkeeps to be performed
-			// 100 upkeeps to be performed would be a very high upper limit
-			// 100 * 10 = 1_000 bytes
+			// a query is a version byte and the block key proposed by the
+			// leader
+			MaxQueryLength: maxQueryLength,
+			// an observation groups upkeep keys by block and encodes upkeep
+			// ids as varints. a uint256 upkeep id is at most 37 bytes and a
+			// small upkeep id can be a single byte. observations are
+			// truncated to exactly this limit.
 			MaxObservationLength: maxObservationLength,
 			// a report is composed of 1 or more abi encoded perform calls
-			// with performData of arbitrary length
-			MaxReportLength: 10_000, // TODO (config): pick sane limit based on expected performData size. maybe set this to block size limit or 2/3 block size limit?
+			// with performData of arbitrary length. the report packer drops
+			// upkeeps until the encoded report is within this limit.
+			MaxReportLength: maxReportLength,
 		},
 		UniqueReports: offChainCfg.UniqueReports,
 	}
 
-	// TODO (config): sample ratio is calculated with number of rounds, number
-	// of nodes, and target probability for all upkeeps to be checked. each
-	// chain will have a different average number of rounds per block. this
-	// number needs to either come from a config, or be calculated on actual
-	// performance of the nodes in real time. that is, start at 1 and increment
-	// after some blocks pass until a stable number is reached.
+	// sample ratio is calculated with number of rounds, number of nodes, and
+	// target probability for all upkeeps to be checked. each chain has a
+	// different average number of rounds per block so the ratio can be
+	// adjusted to the rounds per block measured by the node.
 	var p float64
 	if len(offChainCfg.TargetProbability) == 0 {
 		// TODO: Combine all default values in DecodeOffchainConfig
@@ -100,37 +146,261 @@ func (d *keepersReportingFactory) NewReportingPlugin(c types.ReportingPluginConf
 		offChainCfg.TargetInRounds = 1
 	}
 
-	sample, err := sampleFromProbability(offChainCfg.TargetInRounds, c.N-c.F, float32(p))
+	// the ratio from the shared config is the same on all nodes
+	shared, err := sampleFromProbability(offChainCfg.TargetInRounds, c.N-c.F, float32(p))
+	if err != nil {
+		return nil, info, fmt.Errorf("%w: failed to create plugin", err)
+	}
+
+	var (
+		ratio    sampleRatioProvider = shared
+		adaptive *adaptiveSampleRatio
+	)
+
+	if offChainCfg.AdaptiveSampleRatio {
+		min, max, err := sampleRatioBounds(offChainCfg.MinSampleRatio, offChainCfg.MaxSampleRatio)
+		if err != nil {
+			return nil, info, fmt.Errorf("%w: failed to create plugin", err)
+		}
+
+		adaptive, err = newAdaptiveSampleRatio(offChainCfg.TargetInRounds, c.N-c.F, float32(p), min, max, d.logger)
+		if err != nil {
+			return nil, info, fmt.Errorf("%w: failed to create plugin", err)
+		}
+
+		ratio = adaptive
+	}
+
+	// an upkeep id should be observed by at least one honest node to be
+	// considered in a report. the default of f+1 ensures this.
+	quorum := offChainCfg.ObservationQuorum
+	if quorum <= 0 {
+		quorum = c.F + 1
+	}
+
+	if quorum > c.N {
+		return nil, info, fmt.Errorf("observation quorum %d cannot exceed the number of oracles %d", quorum, c.N)
+	}
+
+	sampler, err := newUpkeepSampler(offChainCfg.Sampler, c.OracleID, c.N, quorum, c.ConfigDigest, shared)
+	if err != nil {
+		return nil, info, fmt.Errorf("%w: failed to create plugin", err)
+	}
+
+	// a perform tracked for reorgs must remain in the perform log window
+	// such that it is not taken as reorged out when it leaves the window
+	if chain, ok := d.perfLogs.(ktypes.PerformLogChain); ok && offChainCfg.ReorgDepth >= chain.PerformLogLookback() {
+		return nil, info, fmt.Errorf("reorg depth %d must be less than the perform log lookback of %d blocks", offChainCfg.ReorgDepth, chain.PerformLogLookback())
+	}
+
+	switch offChainCfg.ReportMode {
+	case ktypes.ReportModeRecheck, ktypes.ReportModeObservedDigests:
+	default:
+		return nil, info, fmt.Errorf("unknown report mode '%s'", offChainCfg.ReportMode)
+	}
+
+	switch offChainCfg.ObservationTruncation {
+	case ktypes.TruncateSorted, ktypes.TruncateRotating, ktypes.TruncateRandom, ktypes.TruncateLeastRecentlyPerformed:
+	default:
+		return nil, info, fmt.Errorf("unknown observation truncation '%s'", offChainCfg.ObservationTruncation)
+	}
+
+	weigh, err := upkeepPriorities(d.registry, offChainCfg.UpkeepPriorities)
+	if err != nil {
+		return nil, info, fmt.Errorf("%w: failed to create plugin", err)
+	}
+
+	packer, err := newReportPacker(offChainCfg.ReportPacker, reportLimits{
+		encoder:     d.encoder,
+		gasLimit:    offChainCfg.GasLimitPerReport,
+		gasOverhead: offChainCfg.GasOverheadPerUpkeep,
+		maxLength:   maxReportLength,
+	}, weigh)
+	if err != nil {
+		return nil, info, fmt.Errorf("%w: failed to create plugin", err)
+	}
+
+	state, err := d.registryState(
+		d.registry,
+		time.Duration(offChainCfg.PerformLockoutWindow)*time.Millisecond,
+		offChainCfg.MinConfirmations,
+		offChainCfg.ReorgDepth,
+	)
+	if err != nil {
+		return nil, info, fmt.Errorf("%w: failed to create plugin", err)
+	}
+
+	truncator, err := newObservationTruncator(offChainCfg.ObservationTruncation, d.registry, state.coordinator.LastPerformed)
 	if err != nil {
 		return nil, info, fmt.Errorf("%w: failed to create plugin", err)
 	}
 
 	service := newOnDemandUpkeepService(
-		sample,
+		ratio,
+		sampler,
 		d.headSubscriber,
 		d.registry,
+		d.limiter,
+		state.cache,
 		d.logger,
 		time.Duration(offChainCfg.SamplingJobDuration)*time.Millisecond,
-		d.config.CacheExpiration,
-		d.config.CacheEvictionInterval,
 		d.config.MaxServiceWorkers,
 		d.config.ServiceQueueLength,
 	)
 
-	return &keepers{
-		id:      c.OracleID,
-		service: service,
-		encoder: d.encoder,
-		logger:  d.logger,
-		filter: newReportCoordinator(
-			d.registry,
-			time.Duration(offChainCfg.PerformLockoutWindow)*time.Millisecond,
-			d.config.CacheEvictionInterval,
-			d.perfLogs,
-			offChainCfg.MinConfirmations,
-			d.logger,
-		),
-		reportGasLimit:    offChainCfg.GasLimitPerReport,
-		upkeepGasOverhead: offChainCfg.GasOverheadPerUpkeep,
-	}, info, nil
+	plugin := &keepers{
+		id:                c.OracleID,
+		service:           service,
+		encoder:           d.encoder,
+		registry:          d.registry,
+		logger:            d.logger,
+		filter:            state.coordinator,
+		packer:            packer,
+		observationQuorum: quorum,
+		truncator:         truncator,
+		reportMode:        offChainCfg.ReportMode,
+		adaptiveRatio:     adaptive,
+	}
+
+	d.track(plugin)
+
+	return plugin, info, nil
+}
+
+// Close closes the plugins created by the factory that were not closed by
+// OCR, stops the registry state shared by the plugins, and returns once their
+// go-routines have exited
+func (d *keepersReportingFactory) Close() error {
+	d.mu.Lock()
+	plugins := make([]*keepers, 0, len(d.plugins))
+	for plugin := range d.plugins {
+		plugins = append(plugins, plugin)
+	}
+	d.mu.Unlock()
+
+	var err error
+	for _, plugin := range plugins {
+		err = multierr.Append(err, plugin.Close())
+	}
+
+	d.mu.Lock()
+	states := d.states
+	d.states = nil
+	d.mu.Unlock()
+
+	for _, state := range states {
+		err = multierr.Append(err, state.Close())
+	}
+
+	return err
+}
+
+// Healthy implements the ReportingPluginFactory interface
+func (d *keepersReportingFactory) Healthy() error {
+	d.mu.Lock()
+	plugins := make([]*keepers, 0, len(d.plugins))
+	for plugin := range d.plugins {
+		plugins = append(plugins, plugin)
+	}
+
+	states := make([]*registryState, 0, len(d.states))
+	for _, state := range d.states {
+		states = append(states, state)
+	}
+	d.mu.Unlock()
+
+	var err error
+	for _, plugin := range plugins {
+		err = multierr.Append(err, plugin.Healthy())
+	}
+
+	for _, state := range states {
+		err = multierr.Append(err, state.Healthy())
+	}
+
+	return err
+}
+
+// registryState returns the state of the provided registry with the provided
+// config applied. The state is created for the first plugin instance of the
+// registry and restores the perform lockouts in the coordinator store.
+func (d *keepersReportingFactory) registryState(registry ktypes.Registry, lockoutWindow time.Duration, minConfs int, reorgDepth int64) (*registryState, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if state, ok := d.states[registry]; ok {
+		state.configure(lockoutWindow, minConfs, reorgDepth)
+		return state, nil
+	}
+
+	if d.states == nil {
+		d.states = make(map[ktypes.Registry]*registryState)
+	}
+
+	store := d.config.CoordinatorStore
+	if store == nil {
+		store = NewMemoryCoordinatorStore()
+	}
+
+	state, err := newRegistryState(
+		registry,
+		d.perfLogs,
+		store,
+		d.logger,
+		d.config.CacheExpiration,
+		d.config.CacheEvictionInterval,
+		lockoutWindow,
+		minConfs,
+		reorgDepth,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	d.states[registry] = state
+
+	return state, nil
+}
+
+// track records the plugin as open until it is closed
+func (d *keepersReportingFactory) track(plugin *keepers) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.plugins == nil {
+		d.plugins = make(map[*keepers]struct{})
+	}
+
+	d.plugins[plugin] = struct{}{}
+
+	plugin.onClose = func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		delete(d.plugins, plugin)
+	}
+}
+
+// sampleRatioBounds parses the configured bounds of the adaptive sample
+// ratio. empty bounds default to 0 and 1.
+func sampleRatioBounds(minValue, maxValue string) (sampleRatio, sampleRatio, error) {
+	min, max := 0.0, 1.0
+
+	if len(minValue) > 0 {
+		v, err := strconv.ParseFloat(minValue, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: failed to parse configured min sample ratio", err)
+		}
+		min = v
+	}
+
+	if len(maxValue) > 0 {
+		v, err := strconv.ParseFloat(maxValue, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: failed to parse configured max sample ratio", err)
+		}
+		max = v
+	}
+
+	return sampleRatio(min), sampleRatio(max), nil
 }
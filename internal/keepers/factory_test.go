@@ -1,10 +1,12 @@
 package keepers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
 
 	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
 )
@@ -79,4 +82,187 @@ func TestNewReportingPlugin(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "Oracle 1: Keepers Plugin Instance w/ Digest '2020202020202020202020202020202020202020202020202020202074657374'", i.Name)
 	assert.NotNil(t, p)
+
+	// the observation quorum defaults to f+1
+	assert.Equal(t, 3, p.(*keepers).observationQuorum)
+	assert.Equal(t, ktypes.ReportModeRecheck, p.(*keepers).reportMode)
+	assert.IsType(t, &greedyPacker{}, p.(*keepers).packer)
+
+	// the sample ratio is static by default
+	assert.Nil(t, p.(*keepers).adaptiveRatio)
+	assert.IsType(t, sampleRatio(0), p.(*keepers).service.(*onDemandUpkeepService).ratio)
+	assert.IsType(t, &randomSampler{}, p.(*keepers).service.(*onDemandUpkeepService).sampler)
+
+	// rpc calls are not rate limited by default
+	assert.Nil(t, p.(*keepers).service.(*onDemandUpkeepService).limiter)
+}
+
+func TestNewReportingPlugin_InvalidRateLimit(t *testing.T) {
+	f := NewReportingPluginFactory(
+		ktypes.NewMockHeadSubscriber(t),
+		ktypes.NewMockRegistry(t),
+		ktypes.NewMockPerformLogProvider(t),
+		ktypes.NewMockReportEncoder(t),
+		log.New(io.Discard, "test", 0),
+		ReportingFactoryConfig{
+			RPCCallsPerSecond: 10,
+			RPCReportShare:    1,
+		},
+	)
+
+	_, _, err := f.NewReportingPlugin(types.ReportingPluginConfig{
+		N: 5,
+		F: 2,
+	})
+
+	assert.Error(t, err)
+}
+
+func TestNewReportingPlugin_UnknownReportMode(t *testing.T) {
+	f := &keepersReportingFactory{
+		registry:       ktypes.NewMockRegistry(t),
+		encoder:        ktypes.NewMockReportEncoder(t),
+		headSubscriber: ktypes.NewMockHeadSubscriber(t),
+		perfLogs:       ktypes.NewMockPerformLogProvider(t),
+		logger:         log.New(io.Discard, "test", 0),
+	}
+
+	offchainConfig, err := json.Marshal(ktypes.OffchainConfig{
+		ReportMode: ktypes.ReportMode("unknown"),
+	})
+	require.NoError(t, err)
+
+	_, _, err = f.NewReportingPlugin(types.ReportingPluginConfig{
+		N:              5,
+		F:              2,
+		OffchainConfig: offchainConfig,
+	})
+
+	assert.Error(t, err)
+}
+
+func TestNewReportingPlugin_ReorgDepthExceedsLookback(t *testing.T) {
+	f := &keepersReportingFactory{
+		registry:       ktypes.NewMockRegistry(t),
+		encoder:        ktypes.NewMockReportEncoder(t),
+		headSubscriber: ktypes.NewMockHeadSubscriber(t),
+		perfLogs:       &chainPerformLogs{MockPerformLogProvider: ktypes.NewMockPerformLogProvider(t), lookback: 100},
+		logger:         log.New(io.Discard, "test", 0),
+	}
+
+	// the default reorg depth of 100 blocks does not fit in the window
+	_, _, err := f.NewReportingPlugin(types.ReportingPluginConfig{
+		N: 5,
+		F: 2,
+	})
+
+	assert.ErrorContains(t, err, "reorg depth")
+}
+
+func TestReportingPluginFactory_Reconfigure(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	hs := ktypes.NewMockHeadSubscriber(t)
+	rg := ktypes.NewMockRegistry(t)
+	mp := ktypes.NewMockPerformLogProvider(t)
+
+	keys := make([]ktypes.UpkeepKey, 20)
+	for i := range keys {
+		keys[i] = ktypes.UpkeepKey(fmt.Sprintf("1|%d", i+1))
+	}
+
+	var checking sync.WaitGroup
+	checking.Add(1)
+
+	var once sync.Once
+
+	hs.On("OnNewHead", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			args.Get(1).(func(ktypes.BlockKey))(ktypes.BlockKey("1"))
+			<-args.Get(0).(context.Context).Done()
+		}).Return(nil)
+
+	rg.Mock.On("GetActiveUpkeepKeys", mock.Anything, ktypes.BlockKey("1")).Return(keys, nil).Maybe()
+
+	checkArgs := make([]interface{}, keyBatchSize+1)
+	for i := range checkArgs {
+		checkArgs[i] = mock.Anything
+	}
+
+	// checks are in flight until the plugin is closed
+	rg.Mock.On("CheckUpkeep", checkArgs...).
+		Return(func(ctx context.Context, _ ...ktypes.UpkeepKey) ktypes.UpkeepResults {
+			once.Do(checking.Done)
+			<-ctx.Done()
+			return nil
+		}, func(ctx context.Context, _ ...ktypes.UpkeepKey) error {
+			return ctx.Err()
+		}).Maybe()
+
+	rg.Mock.On("IdentifierFromKey", mock.Anything).Return(ktypes.UpkeepIdentifier("1"), nil).Maybe()
+	mp.Mock.On("PerformLogs", mock.Anything).Return([]ktypes.PerformLog{}, nil).Maybe()
+
+	f := NewReportingPluginFactory(hs, rg, mp, ktypes.NewMockReportEncoder(t), log.New(io.Discard, "", 0), ReportingFactoryConfig{
+		CacheExpiration:       time.Minute,
+		CacheEvictionInterval: time.Second,
+		MaxServiceWorkers:     2,
+		ServiceQueueLength:    10,
+	})
+
+	newPlugin := func(digest types.ConfigDigest, minConfs int) types.ReportingPlugin {
+		offchainConfig, err := json.Marshal(ktypes.OffchainConfig{
+			SamplingJobDuration: time.Minute.Milliseconds(),
+			MinConfirmations:    minConfs,
+		})
+		require.NoError(t, err)
+
+		p, _, err := f.NewReportingPlugin(types.ReportingPluginConfig{
+			ConfigDigest:   digest,
+			OracleID:       1,
+			N:              4,
+			F:              1,
+			OffchainConfig: offchainConfig,
+		})
+		require.NoError(t, err)
+
+		return p
+	}
+
+	first := newPlugin(types.ConfigDigest{0x01}, 1)
+	checking.Wait()
+
+	key := ktypes.UpkeepKey("1|1")
+	require.NoError(t, first.(*keepers).filter.Accept(key))
+
+	// a config change replaces the plugin with a new instance and closes the
+	// previous instance
+	second := newPlugin(types.ConfigDigest{0x02}, 3)
+
+	// the new instance continues with the transmit lockouts of the previous
+	// instance and the new config is applied to the existing state
+	coordinator := second.(*keepers).filter.(*reportCoordinator)
+	assert.Same(t, first.(*keepers).filter, coordinator)
+	assert.False(t, coordinator.IsTransmissionConfirmed(key))
+	assert.ErrorIs(t, coordinator.Accept(key), ErrKeyAlreadySet)
+	assert.Equal(t, 3, coordinator.minConfs)
+
+	// cached check results are shared by both instances
+	assert.Same(t,
+		first.(*keepers).service.(*onDemandUpkeepService).cache,
+		second.(*keepers).service.(*onDemandUpkeepService).cache)
+
+	assert.NoError(t, first.Close())
+	assert.NoError(t, first.Close())
+
+	factory := f.(*keepersReportingFactory)
+	factory.mu.Lock()
+	assert.Len(t, factory.plugins, 1)
+	factory.mu.Unlock()
+
+	// the open plugin and the registry state are healthy
+	assert.NoError(t, f.Healthy())
+
+	// closing the factory closes the remaining plugin
+	assert.NoError(t, f.Close())
+	assert.NoError(t, second.Close())
 }
@@ -19,8 +19,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"runtime"
-	"strings"
 	"sync"
 	"time"
 
@@ -36,33 +34,82 @@ type reportCoordinator struct {
 	logger         *log.Logger
 	registry       types.Registry
 	logs           types.PerformLogProvider
+	store          types.CoordinatorStore
+	mu             sync.RWMutex
 	minConfs       int
+	reorgDepth     int64
 	idBlocks       *util.Cache[types.BlockKey] // should clear out when the next perform with this id occurs
 	activeKeys     *util.Cache[bool]
 	cacheCleaner   *util.IntervalCacheCleaner[bool]
 	idCacheCleaner *util.IntervalCacheCleaner[types.BlockKey]
 	starter        sync.Once
-	chStop         chan struct{}
+	supervisor     *util.Supervisor
+	// performs holds the confirmed perform logs tracked for reorgs by key and
+	// head is the latest block seen in perform logs. both are only accessed
+	// by the log poll.
+	performs map[string]trackedPerform
+	head     int64
+	// lastPerforms holds the latest perform seen for each upkeep id and is
+	// guarded by mu
+	lastPerforms map[string]lastPerform
 }
 
-func newReportCoordinator(r types.Registry, s time.Duration, cacheClean time.Duration, logs types.PerformLogProvider, minConfs int, logger *log.Logger) *reportCoordinator {
+// lastPerform is the block of the latest perform of an upkeep id and the
+// time the perform was first seen
+type lastPerform struct {
+	block int64
+	seen  time.Time
+}
+
+// trackedPerform is a confirmed perform log that can still be reorged out
+type trackedPerform struct {
+	id        types.UpkeepIdentifier
+	block     int64
+	blockHash string
+}
+
+// newReportCoordinator creates a coordinator that writes perform lockouts to
+// the provided store. Lockouts in the store are restored such that a
+// restarted node does not report upkeeps waiting for a transmit to be
+// confirmed. Confirmed performs are tracked for reorgs up to the provided
+// depth in blocks.
+func newReportCoordinator(r types.Registry, s time.Duration, cacheClean time.Duration, logs types.PerformLogProvider, store types.CoordinatorStore, minConfs int, reorgDepth int64, logger *log.Logger) (*reportCoordinator, error) {
 	c := &reportCoordinator{
 		logger:         logger,
 		registry:       r,
 		logs:           logs,
+		store:          store,
 		minConfs:       minConfs,
+		reorgDepth:     reorgDepth,
 		idBlocks:       util.NewCache[types.BlockKey](s),
 		activeKeys:     util.NewCache[bool](time.Hour), // 1 hour allows the cleanup routine to clear stale data
 		idCacheCleaner: util.NewIntervalCacheCleaner[types.BlockKey](cacheClean),
 		cacheCleaner:   util.NewIntervalCacheCleaner[bool](cacheClean),
-		chStop:         make(chan struct{}),
+		supervisor:     util.NewSupervisor(logger, util.DefaultMinRestartBackoff, util.DefaultMaxRestartBackoff),
+		performs:       make(map[string]trackedPerform),
+		lastPerforms:   make(map[string]lastPerform),
 	}
 
-	runtime.SetFinalizer(c, func(srv *reportCoordinator) { srv.stop() })
+	if err := c.restore(); err != nil {
+		return nil, err
+	}
 
 	c.start()
 
-	return c
+	return c, nil
+}
+
+// configure applies the config of a new plugin instance. The lockout window
+// applies to ids accepted from now on; ids already locked out keep their
+// lockout.
+func (rc *reportCoordinator) configure(lockoutWindow time.Duration, minConfs int, reorgDepth int64) {
+	rc.idBlocks.SetDefaultExpiration(lockoutWindow)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.minConfs = minConfs
+	rc.reorgDepth = reorgDepth
 }
 
 // Filter returns a filter function that removes upkeep keys that apply to this
@@ -77,20 +124,24 @@ func (rc *reportCoordinator) Filter() func(types.UpkeepKey) bool {
 
 		// only apply filter if key id is registered in the cache
 		if bl, ok := rc.idBlocks.Get(string(id)); ok {
-			// TODO: the key is constructed in the registry. splitting out the
-			// block number here is a hack solution that should be fixed asap.
-			var blKey string
-			parts := strings.Split(string(key), "|")
-			if len(parts) == 2 {
-				blKey = parts[0]
+			blKey, err := rc.registry.BlockFromKey(key)
+			if err != nil {
+				// filter on error
+				return false
+			}
+
+			if len(bl) == 0 {
+				return false
 			}
 
 			// only apply filter if key block is after block in cache
-			if len(bl) > 0 && blKey > string(bl) {
-				return true
+			after, err := types.BlockAfter(rc.registry, blKey, bl)
+			if err != nil {
+				// filter on error
+				return false
 			}
 
-			return false
+			return after
 		}
 
 		return true
@@ -108,8 +159,8 @@ func (rc *reportCoordinator) Accept(key types.UpkeepKey) error {
 		return err
 	}
 
-	rc.idBlocks.Set(string(id), types.BlockKey([]byte{}), util.DefaultCacheExpiration)
-	rc.activeKeys.Set(string(key), false, util.DefaultCacheExpiration)
+	rc.lockoutID(id, types.BlockKey([]byte{}))
+	rc.setTransmit(key, false)
 
 	return nil
 }
@@ -121,20 +172,46 @@ func (rc *reportCoordinator) IsTransmissionConfirmed(key types.UpkeepKey) bool {
 	return !ok || (ok && confirmed)
 }
 
-func (rc *reportCoordinator) checkLogs() {
-	logs, _ := rc.logs.PerformLogs(context.Background())
+func (rc *reportCoordinator) checkLogs(ctx context.Context) {
+	logs, err := rc.logs.PerformLogs(ctx)
+	if err != nil {
+		// logs missing from a failed poll are not the result of a reorg
+		rc.logger.Printf("%s: failed to poll perform logs", err)
+		return
+	}
+
+	rc.mu.RLock()
+	minConfs := rc.minConfs
+	reorgDepth := rc.reorgDepth
+	rc.mu.RUnlock()
+
+	if rc.performs == nil {
+		rc.performs = make(map[string]trackedPerform)
+	}
+
+	// performed keys in the canonical chain regardless of confirmations
+	performed := make(map[string]struct{}, len(logs))
 
 	// log entries indicate that a perform exists on chain in some
 	// capacity. the existance of an entry means that the transaction
 	// was broadcast by at least one node. reorgs can still happen
 	// causing performs to vanish or get moved to a later block.
 	//
-	// in the case of reorgs causing a perform to be dropped from the
-	// chain, the key is kept in cache even after first detection to
-	// ensure no other nodes attempt to transmit again.
+	// confirmed performs are tracked until they are deeper than the reorg
+	// depth. an upkeep is unlocked when its perform vanishes from the
+	// canonical chain or the report is rejected because it was checked on a
+	// reorged block.
 	for _, l := range logs {
-		if l.Confirmations < int64(rc.minConfs) {
-			rc.logger.Printf("Skipping log in transaction %s as confirmations (%d) is less than min confirmations (%d)", l.TransactionHash, l.Confirmations, rc.minConfs)
+		if head := l.BlockNumber + l.Confirmations; head > rc.head {
+			rc.head = head
+		}
+
+		if !l.Reorged {
+			performed[string(l.Key)] = struct{}{}
+		}
+
+		if l.Confirmations < int64(minConfs) {
+			rc.logger.Printf("Skipping log in transaction %s as confirmations (%d) is less than min confirmations (%d)", l.TransactionHash, l.Confirmations, minConfs)
 			continue
 		}
 
@@ -143,40 +220,243 @@ func (rc *reportCoordinator) checkLogs() {
 			continue
 		}
 
+		if !l.Reorged {
+			rc.setLastPerform(id, l.BlockNumber)
+		}
+
+		// a tracked perform included in a different block after a reorg
+		// locks out the id until the new transmit block
+		if tracked, ok := rc.performs[string(l.Key)]; ok && !l.Reorged && tracked.blockHash != l.BlockHash {
+			rc.logger.Printf("Perform log for key %s moved from block %d to block %s in transaction %s", l.Key, tracked.block, l.TransmitBlock, l.TransactionHash)
+			rc.lockoutID(id, l.TransmitBlock)
+			rc.performs[string(l.Key)] = trackedPerform{id: id, block: l.BlockNumber, blockHash: l.BlockHash}
+		}
+
 		// Process log if the key hasn't been confirmed yet
 		confirmed, ok := rc.activeKeys.Get(string(l.Key))
 		if ok && !confirmed {
-			rc.logger.Printf("Perform log found for key %s in transaction %s at block %s, with confirmations %d", l.Key, l.TransactionHash, l.TransmitBlock, l.Confirmations)
-			// if we detect a log, remove it from the observation filters
-			// to allow it to be reported on again at or after the block in
-			// which it was transmitted
-			rc.idBlocks.Set(string(id), l.TransmitBlock, util.DefaultCacheExpiration)
+			if l.Reorged {
+				// the upkeep was not performed and can be reported again
+				// on a block in the canonical chain
+				rc.logger.Printf("Reorged report log found for key %s in transaction %s at block %s; unlocking upkeep", l.Key, l.TransactionHash, l.TransmitBlock)
+				rc.unlockID(id)
+			} else {
+				rc.logger.Printf("Perform log found for key %s in transaction %s at block %s, with confirmations %d", l.Key, l.TransactionHash, l.TransmitBlock, l.Confirmations)
+				// if we detect a log, remove it from the observation filters
+				// to allow it to be reported on again at or after the block in
+				// which it was transmitted
+				rc.extendLockout(id, l.TransmitBlock)
+				rc.performs[string(l.Key)] = trackedPerform{id: id, block: l.BlockNumber, blockHash: l.BlockHash}
+			}
 
 			// set state of key to indicate that the report was transmitted
 			// setting a key in this way also blocks it in Accept even if
 			// Accept was never called for on a single node for this key
-			rc.activeKeys.Set(string(l.Key), true, util.DefaultCacheExpiration)
+			rc.setTransmit(l.Key, true)
+		}
+	}
+
+	rc.checkReorgs(ctx, performed, reorgDepth)
+}
+
+// checkReorgs unlocks the upkeeps of tracked performs that vanished from the
+// canonical chain. A perform missing from a poll is only reorged out when the
+// poll reached the block of the perform and the hash of that block changed
+// such that a lagging RPC node does not unlock upkeeps. Performs deeper than
+// the reorg depth are final and are no longer tracked.
+func (rc *reportCoordinator) checkReorgs(ctx context.Context, performed map[string]struct{}, reorgDepth int64) {
+	chain, canConfirm := rc.logs.(types.PerformLogChain)
+
+	var polled int64
+	if canConfirm {
+		polled = chain.PolledHead()
+		if polled > rc.head {
+			rc.head = polled
+		}
+	}
+
+	for key, tracked := range rc.performs {
+		if rc.head-tracked.block > reorgDepth {
+			delete(rc.performs, key)
+			continue
+		}
+
+		if _, ok := performed[key]; ok {
+			continue
+		}
+
+		if !canConfirm || polled < tracked.block {
+			continue
+		}
+
+		hash, err := chain.BlockHash(ctx, tracked.block)
+		if err != nil {
+			rc.logger.Printf("%s: failed to confirm reorg of block %d for perform log of key %s", err, tracked.block, key)
+			continue
+		}
+
+		if hash == tracked.blockHash {
+			continue
+		}
+
+		rc.logger.Printf("Perform log for key %s at block %d was reorged out; unlocking upkeep", key, tracked.block)
+		rc.unlockID(tracked.id)
+		delete(rc.performs, key)
+	}
+}
+
+// setLastPerform records the time a perform of an id in a later block than
+// the last perform was first seen
+func (rc *reportCoordinator) setLastPerform(id types.UpkeepIdentifier, block int64) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.lastPerforms == nil {
+		rc.lastPerforms = make(map[string]lastPerform)
+	}
+
+	if last, ok := rc.lastPerforms[string(id)]; ok && last.block >= block {
+		return
+	}
+
+	rc.lastPerforms[string(id)] = lastPerform{block: block, seen: time.Now()}
+}
+
+// LastPerformed returns the time the latest perform of an upkeep id with the
+// min confirmations was first seen in perform logs
+func (rc *reportCoordinator) LastPerformed(id types.UpkeepIdentifier) (time.Time, bool) {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	last, ok := rc.lastPerforms[string(id)]
+
+	return last.seen, ok
+}
+
+// lockoutID sets the block after which an id can be reported again and
+// writes the lockout to the store
+func (rc *reportCoordinator) lockoutID(id types.UpkeepIdentifier, block types.BlockKey) {
+	item := rc.idBlocks.Set(string(id), block, util.DefaultCacheExpiration)
+
+	rc.persist(types.CoordinatorRecord{
+		Type:    types.IDLockoutRecord,
+		Key:     id,
+		Block:   block,
+		Expires: expiresAt(item.Expires),
+	})
+}
+
+// extendLockout locks out an id until the provided block unless the id is
+// already locked out until a later block by a perform of another key. A
+// lockout that cannot be compared is replaced.
+func (rc *reportCoordinator) extendLockout(id types.UpkeepIdentifier, block types.BlockKey) {
+	if current, ok := rc.idBlocks.Get(string(id)); ok && len(current) > 0 {
+		after, err := types.BlockAfter(rc.registry, current, block)
+		if err != nil {
+			rc.logger.Printf("%s: failed to compare lockout block %s of id %s to block %s", err, current, id, block)
+		} else if after {
+			return
+		}
+	}
+
+	rc.lockoutID(id, block)
+}
+
+// unlockID removes the lockout of an id such that it can be reported at any
+// block. An expired record replaces the lockout in the store.
+func (rc *reportCoordinator) unlockID(id types.UpkeepIdentifier) {
+	rc.idBlocks.Delete(string(id))
+
+	rc.persist(types.CoordinatorRecord{
+		Type:    types.IDLockoutRecord,
+		Key:     id,
+		Expires: time.Now(),
+	})
+}
+
+// setTransmit sets whether the transmit of a key is confirmed and writes the
+// state to the store
+func (rc *reportCoordinator) setTransmit(key types.UpkeepKey, confirmed bool) {
+	item := rc.activeKeys.Set(string(key), confirmed, util.DefaultCacheExpiration)
+
+	rc.persist(types.CoordinatorRecord{
+		Type:      types.TransmitRecord,
+		Key:       key,
+		Confirmed: confirmed,
+		Expires:   expiresAt(item.Expires),
+	})
+}
+
+// persist writes a record to the store. The in-memory state applies while
+// the node is running when the record cannot be stored.
+func (rc *reportCoordinator) persist(record types.CoordinatorRecord) {
+	if err := rc.store.Store(record); err != nil {
+		rc.logger.Printf("%s: failed to store report coordinator record for key '%s'", err, record.Key)
+	}
+}
+
+// restore loads the records of the store into the caches
+func (rc *reportCoordinator) restore() error {
+	records, err := rc.store.Load()
+	if err != nil {
+		return fmt.Errorf("%w: failed to load report coordinator state", err)
+	}
+
+	for _, record := range records {
+		var expires int64
+		if !record.Expires.IsZero() {
+			expires = record.Expires.UnixNano()
 		}
+
+		switch record.Type {
+		case types.IDLockoutRecord:
+			rc.idBlocks.SetItem(string(record.Key), util.CacheItem[types.BlockKey]{Item: record.Block, Expires: expires})
+		case types.TransmitRecord:
+			rc.activeKeys.SetItem(string(record.Key), util.CacheItem[bool]{Item: record.Confirmed, Expires: expires})
+		}
+	}
+
+	if len(records) > 0 {
+		rc.logger.Printf("restored %d report coordinator records", len(records))
 	}
+
+	return nil
 }
 
 func (rc *reportCoordinator) start() {
 	rc.starter.Do(func() {
-		go rc.run()
-		go rc.idCacheCleaner.Run(rc.idBlocks)
-		go rc.cacheCleaner.Run(rc.activeKeys)
+		rc.supervisor.Go("report coordinator log poll", rc.run)
+		rc.supervisor.Go("report coordinator id cache cleaner", func(_ context.Context) error {
+			rc.idCacheCleaner.Run(rc.idBlocks)
+			return nil
+		})
+		rc.supervisor.Go("report coordinator key cache cleaner", func(_ context.Context) error {
+			rc.cacheCleaner.Run(rc.activeKeys)
+			return nil
+		})
 	})
 }
 
+// Healthy returns an error naming the background processes that failed and
+// are waiting to be restarted
+func (rc *reportCoordinator) Healthy() error {
+	return rc.supervisor.Healthy()
+}
+
+// Close stops the log poll and cache cleaners and returns once their
+// go-routines have exited
+func (rc *reportCoordinator) Close() error {
+	rc.stop()
+	return nil
+}
+
 func (rc *reportCoordinator) stop() {
-	rc.chStop <- struct{}{}
 	rc.idCacheCleaner.Stop()
 	rc.cacheCleaner.Stop()
+	rc.supervisor.Stop()
 }
 
-func (rc *reportCoordinator) run() {
-	// TODO: handle panics by restarting this process
-
+func (rc *reportCoordinator) run(ctx context.Context) error {
 	cadence := time.Second
 	timer := time.NewTimer(cadence)
 
@@ -185,7 +465,7 @@ func (rc *reportCoordinator) run() {
 		case <-timer.C:
 			startTime := time.Now()
 
-			rc.checkLogs()
+			rc.checkLogs(ctx)
 
 			// attempt to ahere to a cadence of at least every second
 			// a slow DB will cause the cadence to increase. these cases are logged
@@ -198,9 +478,18 @@ func (rc *reportCoordinator) run() {
 				// wait the difference between the cadence and the time taken
 				timer.Reset(cadence - diff)
 			}
-		case <-rc.chStop:
+		case <-ctx.Done():
 			timer.Stop()
-			return
+			return nil
 		}
 	}
 }
+
+// expiresAt converts a cache expiration to a time where 0 never expires
+func expiresAt(expires int64) time.Time {
+	if expires == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, expires)
+}
@@ -1,13 +1,19 @@
 package keepers
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/smartcontractkit/ocr2keepers/internal/util"
 	"github.com/smartcontractkit/ocr2keepers/pkg/types"
@@ -23,10 +29,10 @@ func TestReportCoordinator(t *testing.T) {
 		logger:     l,
 		registry:   mr,
 		logs:       mp,
+		store:      NewMemoryCoordinatorStore(),
 		idBlocks:   util.NewCache[types.BlockKey](time.Second),
 		activeKeys: util.NewCache[bool](time.Minute),
 		minConfs:   1,
-		chStop:     make(chan struct{}),
 	}
 
 	// set up the mocks and mock data
@@ -37,6 +43,11 @@ func TestReportCoordinator(t *testing.T) {
 	bk2 := types.BlockKey("2")
 	filter := rc.Filter()
 
+	mr.Mock.On("BlockFromKey", key1Block1).Return(types.BlockKey("1"), nil).Maybe()
+	mr.Mock.On("BlockFromKey", key1Block2).Return(bk2, nil).Maybe()
+	mr.Mock.On("BlockFromKey", key1Block3).Return(types.BlockKey("3"), nil).Maybe()
+	mr.Mock.On("CompareBlocks", mock.Anything, mock.Anything).Return(testCompareBlocks, nil).Maybe()
+
 	t.Run("FilterBeforeAccept", func(t *testing.T) {
 		// calling filter at this point should return true because the key has not
 		// yet been added to the filter
@@ -79,7 +90,7 @@ func TestReportCoordinator(t *testing.T) {
 			{Key: key1Block1, TransmitBlock: bk2, Confirmations: 0},
 		}, nil).Once()
 
-		rc.checkLogs()
+		rc.checkLogs(context.Background())
 
 		// perform log didn't have the threshold number of confirmations
 		// making the key still locked at all blocks
@@ -99,7 +110,7 @@ func TestReportCoordinator(t *testing.T) {
 			{Key: key1Block1, TransmitBlock: bk2, Confirmations: 1},
 		}, nil).Once()
 
-		rc.checkLogs()
+		rc.checkLogs(context.Background())
 
 		// because the transmit block is block 2, the filter should continue
 		// to filter out key up to block 2
@@ -121,3 +132,359 @@ func TestReportCoordinator(t *testing.T) {
 	mp.AssertExpectations(t)
 	mr.AssertExpectations(t)
 }
+
+func TestReportCoordinator_Restore(t *testing.T) {
+	mr := types.NewMockRegistry(t)
+	mp := types.NewMockPerformLogProvider(t)
+
+	l := log.New(io.Discard, "nil", 0)
+	store := NewMemoryCoordinatorStore()
+
+	key1Block1 := types.UpkeepKey("1|1")
+	key1Block2 := types.UpkeepKey("2|1")
+	id1 := types.UpkeepIdentifier("1")
+
+	mr.Mock.On("IdentifierFromKey", mock.Anything).Return(id1, nil)
+	mr.Mock.On("BlockFromKey", mock.Anything).Return(testBlockFromKey, nil).Maybe()
+	mr.Mock.On("CompareBlocks", mock.Anything, mock.Anything).Return(testCompareBlocks, nil).Maybe()
+	mp.Mock.On("PerformLogs", mock.Anything).Return([]types.PerformLog{}, nil).Maybe()
+
+	rc, err := newReportCoordinator(mr, time.Minute, time.Second, mp, store, 1, 100, l)
+	assert.NoError(t, err)
+	assert.NoError(t, rc.Accept(key1Block1))
+	assert.NoError(t, rc.Close())
+
+	// a restarted node restores the lockout of the accepted key from the
+	// store
+	rc, err = newReportCoordinator(mr, time.Minute, time.Second, mp, store, 1, 100, l)
+	assert.NoError(t, err)
+
+	defer rc.Close()
+
+	assert.False(t, rc.IsTransmissionConfirmed(key1Block1), "transmit of the restored key should not be confirmed")
+	assert.ErrorIs(t, rc.Accept(key1Block1), ErrKeyAlreadySet)
+	assert.False(t, rc.Filter()(key1Block2), "id of the restored key should be filtered out")
+
+	// the id remains locked out until a perform is confirmed
+	bl, ok := rc.idBlocks.Get(string(id1))
+	assert.True(t, ok)
+	assert.Equal(t, types.BlockKey(""), bl)
+}
+
+func TestReportCoordinator_RestoreFileStore(t *testing.T) {
+	mr := types.NewMockRegistry(t)
+	mp := types.NewMockPerformLogProvider(t)
+
+	l := log.New(io.Discard, "nil", 0)
+	path := filepath.Join(t.TempDir(), "coordinator.log")
+
+	// ids are raw big int bytes that are not valid UTF-8
+	key := types.UpkeepKey("1|1")
+	id := types.UpkeepIdentifier(append([]byte{0xff, 0xfe, 0x80}, make([]byte, 26)...))
+
+	mr.Mock.On("IdentifierFromKey", mock.Anything).Return(id, nil)
+	mr.Mock.On("BlockFromKey", mock.Anything).Return(testBlockFromKey, nil).Maybe()
+	mr.Mock.On("CompareBlocks", mock.Anything, mock.Anything).Return(testCompareBlocks, nil).Maybe()
+	mp.Mock.On("PerformLogs", mock.Anything).Return([]types.PerformLog{}, nil).Maybe()
+
+	store, err := NewFileCoordinatorStore(path)
+	require.NoError(t, err)
+
+	rc, err := newReportCoordinator(mr, time.Minute, time.Second, mp, store, 1, 100, l)
+	require.NoError(t, err)
+	assert.NoError(t, rc.Accept(key))
+	assert.NoError(t, rc.Close())
+	require.NoError(t, store.Close())
+
+	// a restarted node restores the lockout of the exact id from the file
+	store, err = NewFileCoordinatorStore(path)
+	require.NoError(t, err)
+
+	defer store.Close()
+
+	rc, err = newReportCoordinator(mr, time.Minute, time.Second, mp, store, 1, 100, l)
+	require.NoError(t, err)
+
+	defer rc.Close()
+
+	bl, ok := rc.idBlocks.Get(string(id))
+	assert.True(t, ok, "lockout of the id should be restored")
+	assert.Equal(t, types.BlockKey(""), bl)
+	assert.False(t, rc.Filter()(types.UpkeepKey("2|1")), "id of the restored key should be filtered out")
+}
+
+// chainPerformLogs is a perform log provider that confirms reorgs from the
+// provided head and block hashes
+type chainPerformLogs struct {
+	*types.MockPerformLogProvider
+	lookback int64
+	head     int64
+	hashes   map[int64]string
+}
+
+func (c *chainPerformLogs) PerformLogLookback() int64 {
+	return c.lookback
+}
+
+func (c *chainPerformLogs) PolledHead() int64 {
+	return c.head
+}
+
+func (c *chainPerformLogs) BlockHash(_ context.Context, block int64) (string, error) {
+	hash, ok := c.hashes[block]
+	if !ok {
+		return "", fmt.Errorf("block %d not found", block)
+	}
+
+	return hash, nil
+}
+
+func TestReportCoordinator_Reorg(t *testing.T) {
+	mr := types.NewMockRegistry(t)
+	mp := &chainPerformLogs{
+		MockPerformLogProvider: types.NewMockPerformLogProvider(t),
+		lookback:               100,
+		hashes:                 make(map[int64]string),
+	}
+
+	rc := &reportCoordinator{
+		logger:     log.New(io.Discard, "nil", 0),
+		registry:   mr,
+		logs:       mp,
+		store:      NewMemoryCoordinatorStore(),
+		idBlocks:   util.NewCache[types.BlockKey](time.Minute),
+		activeKeys: util.NewCache[bool](time.Minute),
+		minConfs:   1,
+		reorgDepth: 10,
+	}
+
+	id1 := types.UpkeepIdentifier("1")
+	mr.Mock.On("IdentifierFromKey", mock.Anything).Return(id1, nil)
+	mr.Mock.On("BlockFromKey", mock.Anything).Return(testBlockFromKey, nil).Maybe()
+	mr.Mock.On("CompareBlocks", mock.Anything, mock.Anything).Return(testCompareBlocks, nil).Maybe()
+
+	poll := func(logs ...types.PerformLog) {
+		mp.Mock.On("PerformLogs", mock.Anything).Return(logs, nil).Once()
+		rc.checkLogs(context.Background())
+	}
+
+	locked := func(key string) bool {
+		return !rc.Filter()(types.UpkeepKey(key))
+	}
+
+	t.Run("PerformReorgedOut", func(t *testing.T) {
+		key := types.UpkeepKey("1|1")
+		assert.NoError(t, rc.Accept(key))
+
+		mp.head = 3
+		poll(types.PerformLog{Key: key, TransmitBlock: "2", BlockNumber: 2, BlockHash: "0x2a", Confirmations: 1})
+		assert.True(t, rc.IsTransmissionConfirmed(key))
+		assert.True(t, locked("2|1"), "id should be locked out until after the transmit block")
+
+		// a lagging node that has not reached the block of the perform
+		// returns no logs
+		mp.head = 1
+		poll()
+		assert.True(t, locked("2|1"), "id should remain locked out when the poll did not reach the perform")
+
+		// the block hash cannot be fetched
+		mp.head = 3
+		poll()
+		assert.True(t, locked("2|1"), "id should remain locked out when the reorg cannot be confirmed")
+
+		// the perform is missing from a poll but its block did not change
+		mp.hashes[2] = "0x2a"
+		poll()
+		assert.True(t, locked("2|1"), "id should remain locked out when the block of the perform did not change")
+		assert.Len(t, rc.performs, 1)
+
+		// the perform vanishes from the canonical chain
+		mp.hashes[2] = "0x2b"
+		poll()
+		assert.False(t, locked("2|1"), "id should be unlocked after the perform was reorged out")
+		assert.Empty(t, rc.performs)
+	})
+
+	t.Run("PerformMoved", func(t *testing.T) {
+		key := types.UpkeepKey("3|1")
+		assert.NoError(t, rc.Accept(key))
+
+		poll(types.PerformLog{Key: key, TransmitBlock: "4", BlockNumber: 4, BlockHash: "0x4a", Confirmations: 1})
+		assert.True(t, locked("4|1"))
+		assert.False(t, locked("5|1"))
+
+		// the perform is included in a later block after a reorg
+		poll(types.PerformLog{Key: key, TransmitBlock: "5", BlockNumber: 5, BlockHash: "0x5b", Confirmations: 1})
+		assert.True(t, locked("5|1"), "id should be locked out until after the new transmit block")
+		assert.False(t, locked("6|1"))
+
+		// a perform below min confirmations is still in the canonical chain
+		poll(types.PerformLog{Key: key, TransmitBlock: "6", BlockNumber: 6, BlockHash: "0x6c", Confirmations: 0})
+		assert.True(t, locked("5|1"))
+		assert.Len(t, rc.performs, 1)
+	})
+
+	t.Run("ReorgedReport", func(t *testing.T) {
+		key := types.UpkeepKey("7|1")
+		assert.NoError(t, rc.Accept(key))
+		assert.True(t, locked("8|1"))
+
+		// the report was checked on a block that was reorged out
+		poll(types.PerformLog{Key: key, TransmitBlock: "8", BlockNumber: 8, BlockHash: "0x8a", Confirmations: 1, Reorged: true})
+		assert.True(t, rc.IsTransmissionConfirmed(key), "a reorged report is not transmitted again")
+		assert.False(t, locked("8|1"), "id should be unlocked after the report was reorged")
+		assert.NotContains(t, rc.performs, string(key))
+	})
+
+	t.Run("FinalPerform", func(t *testing.T) {
+		key := types.UpkeepKey("10|1")
+		assert.NoError(t, rc.Accept(key))
+
+		poll(types.PerformLog{Key: key, TransmitBlock: "11", BlockNumber: 11, BlockHash: "0x11a", Confirmations: 1})
+		assert.Contains(t, rc.performs, string(key))
+
+		// a perform deeper than the reorg depth is no longer tracked and
+		// remains locked out when it is no longer polled
+		poll(types.PerformLog{Key: key, TransmitBlock: "11", BlockNumber: 11, BlockHash: "0x11a", Confirmations: 11})
+		assert.Empty(t, rc.performs)
+
+		poll()
+		assert.True(t, locked("11|1"))
+	})
+
+	t.Run("FailedPoll", func(t *testing.T) {
+		key := types.UpkeepKey("20|1")
+		assert.NoError(t, rc.Accept(key))
+
+		poll(types.PerformLog{Key: key, TransmitBlock: "21", BlockNumber: 21, BlockHash: "0x21a", Confirmations: 1})
+
+		// logs missing from a failed poll are not reorged out
+		mp.MockPerformLogProvider.Mock.On("PerformLogs", mock.Anything).Return(nil, fmt.Errorf("poll failed")).Once()
+		rc.checkLogs(context.Background())
+
+		assert.True(t, locked("21|1"))
+		assert.Len(t, rc.performs, 1)
+	})
+}
+
+func TestReportCoordinator_BlockOrder(t *testing.T) {
+	mr := types.NewMockRegistry(t)
+	mp := types.NewMockPerformLogProvider(t)
+
+	rc := &reportCoordinator{
+		logger:     log.New(io.Discard, "nil", 0),
+		registry:   mr,
+		logs:       mp,
+		store:      NewMemoryCoordinatorStore(),
+		idBlocks:   util.NewCache[types.BlockKey](time.Minute),
+		activeKeys: util.NewCache[bool](time.Minute),
+		minConfs:   1,
+	}
+
+	mr.Mock.On("IdentifierFromKey", mock.Anything).Return(types.UpkeepIdentifier("1"), nil).Maybe()
+	mr.Mock.On("BlockFromKey", mock.Anything).Return(testBlockFromKey, nil).Maybe()
+	mr.Mock.On("CompareBlocks", mock.Anything, mock.Anything).Return(testCompareBlocks, nil).Maybe()
+
+	filter := rc.Filter()
+
+	assert.NoError(t, rc.Accept(types.UpkeepKey("990|1")))
+	assert.NoError(t, rc.Accept(types.UpkeepKey("995|1")))
+
+	mp.Mock.On("PerformLogs", mock.Anything).Return([]types.PerformLog{
+		{Key: types.UpkeepKey("995|1"), TransmitBlock: "1000", Confirmations: 1},
+		{Key: types.UpkeepKey("990|1"), TransmitBlock: "999", Confirmations: 1},
+	}, nil).Once()
+
+	rc.checkLogs(context.Background())
+
+	// the earlier transmit block of a later log does not shorten the lockout
+	bl, ok := rc.idBlocks.Get("1")
+	assert.True(t, ok)
+	assert.Equal(t, types.BlockKey("1000"), bl)
+
+	// blocks are ordered by the registry and not as strings
+	assert.False(t, filter(types.UpkeepKey("999|1")), "key at block 999 should be filtered out")
+	assert.False(t, filter(types.UpkeepKey("1000|1")), "key at block 1000 should be filtered out")
+	assert.True(t, filter(types.UpkeepKey("1001|1")), "key at block 1001 should not be filtered out")
+
+	t.Run("Compare Error", func(t *testing.T) {
+		mr := types.NewMockRegistry(t)
+		rc.registry = mr
+
+		mr.Mock.On("IdentifierFromKey", mock.Anything).Return(types.UpkeepIdentifier("1"), nil)
+		mr.Mock.On("BlockFromKey", mock.Anything).Return(testBlockFromKey, nil)
+		mr.Mock.On("CompareBlocks", mock.Anything, mock.Anything).Return(0, fmt.Errorf("not comparable"))
+
+		assert.False(t, rc.Filter()(types.UpkeepKey("1001|1")), "key should be filtered out when blocks cannot be compared")
+	})
+}
+
+func TestReportCoordinator_LastPerformed(t *testing.T) {
+	mr := types.NewMockRegistry(t)
+	mp := types.NewMockPerformLogProvider(t)
+
+	rc := &reportCoordinator{
+		logger:     log.New(io.Discard, "nil", 0),
+		registry:   mr,
+		logs:       mp,
+		store:      NewMemoryCoordinatorStore(),
+		idBlocks:   util.NewCache[types.BlockKey](time.Minute),
+		activeKeys: util.NewCache[bool](time.Minute),
+		minConfs:   1,
+	}
+
+	mr.Mock.On("IdentifierFromKey", mock.Anything).Return(types.UpkeepIdentifier("1"), nil)
+
+	_, ok := rc.LastPerformed(types.UpkeepIdentifier("1"))
+	assert.False(t, ok)
+
+	mp.Mock.On("PerformLogs", mock.Anything).Return([]types.PerformLog{
+		{Key: types.UpkeepKey("10|1"), TransmitBlock: "11", BlockNumber: 11, Confirmations: 1},
+	}, nil).Once()
+	rc.checkLogs(context.Background())
+
+	first, ok := rc.LastPerformed(types.UpkeepIdentifier("1"))
+	assert.True(t, ok)
+
+	// a perform seen again or a perform in an earlier block does not change
+	// the time of the last perform
+	mp.Mock.On("PerformLogs", mock.Anything).Return([]types.PerformLog{
+		{Key: types.UpkeepKey("10|1"), TransmitBlock: "11", BlockNumber: 11, Confirmations: 2},
+		{Key: types.UpkeepKey("5|1"), TransmitBlock: "6", BlockNumber: 6, Confirmations: 7},
+	}, nil).Once()
+	rc.checkLogs(context.Background())
+
+	last, ok := rc.LastPerformed(types.UpkeepIdentifier("1"))
+	assert.True(t, ok)
+	assert.Equal(t, first, last)
+
+	mp.Mock.On("PerformLogs", mock.Anything).Return([]types.PerformLog{
+		{Key: types.UpkeepKey("20|1"), TransmitBlock: "21", BlockNumber: 21, Confirmations: 1},
+	}, nil).Once()
+	rc.checkLogs(context.Background())
+
+	last, ok = rc.LastPerformed(types.UpkeepIdentifier("1"))
+	assert.True(t, ok)
+	assert.False(t, last.Before(first))
+	assert.Equal(t, int64(21), rc.lastPerforms["1"].block)
+}
+
+// testBlockFromKey returns the block of a test key in the block|id layout
+func testBlockFromKey(key types.UpkeepKey) types.BlockKey {
+	return types.BlockKey(strings.Split(string(key), "|")[0])
+}
+
+// testCompareBlocks orders test block keys by block number
+func testCompareBlocks(a, b types.BlockKey) int {
+	aNum, _ := strconv.ParseInt(string(a), 10, 64)
+	bNum, _ := strconv.ParseInt(string(b), 10, 64)
+
+	switch {
+	case aNum < bNum:
+		return -1
+	case aNum > bNum:
+		return 1
+	default:
+		return 0
+	}
+}
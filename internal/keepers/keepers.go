@@ -2,6 +2,8 @@ package keepers
 
 import (
 	"log"
+	"sync"
+	"sync/atomic"
 
 	"github.com/smartcontractkit/libocr/commontypes"
 
@@ -9,11 +11,32 @@ import (
 )
 
 type keepers struct {
-	id                commontypes.OracleID
-	service           upkeepService
-	encoder           types.ReportEncoder
-	logger            *log.Logger
-	filter            filterer
-	reportGasLimit    uint32
-	upkeepGasOverhead uint32
+	id       commontypes.OracleID
+	service  upkeepService
+	encoder  types.ReportEncoder
+	registry types.Registry
+	logger   *log.Logger
+	filter   filterer
+	packer   ReportPacker
+	// observationQuorum is the min number of distinct oracles that must
+	// observe an upkeep id for it to be considered in a report. a value of 1
+	// or less disables the quorum.
+	observationQuorum int
+	// shortOfQuorum counts keys filtered from reports by the quorum
+	shortOfQuorum atomic.Uint64
+	// truncator selects the eligible keys kept in observations that exceed
+	// the max observation length
+	truncator observationTruncator
+	// droppedFromObservations counts eligible keys dropped from observations
+	// by the max observation length
+	droppedFromObservations atomic.Uint64
+	// reportMode selects whether reports are built from observed result
+	// digests or by checking all observed upkeeps again
+	reportMode types.ReportMode
+	// adaptiveRatio measures the rounds per block to adjust the sample ratio.
+	// nil when the sample ratio is static.
+	adaptiveRatio *adaptiveSampleRatio
+	closer        sync.Once
+	// onClose is called once the plugin is closed
+	onClose func()
 }
@@ -2,14 +2,12 @@ package keepers
 
 import (
 	"context"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/smartcontractkit/libocr/offchainreporting2/types"
 	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
-	"golang.org/x/crypto/sha3"
 )
 
 type ocrLogContextKey struct{}
@@ -36,80 +34,196 @@ func (c ocrLogContext) Short() string {
 	return fmt.Sprintf("[epoch=%d, round=%d]", c.Epoch, c.Round)
 }
 
-// Query implements the types.ReportingPlugin interface in OCR2. The query produced from this
-// method is intended to be empty.
-func (k *keepers) Query(_ context.Context, _ types.ReportTimestamp) (types.Query, error) {
-	return types.Query{}, nil
+// Query implements the types.ReportingPlugin interface in OCR2. The leader
+// proposes the block of its latest sampling job such that all followers
+// observe and report against the same block. The query is empty if the leader
+// has not completed a sampling job.
+func (k *keepers) Query(_ context.Context, rt types.ReportTimestamp) (types.Query, error) {
+	lCtx := newOcrLogContext(rt)
+
+	block, ok := k.service.LatestSampledBlock()
+	if !ok {
+		k.logger.Printf("OCR query completed with no block to propose: %s", lCtx)
+		return types.Query{}, nil
+	}
+
+	b, err := encodeQuery(ocrQuery{Block: block})
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to encode query: %s", err, lCtx)
+	}
+
+	k.logger.Printf("OCR query completed successfully proposing block %s: %s", block, lCtx)
+
+	return b, nil
 }
 
 // Observation implements the types.ReportingPlugin interface in OCR2. This method samples a set
 // of upkeeps available in and UpkeepService and produces an observation containing upkeeps that
 // need to be executed.
-func (k *keepers) Observation(ctx context.Context, rt types.ReportTimestamp, _ types.Query) (types.Observation, error) {
+func (k *keepers) Observation(ctx context.Context, rt types.ReportTimestamp, query types.Query) (types.Observation, error) {
 	lCtx := newOcrLogContext(rt)
 	ctx = context.WithValue(ctx, ocrLogContextKey{}, lCtx)
 
-	results, err := k.service.SampleUpkeeps(ctx, k.filter.Filter())
+	if k.adaptiveRatio != nil {
+		k.adaptiveRatio.ObserveRound()
+	}
+
+	q, err := decodeQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode query: %s", err, lCtx)
+	}
+
+	// a node can only observe at the proposed block if it sampled that block.
+	// nodes with lagging RPCs will not yet have the proposed block and should
+	// not observe keys from an older block.
+	if len(q.Block) > 0 && !k.service.HasSampledBlock(q.Block) {
+		k.logger.Printf("proposed block %s has not been sampled by this node; observing no keys: %s", q.Block, lCtx)
+		b, _, err := limitedLengthEncode([]ktypes.UpkeepKey{}, maxObservationLength, k.registry)
+		return b, err
+	}
+
+	results, err := k.service.SampleUpkeeps(ctx, q.Block, k.filter.Filter())
 	if err != nil {
 		return nil, fmt.Errorf("%w: failed to sample upkeeps for observation: %s", err, lCtx)
 	}
 
-	// keyList produces a sorted result so the following reduction of keys
-	// should be more uniform for all nodes
-	keys := keyList(filterUpkeeps(results, ktypes.Eligible))
+	// the truncator orders eligible results such that the keys kept when
+	// the observation is truncated are selected by the configured policy
+	eligible := k.truncator.Order(rt, filterUpkeeps(results, ktypes.Eligible))
+
+	var (
+		b    []byte
+		kept int
+	)
+
+	if k.reportMode == ktypes.ReportModeObservedDigests {
+		b, kept, err = limitedLengthEncodeResults(eligible, maxObservationLength, k.registry)
+	} else {
+		keys := make([]ktypes.UpkeepKey, len(eligible))
+		for i, result := range eligible {
+			keys[i] = result.Key
+		}
+
+		b, kept, err = limitedLengthEncode(keys, maxObservationLength, k.registry)
+	}
 
-	b, err := limitedLengthEncode(keys, maxObservationLength)
 	if err != nil {
 		return nil, fmt.Errorf("%w: failed to encode upkeep keys for observation: %s", err, lCtx)
 	}
 
+	k.truncator.Observed(eligible[:kept])
+
+	if dropped := len(eligible) - kept; dropped > 0 {
+		total := k.droppedFromObservations.Add(uint64(dropped))
+		k.logger.Printf("%d of %d eligible keys dropped from observation by the length limit; %d total since plugin start: %s", dropped, len(eligible), total, lCtx)
+	}
+
 	// write the number of keys returned from sampling to the debug log
 	// this offers a record of the number of performs the node has visibility
 	// of for each epoch/round
-	k.logger.Printf("OCR observation completed successfully with %d eligible keys: %s", len(keys), lCtx)
+	k.logger.Printf("OCR observation completed successfully with %d eligible keys: %s", len(eligible), lCtx)
 
 	return b, nil
 }
 
-// Report implements the types.ReportingPlugin interface in OC2. This method chooses a single upkeep
-// from the provided observations by the earliest block number, checks the upkeep, and builds a
-// report. Multiple upkeeps in a single report is supported by how the data is abi encoded, but
+// Report implements the types.ReportingPlugin interface in OC2. This method chooses a single key
+// per upkeep from the provided observations by the latest block number among keys observed by the
+// observation quorum, or only keys at the block proposed in the query, checks the upkeeps, and
+// builds a report that includes each upkeep at most once. Multiple upkeeps in a single report is supported by how the data is abi encoded, but
 // no gas estimations exist yet.
-func (k *keepers) Report(ctx context.Context, rt types.ReportTimestamp, _ types.Query, attributed []types.AttributedObservation) (bool, types.Report, error) {
+func (k *keepers) Report(ctx context.Context, rt types.ReportTimestamp, query types.Query, attributed []types.AttributedObservation) (bool, types.Report, error) {
 	var err error
 
 	lCtx := newOcrLogContext(rt)
 	ctx = context.WithValue(ctx, ocrLogContextKey{}, lCtx)
 
-	// similar key building as libocr transmit selector
-	hash := sha3.NewLegacyKeccak256()
-	hash.Write(rt.ConfigDigest[:])
-	temp := make([]byte, 8)
-	binary.LittleEndian.PutUint64(temp, uint64(rt.Epoch))
-	hash.Write(temp)
-	binary.LittleEndian.PutUint64(temp, uint64(rt.Round))
-	hash.Write(temp)
+	q, err := decodeQuery(query)
+	if err != nil {
+		return false, nil, fmt.Errorf("%w: failed to decode query: %s", err, lCtx)
+	}
 
-	var key [16]byte
-	copy(key[:], hash.Sum(nil))
+	key := roundKey(rt)
 
 	// pass the filter to the dedupe function
 	// ensure no locked keys come through
-	keys, err := shuffledDedupedKeyList(attributed, key, k.filter.Filter())
+	filters := []func(ktypes.UpkeepKey) bool{k.filter.Filter()}
+
+	// when the leader proposed a block, only keys at that block are checked
+	// such that a faulty oracle cannot introduce keys at other blocks
+	if len(q.Block) > 0 {
+		filters = append(filters, atBlock(q.Block, k.registry))
+	}
+
+	// only consider upkeep ids that were observed by a quorum of oracles
+	var quorum *observationQuorum
+	if k.observationQuorum > 1 {
+		quorum, err = newObservationQuorum(attributed, k.observationQuorum, k.registry)
+		if err != nil {
+			return false, nil, fmt.Errorf("%w: failed to count observers: %s", err, lCtx)
+		}
+
+		filters = append(filters, quorum.Filter())
+	}
+
+	keys, err := shuffledDedupedKeyList(attributed, key, k.registry, filters...)
 	if err != nil {
 		return false, nil, fmt.Errorf("%w: failed to sort/dedupe attributed observations: %s", err, lCtx)
 	}
 
+	// the latest block of an upkeep is chosen only from keys observed by a
+	// quorum of oracles
+	if quorum != nil {
+		agreed := make([]ktypes.UpkeepKey, 0, len(keys))
+		for _, key := range keys {
+			if quorum.KeyObserved(key) {
+				agreed = append(agreed, key)
+			}
+		}
+
+		if len(agreed) < len(keys) {
+			k.logger.Printf("%d keys observed at blocks short of observation quorum are not checked: %s", len(keys)-len(agreed), lCtx.Short())
+			keys = agreed
+		}
+	}
+
+	// nodes observe upkeeps at different blocks; only the key at the latest
+	// block is checked for each upkeep id
+	if latest := latestByID(keys, upkeepKey, k.registry); len(latest) < len(keys) {
+		k.logger.Printf("%d keys observed for upkeeps at earlier blocks are not checked: %s", len(keys)-len(latest), lCtx.Short())
+		keys = latest
+	}
+
+	if quorum != nil {
+		short := quorum.ShortOfQuorum()
+		for shortKey, count := range short {
+			k.logger.Printf("key %s observed by %d oracles is short of observation quorum %d: %s", shortKey, count, k.observationQuorum, lCtx.Short())
+		}
+
+		if len(short) > 0 {
+			total := k.shortOfQuorum.Add(uint64(len(short)))
+			k.logger.Printf("%d keys short of observation quorum; %d total since plugin start: %s", len(short), total, lCtx)
+		}
+	}
+
 	// No keys found for the given keys
 	if len(keys) == 0 {
 		k.logger.Printf("OCR report completed successfully with no eligible keys: %s", lCtx)
 		return false, nil, nil
 	}
 
-	// Check all upkeeps from the given observation
-	checkedUpkeeps, err := k.service.CheckUpkeep(ctx, keys...)
-	if err != nil {
-		return false, nil, fmt.Errorf("%w: failed to check upkeeps from attributed observation: %s", err, lCtx)
+	var checkedUpkeeps ktypes.UpkeepResults
+	if k.reportMode == ktypes.ReportModeObservedDigests {
+		// Use results agreed on in observations
+		checkedUpkeeps, err = k.resultsFromObservedDigests(ctx, attributed, keys, lCtx)
+		if err != nil {
+			return false, nil, fmt.Errorf("%w: failed to collect upkeep results from attributed observation: %s", err, lCtx)
+		}
+	} else {
+		// Check all upkeeps from the given observation
+		checkedUpkeeps, err = k.service.CheckUpkeep(ctx, keys...)
+		if err != nil {
+			return false, nil, fmt.Errorf("%w: failed to check upkeeps from attributed observation: %s", err, lCtx)
+		}
 	}
 
 	// No upkeeps found for the given keys
@@ -122,26 +236,39 @@ func (k *keepers) Report(ctx context.Context, rt types.ReportTimestamp, _ types.
 		return false, nil, fmt.Errorf("unexpected number of upkeeps returned for %s key, expected max %d but given %d", key, len(keys), len(checkedUpkeeps))
 	}
 
-	// Collect eligible upkeeps
-	var reportCapacity uint32
-	toPerform := make([]ktypes.UpkeepResult, 0, len(checkedUpkeeps))
-	for _, checkedUpkeep := range checkedUpkeeps {
-		if checkedUpkeep.State != ktypes.Eligible {
-			continue
+	// Pack eligible upkeeps into a report within the report limits. An upkeep
+	// id is included at most once in a report.
+	eligible := latestByID(filterUpkeeps(checkedUpkeeps, ktypes.Eligible), resultKey, k.registry)
+
+	// results checked too long before the latest check block are not
+	// reported such that the encoder is never given stale results
+	if window, ok := k.encoder.(ktypes.CheckBlockWindow); ok {
+		recent, err := withinCheckBlockWindow(eligible, window, k.registry)
+		if err != nil {
+			return false, nil, fmt.Errorf("%w: failed to apply check block window: %s", err, lCtx)
 		}
 
-		upkeepMaxGas := checkedUpkeep.ExecuteGas + k.upkeepGasOverhead
-		if reportCapacity+upkeepMaxGas > k.reportGasLimit {
-			// We don't break here since there could be an upkeep with the lower
-			// gas limit so there could be a space for it in the report.
-			k.logger.Printf("skipping upkeep %s due to report limit, current capacity is %d, upkeep gas is %d with %d overhead", checkedUpkeep.Key, reportCapacity, checkedUpkeep.ExecuteGas, k.upkeepGasOverhead)
-			continue
+		if dropped := len(eligible) - len(recent); dropped > 0 {
+			k.logger.Printf("%d eligible upkeeps checked before the check block window are not reported: %s", dropped, lCtx.Short())
+			eligible = recent
 		}
+	}
 
-		k.logger.Printf("reporting %s to be performed with gas limit %d and %d overhead: %s", checkedUpkeep.Key, checkedUpkeep.ExecuteGas, k.upkeepGasOverhead, lCtx.Short())
+	toPerform, b, err := k.packer.Pack(eligible)
+	if err != nil {
+		return false, nil, fmt.Errorf("%w: failed to encode OCR report: %s", err, lCtx)
+	}
 
-		toPerform = append(toPerform, checkedUpkeep)
-		reportCapacity += upkeepMaxGas
+	packed := make(map[string]struct{}, len(toPerform))
+	for _, upkeep := range toPerform {
+		packed[string(upkeep.Key)] = struct{}{}
+		k.logger.Printf("reporting %s to be performed with gas limit %d: %s", upkeep.Key, upkeep.ExecuteGas, lCtx.Short())
+	}
+
+	for _, upkeep := range eligible {
+		if _, ok := packed[string(upkeep.Key)]; !ok {
+			k.logger.Printf("skipping upkeep %s with gas limit %d due to report limits: %s", upkeep.Key, upkeep.ExecuteGas, lCtx.Short())
+		}
 	}
 
 	// if nothing to report, return false with no error
@@ -150,14 +277,68 @@ func (k *keepers) Report(ctx context.Context, rt types.ReportTimestamp, _ types.
 		return false, nil, nil
 	}
 
-	b, err := k.encoder.EncodeReport(toPerform)
+	k.logger.Printf("OCR report completed successfully with %d upkeep added to the report at proposed block '%s': %s", len(toPerform), q.Block, lCtx)
+
+	return true, b, err
+}
+
+// resultsFromObservedDigests returns check results for the provided keys where
+// the result digest was agreed on by the observation quorum. Results are taken
+// from the cache where available and only uncached keys are checked again.
+// Results that do not match the agreed digest are dropped. The order of the
+// provided keys is retained.
+func (k *keepers) resultsFromObservedDigests(ctx context.Context, attributed []types.AttributedObservation, keys []ktypes.UpkeepKey, lCtx ocrLogContext) (ktypes.UpkeepResults, error) {
+	threshold := k.observationQuorum
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	agreed, err := agreedResultDigests(attributed, threshold, k.registry)
 	if err != nil {
-		return false, nil, fmt.Errorf("%w: failed to encode OCR report: %s", err, lCtx)
+		return nil, err
 	}
 
-	k.logger.Printf("OCR report completed successfully with %d upkeep added to the report: %s", len(toPerform), lCtx)
+	withDigest := make([]ktypes.UpkeepKey, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := agreed[string(key)]; !ok {
+			k.logger.Printf("no result digest agreed on for key %s: %s", key, lCtx.Short())
+			continue
+		}
 
-	return true, b, err
+		withDigest = append(withDigest, key)
+	}
+
+	results, missed := k.service.CachedUpkeep(withDigest...)
+	if len(missed) > 0 {
+		k.logger.Printf("%d of %d keys with agreed result digests not cached; checking again: %s", len(missed), len(withDigest), lCtx.Short())
+
+		checked, err := k.service.CheckUpkeep(ctx, missed...)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, checked...)
+	}
+
+	byKey := make(map[string]ktypes.UpkeepResult, len(results))
+	for _, result := range results {
+		digest, ok := agreed[string(result.Key)]
+		if !ok || resultDigest(result) != digest {
+			k.logger.Printf("result for key %s does not match agreed digest: %s", result.Key, lCtx.Short())
+			continue
+		}
+
+		byKey[string(result.Key)] = result
+	}
+
+	matched := make(ktypes.UpkeepResults, 0, len(byKey))
+	for _, key := range withDigest {
+		if result, ok := byKey[string(key)]; ok {
+			matched = append(matched, result)
+		}
+	}
+
+	return matched, nil
 }
 
 // ShouldAcceptFinalizedReport implements the types.ReportingPlugin interface
@@ -231,7 +412,29 @@ func (k *keepers) ShouldTransmitAcceptedReport(_ context.Context, rt types.Repor
 	return true, nil
 }
 
-// Close implements the types.ReportingPlugin interface in OCR2.
+// Close implements the types.ReportingPlugin interface in OCR2. The upkeep
+// service is stopped and Close returns once its go-routines have exited. OCR
+// closes a plugin when it is replaced after a config change. The report
+// coordinator is owned by the factory and carries transmit lockouts over to
+// the next plugin instance. Calling Close more than once has no effect.
 func (k *keepers) Close() error {
-	return nil
+	var err error
+
+	k.closer.Do(func() {
+		err = k.service.Close()
+
+		if k.onClose != nil {
+			k.onClose()
+		}
+
+		k.logger.Printf("plugin instance for oracle %d closed", k.id)
+	})
+
+	return err
+}
+
+// Healthy returns an error naming the background processes of the upkeep
+// service that failed and are waiting to be restarted
+func (k *keepers) Healthy() error {
+	return k.service.Healthy()
 }
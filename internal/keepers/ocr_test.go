@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,18 +19,47 @@ import (
 )
 
 func TestQuery(t *testing.T) {
-	plugin := &keepers{
-		logger: log.New(io.Discard, "", 0),
-	}
-	b, err := plugin.Query(context.Background(), types.ReportTimestamp{})
+	t.Run("No Sampled Block", func(t *testing.T) {
+		ms := new(MockedUpkeepService)
+		plugin := &keepers{
+			service: ms,
+			logger:  log.New(io.Discard, "", 0),
+		}
 
-	assert.NoError(t, err)
-	assert.Equal(t, types.Query{}, b)
+		ms.Mock.On("LatestSampledBlock").Return(ktypes.BlockKey(""), false)
+
+		b, err := plugin.Query(context.Background(), types.ReportTimestamp{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, types.Query{}, b)
+		ms.Mock.AssertExpectations(t)
+	})
+
+	t.Run("Propose Latest Sampled Block", func(t *testing.T) {
+		ms := new(MockedUpkeepService)
+		plugin := &keepers{
+			service: ms,
+			logger:  log.New(io.Discard, "", 0),
+		}
+
+		ms.Mock.On("LatestSampledBlock").Return(ktypes.BlockKey("42"), true)
+
+		b, err := plugin.Query(context.Background(), types.ReportTimestamp{})
+
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(b), maxQueryLength)
+
+		q, err := decodeQuery(b)
+		assert.NoError(t, err)
+		assert.Equal(t, ktypes.BlockKey("42"), q.Block)
+		ms.Mock.AssertExpectations(t)
+	})
 }
 
 func BenchmarkQuery(b *testing.B) {
 	plugin := &keepers{
-		logger: log.New(io.Discard, "", 0),
+		service: &BenchmarkMockUpkeepService{},
+		logger:  log.New(io.Discard, "", 0),
 	}
 
 	// run the Query function b.N times
@@ -43,6 +75,8 @@ func TestObservation(t *testing.T) {
 	tests := []struct {
 		Name                string
 		Ctx                 func() (context.Context, func())
+		Query               types.Query
+		NotSampled          bool
 		SampleSet           ktypes.UpkeepResults
 		SampleErr           error
 		ExpectedObservation types.Observation
@@ -68,6 +102,29 @@ func TestObservation(t *testing.T) {
 			ExpectedObservation: nil,
 			ExpectedErr:         fmt.Errorf("test error: failed to sample upkeeps for observation"),
 		},
+		{
+			Name:                "Invalid Query",
+			Ctx:                 func() (context.Context, func()) { return context.Background(), func() {} },
+			Query:               types.Query([]byte{0xff, '1'}),
+			ExpectedObservation: nil,
+			ExpectedErr:         ErrInvalidQuery,
+		},
+		{
+			Name:                "Proposed Block Not Sampled",
+			Ctx:                 func() (context.Context, func()) { return context.Background(), func() {} },
+			Query:               types.Query(mustEncodeQuery(ocrQuery{Block: ktypes.BlockKey("2")})),
+			NotSampled:          true,
+			ExpectedObservation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{})),
+		},
+		{
+			Name:  "Proposed Block Sampled",
+			Ctx:   func() (context.Context, func()) { return context.Background(), func() {} },
+			Query: types.Query(mustEncodeQuery(ocrQuery{Block: ktypes.BlockKey("1")})),
+			SampleSet: ktypes.UpkeepResults{
+				{Key: ktypes.UpkeepKey([]byte("1|1")), State: ktypes.Eligible},
+			},
+			ExpectedObservation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{[]byte("1|1")})),
+		},
 		{
 			Name: "Filter to Empty Set",
 			Ctx:  func() (context.Context, func()) { return context.Background(), func() {} },
@@ -87,29 +144,10 @@ func TestObservation(t *testing.T) {
 			ExpectedObservation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{[]byte("1|2")})),
 		},
 		{
-			Name: "Reduce Key List to Observation Limit",
-			Ctx:  func() (context.Context, func()) { return context.Background(), func() {} },
-			SampleSet: ktypes.UpkeepResults{
-				{Key: ktypes.UpkeepKey([]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000001")), State: ktypes.Eligible},
-				{Key: ktypes.UpkeepKey([]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000002")), State: ktypes.Eligible},
-				{Key: ktypes.UpkeepKey([]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000003")), State: ktypes.Eligible},
-				{Key: ktypes.UpkeepKey([]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000004")), State: ktypes.Eligible},
-				{Key: ktypes.UpkeepKey([]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000005")), State: ktypes.Eligible},
-				{Key: ktypes.UpkeepKey([]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000006")), State: ktypes.Eligible},
-				{Key: ktypes.UpkeepKey([]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000007")), State: ktypes.Eligible},
-				{Key: ktypes.UpkeepKey([]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000008")), State: ktypes.Eligible},
-				{Key: ktypes.UpkeepKey([]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000009")), State: ktypes.Eligible},
-				{Key: ktypes.UpkeepKey([]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000010")), State: ktypes.Eligible},
-				{Key: ktypes.UpkeepKey([]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000011")), State: ktypes.Eligible},
-			},
-			ExpectedObservation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{
-				[]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000001"),
-				[]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000002"),
-				[]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000003"),
-				[]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000004"),
-				[]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000005"),
-				[]byte("100000000000100000000000100000000000100000000000100000000001|100000000000100000000000100000000000100000000006"),
-			})),
+			Name:                "Reduce Key List to Observation Limit",
+			Ctx:                 func() (context.Context, func()) { return context.Background(), func() {} },
+			SampleSet:           eligibleResults(makeLongKeys(20)),
+			ExpectedObservation: types.Observation(mustEncodeKeys(makeLongKeys(20)[:8])),
 		},
 	}
 
@@ -118,20 +156,31 @@ func TestObservation(t *testing.T) {
 			ms := new(MockedUpkeepService)
 			mf := new(MockedFilterer)
 
+			registry := newTestKeyRegistry(t)
 			plugin := &keepers{
-				service: ms,
-				logger:  log.New(io.Discard, "", 0),
-				filter:  mf,
+				service:   ms,
+				registry:  registry,
+				logger:    log.New(io.Discard, "", 0),
+				filter:    mf,
+				truncator: &sortedTruncator{registry: registry},
 			}
 
-			mf.Mock.On("Filter").Return(func(k ktypes.UpkeepKey) bool {
-				return true
-			})
+			q, qErr := decodeQuery(test.Query)
+			if qErr == nil {
+				if len(q.Block) > 0 {
+					ms.Mock.On("HasSampledBlock", q.Block).Return(!test.NotSampled)
+				}
 
-			ctx, cancel := test.Ctx()
-			ms.Mock.On("SampleUpkeeps", mock.Anything).Return(test.SampleSet, test.SampleErr)
+				if !test.NotSampled {
+					mf.Mock.On("Filter").Return(func(k ktypes.UpkeepKey) bool {
+						return true
+					})
+					ms.Mock.On("SampleUpkeeps", mock.Anything, q.Block).Return(test.SampleSet, test.SampleErr)
+				}
+			}
 
-			b, err := plugin.Observation(ctx, types.ReportTimestamp{}, types.Query{})
+			ctx, cancel := test.Ctx()
+			b, err := plugin.Observation(ctx, types.ReportTimestamp{}, test.Query)
 			cancel()
 
 			if test.ExpectedErr == nil {
@@ -153,10 +202,13 @@ func BenchmarkObservation(b *testing.B) {
 	ms := new(MockedUpkeepService)
 	mf := &BenchmarkMockedFilterer{}
 
+	registry := newTestKeyRegistry(b)
 	plugin := &keepers{
-		service: ms,
-		logger:  log.New(io.Discard, "", 0),
-		filter:  mf,
+		service:   ms,
+		registry:  registry,
+		logger:    log.New(io.Discard, "", 0),
+		filter:    mf,
+		truncator: &sortedTruncator{registry: registry},
 	}
 
 	set := make(ktypes.UpkeepResults, 2, 100)
@@ -171,7 +223,7 @@ func BenchmarkObservation(b *testing.B) {
 	// run the Observation function b.N times
 	for n := 0; n < b.N; n++ {
 		ctx := context.Background()
-		ms.Mock.On("SampleUpkeeps", mock.Anything).Return(set, nil)
+		ms.Mock.On("SampleUpkeeps", mock.Anything, mock.Anything).Return(set, nil)
 
 		b.StartTimer()
 		_, err := plugin.Observation(ctx, types.ReportTimestamp{}, types.Query{})
@@ -396,11 +448,12 @@ func TestReport(t *testing.T) {
 			mf := new(MockedFilterer)
 
 			plugin := &keepers{
-				service:        ms,
-				encoder:        me,
-				logger:         log.New(io.Discard, "", 0),
-				filter:         mf,
-				reportGasLimit: test.ReportGasLimit,
+				service:  ms,
+				encoder:  me,
+				registry: newTestKeyRegistry(t),
+				logger:   log.New(io.Discard, "", 0),
+				filter:   mf,
+				packer:   &greedyPacker{limits: reportLimits{encoder: me, gasLimit: test.ReportGasLimit, maxLength: maxReportLength}},
 			}
 			ctx, cancel := test.Ctx()
 
@@ -448,16 +501,265 @@ func TestReport(t *testing.T) {
 	}
 }
 
+func TestReport_ObservationQuorum(t *testing.T) {
+	ms := new(MockedUpkeepService)
+	me := ktypes.NewMockReportEncoder(t)
+	mf := new(MockedFilterer)
+	plugin := &keepers{
+		service:           ms,
+		encoder:           me,
+		registry:          newTestKeyRegistry(t),
+		logger:            log.New(io.Discard, "", 0),
+		filter:            mf,
+		packer:            &greedyPacker{limits: reportLimits{encoder: me, gasLimit: 10000000, maxLength: maxReportLength}},
+		observationQuorum: 2,
+	}
+
+	mf.Mock.On("Filter").Return(func(k ktypes.UpkeepKey) bool { return true })
+
+	observations := []types.AttributedObservation{
+		{Observer: 0, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("1|1"), ktypes.UpkeepKey("1|2")}))},
+		{Observer: 1, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("1|1")}))},
+		{Observer: 2, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{}))},
+	}
+
+	// only 1|1 was observed by 2 oracles
+	result := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("1|1"), State: ktypes.Eligible, PerformData: []byte("abcd")}
+	ms.Mock.On("CheckUpkeep", mock.Anything, []ktypes.UpkeepKey{ktypes.UpkeepKey("1|1")}).Return(ktypes.UpkeepResults{result}, nil)
+	me.Mock.On("EncodeReport", []ktypes.UpkeepResult{result}).Return([]byte("report"), nil)
+
+	ok, r, err := plugin.Report(context.Background(), types.ReportTimestamp{}, types.Query{}, observations)
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, types.Report("report"), r)
+	assert.Equal(t, uint64(1), plugin.shortOfQuorum.Load())
+
+	ms.Mock.AssertExpectations(t)
+}
+
+func TestReport_ByzantineLatestBlock(t *testing.T) {
+	ms := new(MockedUpkeepService)
+	me := ktypes.NewMockReportEncoder(t)
+	mf := new(MockedFilterer)
+	plugin := &keepers{
+		service:           ms,
+		encoder:           me,
+		registry:          newTestKeyRegistry(t),
+		logger:            log.New(io.Discard, "", 0),
+		filter:            mf,
+		packer:            &greedyPacker{limits: reportLimits{encoder: me, gasLimit: 10000000, maxLength: maxReportLength}},
+		observationQuorum: 2,
+	}
+
+	mf.Mock.On("Filter").Return(func(k ktypes.UpkeepKey) bool { return true })
+
+	// a single faulty oracle observes upkeep 5 at a block no other oracle
+	// observed
+	observations := []types.AttributedObservation{
+		{Observer: 0, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("100|5")}))},
+		{Observer: 1, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("100|5")}))},
+		{Observer: 2, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("100|5")}))},
+		{Observer: 3, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("999|5")}))},
+	}
+
+	// the key agreed by a quorum is checked instead of the latest key
+	result := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("100|5"), State: ktypes.Eligible, PerformData: []byte("abcd")}
+	ms.Mock.On("CheckUpkeep", mock.Anything, []ktypes.UpkeepKey{ktypes.UpkeepKey("100|5")}).Return(ktypes.UpkeepResults{result}, nil)
+	me.Mock.On("EncodeReport", []ktypes.UpkeepResult{result}).Return([]byte("report"), nil)
+
+	ok, r, err := plugin.Report(context.Background(), types.ReportTimestamp{}, types.Query{}, observations)
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, types.Report("report"), r)
+
+	ms.Mock.AssertExpectations(t)
+}
+
+func TestReport_ProposedBlock(t *testing.T) {
+	ms := new(MockedUpkeepService)
+	me := ktypes.NewMockReportEncoder(t)
+	mf := new(MockedFilterer)
+	plugin := &keepers{
+		service:  ms,
+		encoder:  me,
+		registry: newTestKeyRegistry(t),
+		logger:   log.New(io.Discard, "", 0),
+		filter:   mf,
+		packer:   &greedyPacker{limits: reportLimits{encoder: me, gasLimit: 10000000, maxLength: maxReportLength}},
+	}
+
+	mf.Mock.On("Filter").Return(func(k ktypes.UpkeepKey) bool { return true })
+
+	// an oracle observes keys at blocks other than the proposed block
+	observations := []types.AttributedObservation{
+		{Observer: 0, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("100|5"), ktypes.UpkeepKey("100|6")}))},
+		{Observer: 1, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("999|5"), ktypes.UpkeepKey("99|7")}))},
+	}
+
+	// only keys at the proposed block are checked
+	result := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("100|5"), State: ktypes.Eligible, PerformData: []byte("abcd")}
+	ms.Mock.On("CheckUpkeep", mock.Anything, mock.MatchedBy(func(keys []ktypes.UpkeepKey) bool {
+		return assert.ElementsMatch(t, []ktypes.UpkeepKey{ktypes.UpkeepKey("100|5"), ktypes.UpkeepKey("100|6")}, keys)
+	})).Return(ktypes.UpkeepResults{result}, nil)
+	me.Mock.On("EncodeReport", []ktypes.UpkeepResult{result}).Return([]byte("report"), nil)
+
+	q := mustEncodeQuery(ocrQuery{Block: ktypes.BlockKey("100")})
+	ok, r, err := plugin.Report(context.Background(), types.ReportTimestamp{}, types.Query(q), observations)
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, types.Report("report"), r)
+
+	ms.Mock.AssertExpectations(t)
+}
+
+func TestReport_CheckBlockWindow(t *testing.T) {
+	ms := new(MockedUpkeepService)
+	me := windowedReportEncoder{MockReportEncoder: ktypes.NewMockReportEncoder(t), blocks: 5}
+	mf := new(MockedFilterer)
+	plugin := &keepers{
+		service:  ms,
+		encoder:  me,
+		registry: newTestKeyRegistry(t),
+		logger:   log.New(io.Discard, "", 0),
+		filter:   mf,
+		packer:   &greedyPacker{limits: reportLimits{encoder: me, gasLimit: 10000000, maxLength: maxReportLength}},
+	}
+
+	mf.Mock.On("Filter").Return(func(k ktypes.UpkeepKey) bool { return true })
+
+	keys := []ktypes.UpkeepKey{ktypes.UpkeepKey("100|1"), ktypes.UpkeepKey("90|2"), ktypes.UpkeepKey("99|3")}
+	observations := []types.AttributedObservation{
+		{Observer: 0, Observation: types.Observation(mustEncodeKeys(keys))},
+	}
+
+	ms.Mock.On("CheckUpkeep", mock.Anything, mock.Anything).Return(eligibleResults(keys), nil)
+
+	// the result checked before the window is not given to the encoder
+	var encoded []ktypes.UpkeepResult
+	me.Mock.On("EncodeReport", mock.Anything).
+		Run(func(args mock.Arguments) {
+			encoded = args.Get(0).([]ktypes.UpkeepResult)
+		}).Return([]byte("report"), nil)
+
+	ok, r, err := plugin.Report(context.Background(), types.ReportTimestamp{}, types.Query{}, observations)
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, types.Report("report"), r)
+	assert.ElementsMatch(t, eligibleResults([]ktypes.UpkeepKey{ktypes.UpkeepKey("100|1"), ktypes.UpkeepKey("99|3")}), encoded)
+}
+
+func TestReport_ObservedDigests(t *testing.T) {
+	ms := new(MockedUpkeepService)
+	me := ktypes.NewMockReportEncoder(t)
+	mf := new(MockedFilterer)
+	plugin := &keepers{
+		service:           ms,
+		encoder:           me,
+		registry:          newTestKeyRegistry(t),
+		logger:            log.New(io.Discard, "", 0),
+		filter:            mf,
+		packer:            &greedyPacker{limits: reportLimits{encoder: me, gasLimit: 10000000, maxLength: maxReportLength}},
+		observationQuorum: 2,
+		reportMode:        ktypes.ReportModeObservedDigests,
+	}
+
+	mf.Mock.On("Filter").Return(func(k ktypes.UpkeepKey) bool { return true })
+
+	r1 := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("1|1"), State: ktypes.Eligible, PerformData: []byte("abcd")}
+	r2 := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("1|2"), State: ktypes.Eligible, PerformData: []byte("abcd")}
+	r3 := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("1|3"), State: ktypes.Eligible, PerformData: []byte("abcd")}
+	r3b := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("1|3"), State: ktypes.Eligible, PerformData: []byte("efgh")}
+
+	observations := []types.AttributedObservation{
+		{Observer: 0, Observation: types.Observation(mustEncodeResults(ktypes.UpkeepResults{r1, r2, r3}))},
+		{Observer: 1, Observation: types.Observation(mustEncodeResults(ktypes.UpkeepResults{r1, r3}))},
+		{Observer: 2, Observation: types.Observation(mustEncodeResults(ktypes.UpkeepResults{r2}))},
+	}
+
+	// all keys are agreed on; 1|3 is not cached and the recheck returns a
+	// different result
+	ms.Mock.On("CachedUpkeep", mock.Anything).Return(ktypes.UpkeepResults{r1, r2}, []ktypes.UpkeepKey{r3.Key})
+	ms.Mock.On("CheckUpkeep", mock.Anything, []ktypes.UpkeepKey{r3.Key}).Return(ktypes.UpkeepResults{r3b}, nil)
+	me.Mock.On("EncodeReport", mock.Anything).Return(func(results []ktypes.UpkeepResult) []byte {
+		assert.Len(t, results, 2)
+		assert.Contains(t, results, r1)
+		assert.Contains(t, results, r2)
+		return []byte("report")
+	}, nil)
+
+	ok, r, err := plugin.Report(context.Background(), types.ReportTimestamp{}, types.Query{}, observations)
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, types.Report("report"), r)
+
+	ms.Mock.AssertExpectations(t)
+}
+
+func TestReport_LatestKeyPerUpkeep(t *testing.T) {
+	ms := new(MockedUpkeepService)
+	me := ktypes.NewMockReportEncoder(t)
+	mf := new(MockedFilterer)
+
+	plugin := &keepers{
+		service:  ms,
+		encoder:  me,
+		registry: newTestKeyRegistry(t),
+		logger:   log.New(io.Discard, "", 0),
+		filter:   mf,
+		packer:   &greedyPacker{limits: reportLimits{encoder: me, gasLimit: 10000000, maxLength: maxReportLength}},
+	}
+
+	mf.Mock.On("Filter").Return(func(k ktypes.UpkeepKey) bool { return true })
+
+	// nodes observed upkeep 5 at different heads
+	observations := []types.AttributedObservation{
+		{Observer: 0, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("100|5"), ktypes.UpkeepKey("100|6")}))},
+		{Observer: 1, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("99|5")}))},
+		{Observer: 2, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("101|5")}))},
+	}
+
+	r5 := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("101|5"), State: ktypes.Eligible, PerformData: []byte("abcd")}
+	r6 := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("100|6"), State: ktypes.NotEligible}
+
+	// only the key at the latest block is checked for upkeep 5
+	checked := mock.MatchedBy(func(keys []ktypes.UpkeepKey) bool {
+		sort.Sort(sortUpkeepKeys(keys))
+		return assert.ObjectsAreEqual([]ktypes.UpkeepKey{r6.Key, r5.Key}, keys)
+	})
+
+	// a duplicate result for the same upkeep is not reported twice
+	ms.Mock.On("CheckUpkeep", mock.Anything, checked).Return(ktypes.UpkeepResults{r5, {Key: ktypes.UpkeepKey("100|5"), State: ktypes.Eligible, PerformData: []byte("abcd")}}, nil)
+	me.Mock.On("EncodeReport", mock.Anything).Return(func(results []ktypes.UpkeepResult) []byte {
+		assert.Equal(t, []ktypes.UpkeepResult{r5}, results)
+		return []byte("report")
+	}, nil)
+
+	ok, r, err := plugin.Report(context.Background(), types.ReportTimestamp{}, types.Query{}, observations)
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, types.Report("report"), r)
+
+	ms.Mock.AssertExpectations(t)
+}
+
 func BenchmarkReport(b *testing.B) {
 	ms := &BenchmarkMockUpkeepService{}
 	me := &BenchmarkMockedReportEncoder{}
 	mf := &BenchmarkMockedFilterer{}
 
 	plugin := &keepers{
-		service: ms,
-		encoder: me,
-		logger:  log.New(io.Discard, "", 0),
-		filter:  mf,
+		service:  ms,
+		encoder:  me,
+		registry: newTestKeyRegistry(b),
+		logger:   log.New(io.Discard, "", 0),
+		filter:   mf,
+		packer:   &greedyPacker{limits: reportLimits{encoder: me, maxLength: maxReportLength}},
 	}
 
 	key1 := ktypes.UpkeepKey([]byte("1|1"))
@@ -692,14 +994,14 @@ type MockedUpkeepService struct {
 	mock.Mock
 }
 
-func (_m *MockedUpkeepService) SampleUpkeeps(ctx context.Context, filters ...func(ktypes.UpkeepKey) bool) (ktypes.UpkeepResults, error) {
-	arguments := []interface{}{ctx}
+func (_m *MockedUpkeepService) SampleUpkeeps(ctx context.Context, block ktypes.BlockKey, filters ...func(ktypes.UpkeepKey) bool) (ktypes.UpkeepResults, error) {
+	arguments := []interface{}{ctx, block}
 	if len(filters) > 0 {
 		args := make([]interface{}, len(arguments)+len(filters))
-		args[0] = arguments[0]
+		copy(args, arguments)
 
 		for i, filter := range filters {
-			args[i+1] = filter
+			args[i+len(arguments)] = filter
 		}
 
 		copy(arguments, args)
@@ -719,6 +1021,15 @@ func (_m *MockedUpkeepService) SampleUpkeeps(ctx context.Context, filters ...fun
 	return r0, ret.Error(1)
 }
 
+func (_m *MockedUpkeepService) LatestSampledBlock() (ktypes.BlockKey, bool) {
+	ret := _m.Mock.Called()
+	return ret.Get(0).(ktypes.BlockKey), ret.Bool(1)
+}
+
+func (_m *MockedUpkeepService) HasSampledBlock(block ktypes.BlockKey) bool {
+	return _m.Mock.Called(block).Bool(0)
+}
+
 func (_m *MockedUpkeepService) CheckUpkeep(ctx context.Context, keys ...ktypes.UpkeepKey) (ktypes.UpkeepResults, error) {
 	ret := _m.Mock.Called(ctx, keys)
 
@@ -734,6 +1045,30 @@ func (_m *MockedUpkeepService) CheckUpkeep(ctx context.Context, keys ...ktypes.U
 	return r0, ret.Error(1)
 }
 
+func (_m *MockedUpkeepService) CachedUpkeep(keys ...ktypes.UpkeepKey) (ktypes.UpkeepResults, []ktypes.UpkeepKey) {
+	ret := _m.Mock.Called(keys)
+
+	var r0 ktypes.UpkeepResults
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(ktypes.UpkeepResults)
+	}
+
+	var r1 []ktypes.UpkeepKey
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).([]ktypes.UpkeepKey)
+	}
+
+	return r0, r1
+}
+
+func (_m *MockedUpkeepService) Close() error {
+	return _m.Mock.Called().Error(0)
+}
+
+func (_m *MockedUpkeepService) Healthy() error {
+	return _m.Mock.Called().Error(0)
+}
+
 func (_m *MockedUpkeepService) LockoutUpkeep(ctx context.Context, key ktypes.UpkeepIdentifier) error {
 	return _m.Mock.Called(ctx, key).Error(0)
 }
@@ -757,14 +1092,34 @@ type BenchmarkMockUpkeepService struct {
 	rtnCheck ktypes.UpkeepResults
 }
 
-func (_m *BenchmarkMockUpkeepService) SampleUpkeeps(ctx context.Context, filters ...func(ktypes.UpkeepKey) bool) (ktypes.UpkeepResults, error) {
+func (_m *BenchmarkMockUpkeepService) SampleUpkeeps(ctx context.Context, block ktypes.BlockKey, filters ...func(ktypes.UpkeepKey) bool) (ktypes.UpkeepResults, error) {
 	return nil, nil
 }
 
+func (_m *BenchmarkMockUpkeepService) LatestSampledBlock() (ktypes.BlockKey, bool) {
+	return ktypes.BlockKey("1"), true
+}
+
+func (_m *BenchmarkMockUpkeepService) HasSampledBlock(block ktypes.BlockKey) bool {
+	return true
+}
+
 func (_m *BenchmarkMockUpkeepService) CheckUpkeep(ctx context.Context, keys ...ktypes.UpkeepKey) (ktypes.UpkeepResults, error) {
 	return _m.rtnCheck, nil
 }
 
+func (_m *BenchmarkMockUpkeepService) CachedUpkeep(keys ...ktypes.UpkeepKey) (ktypes.UpkeepResults, []ktypes.UpkeepKey) {
+	return nil, keys
+}
+
+func (_m *BenchmarkMockUpkeepService) Close() error {
+	return nil
+}
+
+func (_m *BenchmarkMockUpkeepService) Healthy() error {
+	return nil
+}
+
 func (_m *BenchmarkMockUpkeepService) LockoutUpkeep(ctx context.Context, key ktypes.UpkeepIdentifier) error {
 	return nil
 }
@@ -773,11 +1128,48 @@ func (_m *BenchmarkMockUpkeepService) IsUpkeepLocked(ctx context.Context, key kt
 	return false, nil
 }
 
+func mustEncodeResults(results ktypes.UpkeepResults) []byte {
+	b, _, err := limitedLengthEncodeResults(results, maxObservationLength, testKeyCodec{})
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
 func mustEncodeKeys(keys []ktypes.UpkeepKey) []byte {
+	return encodeObservation(keys, testKeyCodec{})
+}
+
+func mustEncodeLegacyKeys(keys []ktypes.UpkeepKey) []byte {
 	b, _ := encode(keys)
 	return b
 }
 
+// makeLongKeys creates keys that each have a unique 60 digit block and a 48
+// digit upkeep id. each key adds 85 bytes to an observation.
+func makeLongKeys(count int) []ktypes.UpkeepKey {
+	keys := make([]ktypes.UpkeepKey, count)
+	for i := 0; i < count; i++ {
+		keys[i] = ktypes.UpkeepKey(fmt.Sprintf("1%059d|1%047d", i+1, i+1))
+	}
+
+	return keys
+}
+
+func eligibleResults(keys []ktypes.UpkeepKey) ktypes.UpkeepResults {
+	results := make(ktypes.UpkeepResults, len(keys))
+	for i, key := range keys {
+		results[i] = ktypes.UpkeepResult{Key: key, State: ktypes.Eligible}
+	}
+
+	return results
+}
+
+func mustEncodeQuery(q ocrQuery) []byte {
+	b, _ := encodeQuery(q)
+	return b
+}
+
 type MockedFilterer struct {
 	mock.Mock
 }
@@ -854,3 +1246,65 @@ func (_m *BenchmarkMockedFilterer) Accept(key ktypes.UpkeepKey) error {
 func (_m *BenchmarkMockedFilterer) IsTransmissionConfirmed(key ktypes.UpkeepKey) bool {
 	return false
 }
+
+// newTestKeyRegistry returns a registry mock for test keys in the block|id
+// layout with blocks ordered by number
+func newTestKeyRegistry(t testing.TB) *ktypes.MockRegistry {
+	mr := ktypes.NewMockRegistry(t)
+
+	var codec testKeyCodec
+	mr.Mock.On("IdentifierFromKey", mock.Anything).Return(func(k ktypes.UpkeepKey) ktypes.UpkeepIdentifier {
+		id, _ := codec.IdentifierFromKey(k)
+		return id
+	}, func(k ktypes.UpkeepKey) error {
+		_, err := codec.IdentifierFromKey(k)
+		return err
+	}).Maybe()
+	mr.Mock.On("BlockFromKey", mock.Anything).Return(testBlockFromKey, nil).Maybe()
+	mr.Mock.On("CompareBlocks", mock.Anything, mock.Anything).Return(testCompareBlocks, nil).Maybe()
+	mr.Mock.On("MakeKey", mock.Anything, mock.Anything).Return(codec.MakeKey).Maybe()
+
+	return mr
+}
+
+// testKeyCodec is the layout of test keys: a block and an upkeep id separated
+// by "|" where the identifier is the text of the id
+type testKeyCodec struct{}
+
+func (testKeyCodec) BlockFromKey(key ktypes.UpkeepKey) (ktypes.BlockKey, error) {
+	parts := strings.Split(string(key), "|")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("key '%s' is not a test key", key)
+	}
+
+	return ktypes.BlockKey(parts[0]), nil
+}
+
+func (testKeyCodec) IdentifierFromKey(key ktypes.UpkeepKey) (ktypes.UpkeepIdentifier, error) {
+	parts := strings.Split(string(key), "|")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("key '%s' is not a test key", key)
+	}
+
+	return ktypes.UpkeepIdentifier(parts[1]), nil
+}
+
+func (testKeyCodec) MakeKey(block ktypes.BlockKey, id ktypes.UpkeepIdentifier) ktypes.UpkeepKey {
+	return ktypes.UpkeepKey(fmt.Sprintf("%s|%s", block, id))
+}
+
+// windowedReportEncoder is a report encoder that accepts results checked
+// within the provided number of blocks of the latest check block
+type windowedReportEncoder struct {
+	*ktypes.MockReportEncoder
+	blocks int64
+}
+
+func (e windowedReportEncoder) EarliestCheckBlock(latest ktypes.BlockKey) (ktypes.BlockKey, error) {
+	number, err := strconv.ParseInt(string(latest), 10, 64)
+	if err != nil {
+		return "", err
+	}
+
+	return ktypes.BlockKey(strconv.FormatInt(number-e.blocks, 10)), nil
+}
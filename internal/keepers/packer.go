@@ -0,0 +1,352 @@
+package keepers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+const (
+	// maxReportLength is the max length of an encoded report. a report is
+	// composed of 1 or more abi encoded perform calls with performData of
+	// arbitrary length.
+	// TODO (config): pick sane limit based on expected performData size. maybe
+	// set this to block size limit or 2/3 block size limit?
+	maxReportLength = 10_000
+	// maxUpkeepPriority limits configured priorities to keep the priority
+	// packer bounded in time and memory
+	maxUpkeepPriority = 100
+	// maxKnapsackCells bounds the size of the knapsack table. results that
+	// would need a larger table are packed greedily by weight.
+	maxKnapsackCells = 4_000_000
+)
+
+// ReportPacker selects eligible upkeep results to include in a single report
+type ReportPacker interface {
+	// Pack returns the results included in the report in the order provided
+	// and the encoded report. No results and a nil report are returned if no
+	// results fit in the report.
+	Pack([]ktypes.UpkeepResult) ([]ktypes.UpkeepResult, []byte, error)
+}
+
+// reportLimits are the limits every packed report must be within
+type reportLimits struct {
+	encoder     ktypes.ReportEncoder
+	gasLimit    uint32
+	gasOverhead uint32
+	maxLength   int
+}
+
+func newReportPacker(strategy ktypes.ReportPackerStrategy, limits reportLimits, weigh func(ktypes.UpkeepResult) uint64) (ReportPacker, error) {
+	switch strategy {
+	case ktypes.ReportPackerGreedy:
+		return &greedyPacker{limits: limits}, nil
+	case ktypes.ReportPackerKnapsack:
+		return &knapsackPacker{limits: limits}, nil
+	case ktypes.ReportPackerPriority:
+		if weigh == nil {
+			return nil, fmt.Errorf("priority report packer requires upkeep priorities")
+		}
+		return &priorityPacker{limits: limits, weigh: weigh}, nil
+	default:
+		return nil, fmt.Errorf("unknown report packer '%s'", strategy)
+	}
+}
+
+// upkeepGas is the gas an upkeep takes up in a report
+func (l reportLimits) upkeepGas(result ktypes.UpkeepResult) uint64 {
+	return uint64(result.ExecuteGas) + uint64(l.gasOverhead)
+}
+
+// encode encodes the selected results. while the encoded report exceeds the
+// max length, the result with the lowest weight is dropped. ties are broken
+// by dropping the result with the largest performData and then the last
+// result.
+func (l reportLimits) encode(selected []ktypes.UpkeepResult, weigh func(ktypes.UpkeepResult) uint64) ([]ktypes.UpkeepResult, []byte, error) {
+	results := make([]ktypes.UpkeepResult, len(selected))
+	copy(results, selected)
+
+	for len(results) > 0 {
+		b, err := l.encoder.EncodeReport(results)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if l.maxLength <= 0 || len(b) <= l.maxLength {
+			return results, b, nil
+		}
+
+		drop := 0
+		for i := 1; i < len(results); i++ {
+			wi, wd := weightOf(results[i], weigh), weightOf(results[drop], weigh)
+			if wi < wd || (wi == wd && len(results[i].PerformData) >= len(results[drop].PerformData)) {
+				drop = i
+			}
+		}
+
+		results = append(results[:drop], results[drop+1:]...)
+	}
+
+	return nil, nil, nil
+}
+
+// greedyPacker adds results in the order provided while they fit in the
+// report gas limit. a result that does not fit is skipped since a later
+// result could have a lower gas limit.
+type greedyPacker struct {
+	limits reportLimits
+}
+
+func (p *greedyPacker) Pack(results []ktypes.UpkeepResult) ([]ktypes.UpkeepResult, []byte, error) {
+	var capacity uint64
+
+	selected := make([]ktypes.UpkeepResult, 0, len(results))
+	for _, result := range results {
+		gas := p.limits.upkeepGas(result)
+		if capacity+gas > uint64(p.limits.gasLimit) {
+			continue
+		}
+
+		selected = append(selected, result)
+		capacity += gas
+	}
+
+	return p.limits.encode(selected, nil)
+}
+
+// knapsackPacker selects the largest number of results that fit in the report
+// gas limit
+type knapsackPacker struct {
+	limits reportLimits
+}
+
+func (p *knapsackPacker) Pack(results []ktypes.UpkeepResult) ([]ktypes.UpkeepResult, []byte, error) {
+	return p.limits.encode(packWeighted(p.limits, results, nil), nil)
+}
+
+// priorityPacker selects results with the largest total weight that fit in
+// the report gas limit
+type priorityPacker struct {
+	limits reportLimits
+	weigh  func(ktypes.UpkeepResult) uint64
+}
+
+func (p *priorityPacker) Pack(results []ktypes.UpkeepResult) ([]ktypes.UpkeepResult, []byte, error) {
+	return p.limits.encode(packWeighted(p.limits, results, p.weigh), p.weigh)
+}
+
+// packWeighted solves the 0/1 knapsack problem over the report gas limit. the
+// table is indexed by total weight and holds the min gas to reach that weight
+// since gas limits are too large to index by. ties are resolved by the order
+// of the provided results so all nodes select the same results. results that
+// would need a table larger than maxKnapsackCells are packed greedily.
+func packWeighted(limits reportLimits, results []ktypes.UpkeepResult, weigh func(ktypes.UpkeepResult) uint64) []ktypes.UpkeepResult {
+	var total uint64
+
+	candidates := make([]ktypes.UpkeepResult, 0, len(results))
+	for _, result := range results {
+		if gas := limits.upkeepGas(result); gas <= uint64(limits.gasLimit) {
+			candidates = append(candidates, result)
+			total += gas
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// no selection is needed when all candidates fit together
+	if total <= uint64(limits.gasLimit) {
+		return candidates
+	}
+
+	weights := make([]int, len(candidates))
+	for i, result := range candidates {
+		weights[i] = int(weightOf(result, weigh))
+	}
+
+	capacity := weightCapacity(candidates, weights, limits)
+	if len(candidates)*(capacity+1) > maxKnapsackCells {
+		return packByWeight(limits, candidates, weights)
+	}
+
+	const unreachable = uint64(math.MaxUint64)
+
+	minGas := make([]uint64, capacity+1)
+	for w := 1; w <= capacity; w++ {
+		minGas[w] = unreachable
+	}
+
+	taken := make([][]bool, len(candidates))
+	for i, result := range candidates {
+		gas := limits.upkeepGas(result)
+
+		taken[i] = make([]bool, capacity+1)
+		for w := capacity; w >= weights[i]; w-- {
+			prev := minGas[w-weights[i]]
+			if prev == unreachable || prev+gas > uint64(limits.gasLimit) {
+				continue
+			}
+
+			if prev+gas < minGas[w] {
+				minGas[w] = prev + gas
+				taken[i][w] = true
+			}
+		}
+	}
+
+	best := 0
+	for w := capacity; w > 0; w-- {
+		if minGas[w] != unreachable {
+			best = w
+			break
+		}
+	}
+
+	selected := make([]bool, len(candidates))
+	for i, w := len(candidates)-1, best; i >= 0 && w > 0; i-- {
+		if taken[i][w] {
+			selected[i] = true
+			w -= weights[i]
+		}
+	}
+
+	packed := make([]ktypes.UpkeepResult, 0, best)
+	for i, result := range candidates {
+		if selected[i] {
+			packed = append(packed, result)
+		}
+	}
+
+	return packed
+}
+
+// weightCapacity is the max total weight a report can reach. the number of
+// upkeeps in a report is bounded by the number of the lowest gas results that
+// fit in the gas limit and only the largest weights count towards the
+// capacity.
+func weightCapacity(candidates []ktypes.UpkeepResult, weights []int, limits reportLimits) int {
+	gases := make([]uint64, len(candidates))
+	for i, result := range candidates {
+		gases[i] = limits.upkeepGas(result)
+	}
+	sort.Slice(gases, func(i, j int) bool { return gases[i] < gases[j] })
+
+	var (
+		count int
+		gas   uint64
+	)
+
+	for _, g := range gases {
+		if gas+g > uint64(limits.gasLimit) {
+			break
+		}
+
+		gas += g
+		count++
+	}
+
+	sorted := make([]int, len(weights))
+	copy(sorted, weights)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+
+	var capacity int
+	for _, weight := range sorted[:count] {
+		capacity += weight
+	}
+
+	return capacity
+}
+
+// packByWeight adds candidates by descending weight while they fit in the
+// report gas limit. candidates of equal weight are added in the order
+// provided and the selected candidates are returned in the order provided.
+func packByWeight(limits reportLimits, candidates []ktypes.UpkeepResult, weights []int) []ktypes.UpkeepResult {
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return weights[order[i]] > weights[order[j]] })
+
+	var gas uint64
+
+	selected := make([]bool, len(candidates))
+	for _, i := range order {
+		g := limits.upkeepGas(candidates[i])
+		if gas+g > uint64(limits.gasLimit) {
+			continue
+		}
+
+		selected[i] = true
+		gas += g
+	}
+
+	packed := make([]ktypes.UpkeepResult, 0, len(candidates))
+	for i, result := range candidates {
+		if selected[i] {
+			packed = append(packed, result)
+		}
+	}
+
+	return packed
+}
+
+// weightOf returns the weight of a result between 1 and maxUpkeepPriority. all
+// results weigh 1 without a weigh function.
+func weightOf(result ktypes.UpkeepResult, weigh func(ktypes.UpkeepResult) uint64) uint64 {
+	if weigh == nil {
+		return 1
+	}
+
+	weight := weigh(result)
+	if weight < 1 {
+		return 1
+	}
+
+	if weight > maxUpkeepPriority {
+		return maxUpkeepPriority
+	}
+
+	return weight
+}
+
+// upkeepPriorities returns a weigh function from configured priorities keyed
+// by upkeep id. ids are parsed by the registry into the identifiers returned
+// from keys; priorities are rejected when the registry cannot parse ids.
+// upkeeps not configured or with keys that cannot be parsed have a priority
+// of 1.
+func upkeepPriorities(registry ktypes.Registry, priorities map[string]uint32) (func(ktypes.UpkeepResult) uint64, error) {
+	parser, canParse := registry.(ktypes.IdentifierParser)
+	if !canParse && len(priorities) > 0 {
+		return nil, fmt.Errorf("upkeep priorities are not supported by a registry that cannot parse upkeep ids")
+	}
+
+	byIdentifier := make(map[string]uint64, len(priorities))
+	for id, priority := range priorities {
+		identifier, err := parser.ParseIdentifier(id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: upkeep priority id '%s' is not an upkeep id", err, id)
+		}
+
+		if priority > maxUpkeepPriority {
+			return nil, fmt.Errorf("upkeep priority %d for upkeep %s exceeds max of %d", priority, id, maxUpkeepPriority)
+		}
+
+		byIdentifier[string(identifier)] = uint64(priority)
+	}
+
+	return func(result ktypes.UpkeepResult) uint64 {
+		id, err := registry.IdentifierFromKey(result.Key)
+		if err != nil {
+			return 1
+		}
+
+		if priority, ok := byIdentifier[string(id)]; ok {
+			return priority
+		}
+
+		return 1
+	}, nil
+}
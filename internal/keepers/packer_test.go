@@ -0,0 +1,206 @@
+package keepers
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+func TestReportPacker(t *testing.T) {
+	upkeep := func(id string, gas uint32, performData string) ktypes.UpkeepResult {
+		return ktypes.UpkeepResult{Key: ktypes.UpkeepKey("1|" + id), State: ktypes.Eligible, ExecuteGas: gas, PerformData: []byte(performData)}
+	}
+
+	// the first upkeep fills most of the report so greedy packing leaves out
+	// the two smaller upkeeps that would fit together
+	results := []ktypes.UpkeepResult{
+		upkeep("1", 600, "a"),
+		upkeep("2", 500, "b"),
+		upkeep("3", 400, "c"),
+	}
+
+	weigh := func(result ktypes.UpkeepResult) uint64 {
+		if string(result.Key) == "1|1" {
+			return 3
+		}
+		return 1
+	}
+
+	tests := []struct {
+		Name      string
+		Strategy  ktypes.ReportPackerStrategy
+		GasLimit  uint32
+		MaxLength int
+		Expected  []ktypes.UpkeepResult
+	}{
+		{Name: "Greedy", Strategy: ktypes.ReportPackerGreedy, Expected: results[:1]},
+		{Name: "Knapsack", Strategy: ktypes.ReportPackerKnapsack, Expected: results[1:]},
+		{Name: "Priority", Strategy: ktypes.ReportPackerPriority, Expected: results[:1]},
+		{Name: "Knapsack Max Length", Strategy: ktypes.ReportPackerKnapsack, MaxLength: 1, Expected: results[1:2]},
+		{Name: "Nothing Fits Gas Limit", Strategy: ktypes.ReportPackerKnapsack, GasLimit: 100, Expected: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			me := ktypes.NewMockReportEncoder(t)
+			me.Mock.On("EncodeReport", mock.Anything).Return(func(results []ktypes.UpkeepResult) []byte {
+				var b []byte
+				for _, result := range results {
+					b = append(b, result.PerformData...)
+				}
+				return b
+			}, nil).Maybe()
+
+			limits := reportLimits{encoder: me, gasLimit: 1100, gasOverhead: 100, maxLength: maxReportLength}
+			if test.GasLimit != 0 {
+				limits.gasLimit = test.GasLimit
+			}
+
+			if test.MaxLength != 0 {
+				limits.maxLength = test.MaxLength
+			}
+
+			packer, err := newReportPacker(test.Strategy, limits, weigh)
+			assert.NoError(t, err)
+
+			packed, b, err := packer.Pack(results)
+			assert.NoError(t, err)
+			assert.Equal(t, test.Expected, packed)
+
+			if len(test.Expected) > 0 {
+				assert.LessOrEqual(t, len(b), limits.maxLength)
+			} else {
+				assert.Nil(t, b)
+			}
+		})
+	}
+}
+
+func TestReportPacker_DropsLargestPerformData(t *testing.T) {
+	results := []ktypes.UpkeepResult{
+		{Key: ktypes.UpkeepKey("1|1"), State: ktypes.Eligible, PerformData: []byte("abcd")},
+		{Key: ktypes.UpkeepKey("1|2"), State: ktypes.Eligible, PerformData: bytes.Repeat([]byte("a"), 20)},
+		{Key: ktypes.UpkeepKey("1|3"), State: ktypes.Eligible, PerformData: []byte("efgh")},
+	}
+
+	me := ktypes.NewMockReportEncoder(t)
+	me.Mock.On("EncodeReport", mock.Anything).Return(func(results []ktypes.UpkeepResult) []byte {
+		var b []byte
+		for _, result := range results {
+			b = append(b, result.PerformData...)
+		}
+		return b
+	}, nil)
+
+	packer, err := newReportPacker(ktypes.ReportPackerGreedy, reportLimits{encoder: me, gasLimit: 1000, maxLength: 10}, nil)
+	assert.NoError(t, err)
+
+	packed, b, err := packer.Pack(results)
+	assert.NoError(t, err)
+	assert.Equal(t, []ktypes.UpkeepResult{results[0], results[2]}, packed)
+	assert.Equal(t, []byte("abcdefgh"), b)
+
+	// the provided results are not modified
+	assert.Equal(t, ktypes.UpkeepKey("1|2"), results[1].Key)
+}
+
+func TestNewReportPacker_Error(t *testing.T) {
+	_, err := newReportPacker(ktypes.ReportPackerStrategy("unknown"), reportLimits{}, nil)
+	assert.Error(t, err)
+
+	_, err = newReportPacker(ktypes.ReportPackerPriority, reportLimits{}, nil)
+	assert.Error(t, err)
+}
+
+func TestUpkeepPriorities(t *testing.T) {
+	mr := ktypes.NewMockRegistry(t)
+	mr.Mock.On("IdentifierFromKey", ktypes.UpkeepKey("1|300")).Return(ktypes.UpkeepIdentifier([]byte{0x01, 0x2c}), nil)
+	mr.Mock.On("IdentifierFromKey", ktypes.UpkeepKey("1|2")).Return(ktypes.UpkeepIdentifier([]byte{0x02}), nil)
+
+	registry := decimalIdentifierRegistry{MockRegistry: mr}
+
+	weigh, err := upkeepPriorities(registry, map[string]uint32{"300": 5})
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(5), weigh(ktypes.UpkeepResult{Key: ktypes.UpkeepKey("1|300")}))
+	assert.Equal(t, uint64(1), weigh(ktypes.UpkeepResult{Key: ktypes.UpkeepKey("1|2")}))
+
+	_, err = upkeepPriorities(registry, map[string]uint32{"abc": 5})
+	assert.Error(t, err)
+
+	_, err = upkeepPriorities(registry, map[string]uint32{"1": maxUpkeepPriority + 1})
+	assert.Error(t, err)
+
+	// a registry that cannot parse ids does not support priorities
+	_, err = upkeepPriorities(mr, map[string]uint32{"300": 5})
+	assert.Error(t, err)
+
+	_, err = upkeepPriorities(mr, nil)
+	assert.NoError(t, err)
+}
+
+func TestReportPacker_KnapsackWithoutOverhead(t *testing.T) {
+	me := ktypes.NewMockReportEncoder(t)
+	me.Mock.On("EncodeReport", mock.Anything).Return([]byte("report"), nil)
+
+	limits := reportLimits{encoder: me, gasLimit: 2000}
+
+	t.Run("all results fit", func(t *testing.T) {
+		results := make([]ktypes.UpkeepResult, 5000)
+		for i := range results {
+			results[i] = ktypes.UpkeepResult{Key: ktypes.UpkeepKey(fmt.Sprintf("1|%d", i)), State: ktypes.Eligible}
+		}
+
+		packer, err := newReportPacker(ktypes.ReportPackerKnapsack, limits, nil)
+		assert.NoError(t, err)
+
+		packed, _, err := packer.Pack(results)
+		assert.NoError(t, err)
+		assert.Equal(t, results, packed)
+	})
+
+	t.Run("large table falls back to packing by weight", func(t *testing.T) {
+		// 3000 candidates of which 2000 fit need a table larger than the
+		// max knapsack size
+		results := make([]ktypes.UpkeepResult, 3000)
+		for i := range results {
+			results[i] = ktypes.UpkeepResult{Key: ktypes.UpkeepKey(fmt.Sprintf("1|%d", i)), State: ktypes.Eligible, ExecuteGas: 1}
+		}
+
+		weigh := func(result ktypes.UpkeepResult) uint64 {
+			if string(result.Key) == "1|2999" {
+				return 2
+			}
+			return 1
+		}
+
+		packer, err := newReportPacker(ktypes.ReportPackerPriority, limits, weigh)
+		assert.NoError(t, err)
+
+		packed, _, err := packer.Pack(results)
+		assert.NoError(t, err)
+		assert.Len(t, packed, 2000)
+		assert.Equal(t, results[:1999], packed[:1999])
+		assert.Equal(t, results[2999], packed[1999])
+	})
+}
+
+// decimalIdentifierRegistry parses upkeep ids as decimal big ints
+type decimalIdentifierRegistry struct {
+	*ktypes.MockRegistry
+}
+
+func (r decimalIdentifierRegistry) ParseIdentifier(id string) (ktypes.UpkeepIdentifier, error) {
+	value, ok := new(big.Int).SetString(id, 10)
+	if !ok {
+		return nil, fmt.Errorf("not a decimal id")
+	}
+
+	return value.Bytes(), nil
+}
@@ -0,0 +1,132 @@
+package keepers
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/smartcontractkit/ocr2keepers/internal/util"
+)
+
+// rpcPhase identifies the plugin phase a registry call is made for
+type rpcPhase int
+
+const (
+	// samplingPhase calls are made by the sampling job on each head
+	samplingPhase rpcPhase = iota
+	// reportPhase calls are made while building a report
+	reportPhase
+)
+
+// rpcLimiter limits the rate of registry calls and the rate of upkeeps
+// checked across those calls. a share of both rates is reserved for the
+// report phase such that sampling cannot starve report building. report
+// phase calls use capacity of the sampling share when it is available
+// immediately. a nil limiter does not limit calls.
+type rpcLimiter struct {
+	sampling rpcBuckets
+	reserved *rpcBuckets
+}
+
+// newRPCLimiter creates a limiter from rates per second where a rate of 0
+// disables that limit. nil is returned when both limits are disabled.
+func newRPCLimiter(callsPerSecond, elementsPerSecond, reportShare float64) (*rpcLimiter, error) {
+	if callsPerSecond < 0 || elementsPerSecond < 0 {
+		return nil, fmt.Errorf("rpc rate limits must not be negative")
+	}
+
+	if reportShare < 0 || reportShare >= 1 {
+		return nil, fmt.Errorf("rpc report share %.2f must be at least 0 and less than 1", reportShare)
+	}
+
+	if callsPerSecond == 0 && elementsPerSecond == 0 {
+		return nil, nil
+	}
+
+	l := &rpcLimiter{
+		sampling: newRPCBuckets(callsPerSecond*(1-reportShare), elementsPerSecond*(1-reportShare)),
+	}
+
+	if reportShare > 0 {
+		reserved := newRPCBuckets(callsPerSecond*reportShare, elementsPerSecond*reportShare)
+		l.reserved = &reserved
+	}
+
+	return l, nil
+}
+
+// Wait blocks until a registry call for the provided number of upkeeps is
+// allowed in the provided phase or the context is cancelled
+func (l *rpcLimiter) Wait(ctx context.Context, phase rpcPhase, elements int) error {
+	if l == nil {
+		return nil
+	}
+
+	if phase == reportPhase && l.reserved != nil {
+		if l.reserved.tryTake(elements) || l.sampling.tryTake(elements) {
+			return nil
+		}
+
+		return l.reserved.take(ctx, elements)
+	}
+
+	return l.sampling.take(ctx, elements)
+}
+
+// rpcBuckets holds a bucket for calls and a bucket for upkeeps checked. a nil
+// bucket does not limit.
+type rpcBuckets struct {
+	calls    *util.TokenBucket
+	elements *util.TokenBucket
+}
+
+func newRPCBuckets(callsPerSecond, elementsPerSecond float64) rpcBuckets {
+	var b rpcBuckets
+
+	// the burst is the capacity of a single second
+	if callsPerSecond > 0 {
+		b.calls = util.NewTokenBucket(callsPerSecond, int(math.Ceil(callsPerSecond)))
+	}
+
+	if elementsPerSecond > 0 {
+		b.elements = util.NewTokenBucket(elementsPerSecond, int(math.Ceil(elementsPerSecond)))
+	}
+
+	return b
+}
+
+func (b *rpcBuckets) tryTake(elements int) bool {
+	if b.calls != nil && !b.calls.TryTake(1) {
+		return false
+	}
+
+	if b.elements != nil && !b.elements.TryTake(elements) {
+		if b.calls != nil {
+			b.calls.Put(1)
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func (b *rpcBuckets) take(ctx context.Context, elements int) error {
+	if b.calls != nil {
+		if err := b.calls.Take(ctx, 1); err != nil {
+			return err
+		}
+	}
+
+	if b.elements != nil {
+		if err := b.elements.Take(ctx, elements); err != nil {
+			if b.calls != nil {
+				b.calls.Put(1)
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
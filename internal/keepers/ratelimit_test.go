@@ -0,0 +1,78 @@
+package keepers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRPCLimiter(t *testing.T) {
+	l, err := newRPCLimiter(0, 0, 0.2)
+	assert.NoError(t, err)
+	assert.Nil(t, l)
+
+	// a nil limiter does not limit
+	assert.NoError(t, l.Wait(context.Background(), samplingPhase, 100))
+
+	l, err = newRPCLimiter(10, 0, 0)
+	assert.NoError(t, err)
+	assert.NotNil(t, l)
+	assert.Nil(t, l.reserved)
+	assert.Nil(t, l.sampling.elements)
+
+	_, err = newRPCLimiter(-1, 0, 0.2)
+	assert.Error(t, err)
+
+	_, err = newRPCLimiter(10, 10, 1)
+	assert.Error(t, err)
+
+	_, err = newRPCLimiter(10, 10, -0.1)
+	assert.Error(t, err)
+}
+
+func TestRPCLimiter_Wait(t *testing.T) {
+	// half of the calls and elements are reserved for reports; the very low
+	// element rate leaves a single element available to each share
+	l, err := newRPCLimiter(10, 0.001, 0.5)
+	require.NoError(t, err)
+
+	expired := func() context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		t.Cleanup(cancel)
+		return ctx
+	}
+
+	// sampling uses its own share of a single element
+	assert.NoError(t, l.Wait(context.Background(), samplingPhase, 1))
+	assert.ErrorIs(t, l.Wait(expired(), samplingPhase, 1), context.DeadlineExceeded)
+
+	// exhausted sampling capacity does not starve the report phase
+	assert.NoError(t, l.Wait(expired(), reportPhase, 1))
+	assert.ErrorIs(t, l.Wait(expired(), reportPhase, 1), context.DeadlineExceeded)
+
+	t.Run("Report Uses Sampling Capacity", func(t *testing.T) {
+		l, err := newRPCLimiter(0, 0.001, 0.5)
+		require.NoError(t, err)
+
+		// the report phase uses the reserved share and then available
+		// sampling capacity
+		assert.NoError(t, l.Wait(expired(), reportPhase, 1))
+		assert.NoError(t, l.Wait(expired(), reportPhase, 1))
+		assert.ErrorIs(t, l.Wait(expired(), reportPhase, 1), context.DeadlineExceeded)
+		assert.ErrorIs(t, l.Wait(expired(), samplingPhase, 1), context.DeadlineExceeded)
+	})
+
+	t.Run("Returned Call Tokens", func(t *testing.T) {
+		l, err := newRPCLimiter(1, 0.001, 0)
+		require.NoError(t, err)
+
+		require.True(t, l.sampling.elements.TryTake(1))
+
+		// a call without element capacity returns the call token
+		assert.False(t, l.sampling.tryTake(1))
+		assert.True(t, l.sampling.calls.TryTake(1))
+	})
+}
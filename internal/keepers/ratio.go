@@ -0,0 +1,162 @@
+package keepers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+)
+
+// roundsPerBlockWindow is the number of recent blocks the average number of
+// rounds per block is measured over
+const roundsPerBlockWindow = 20
+
+// sampleRatioProvider provides the ratio of active upkeeps sampled on each
+// head
+type sampleRatioProvider interface {
+	Ratio() sampleRatio
+}
+
+// Ratio returns the static ratio
+func (r sampleRatio) Ratio() sampleRatio {
+	return r
+}
+
+// adaptiveSampleRatio adjusts the sample ratio to the measured number of OCR
+// rounds per block. sampling results are observed at most once per block, so
+// when more than one round completes within a block only one of those rounds
+// observes new results. the number of rounds that observe sampling results
+// within the target rounds is the target divided by the rounds per block and
+// the ratio is raised or lowered such that the target probability is met
+// with that number of rounds.
+type adaptiveSampleRatio struct {
+	targetRounds int
+	nodes        int
+	probability  float32
+	min          sampleRatio
+	max          sampleRatio
+	logger       *log.Logger
+
+	mu sync.RWMutex
+	// rounds is the number of rounds observed since the last head
+	rounds  int
+	started bool
+	// history holds the number of rounds of the most recent blocks
+	history        []int
+	roundsPerBlock float64
+	ratio          sampleRatio
+}
+
+func newAdaptiveSampleRatio(targetRounds, nodes int, probability float32, min, max sampleRatio, logger *log.Logger) (*adaptiveSampleRatio, error) {
+	if min < 0 || max > 1 || min > max {
+		return nil, fmt.Errorf("sample ratio bounds must be within 0 and 1 with min %s not greater than max %s", min, max)
+	}
+
+	// the starting ratio assumes a single round per block until rounds are
+	// measured
+	ratio, err := sampleFromProbability(targetRounds, nodes, probability)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &adaptiveSampleRatio{
+		targetRounds:   targetRounds,
+		nodes:          nodes,
+		probability:    probability,
+		min:            min,
+		max:            max,
+		logger:         logger,
+		history:        make([]int, 0, roundsPerBlockWindow),
+		roundsPerBlock: 1,
+	}
+
+	r.ratio = r.bound(ratio)
+
+	return r, nil
+}
+
+// Ratio returns the effective sample ratio
+func (r *adaptiveSampleRatio) Ratio() sampleRatio {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.ratio
+}
+
+// RoundsPerBlock returns the average number of rounds per block measured
+// over the most recent blocks
+func (r *adaptiveSampleRatio) RoundsPerBlock() float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.roundsPerBlock
+}
+
+// ObserveRound records that an OCR round started
+func (r *adaptiveSampleRatio) ObserveRound() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.started {
+		r.rounds++
+	}
+}
+
+// ObserveHead records that a new head was received and adjusts the ratio to
+// the rounds measured within the previous block. rounds before the first
+// head are not counted since the block they started in is unknown.
+func (r *adaptiveSampleRatio) ObserveHead() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.started {
+		r.started = true
+		return
+	}
+
+	r.history = append(r.history, r.rounds)
+	if len(r.history) > roundsPerBlockWindow {
+		r.history = r.history[1:]
+	}
+	r.rounds = 0
+
+	var total int
+	for _, rounds := range r.history {
+		total += rounds
+	}
+
+	r.roundsPerBlock = float64(total) / float64(len(r.history))
+
+	// with fewer rounds than blocks every round observes new results
+	perBlock := math.Max(r.roundsPerBlock, 1)
+	rounds := int(math.Ceil(float64(r.targetRounds) / perBlock))
+	if rounds < 1 {
+		rounds = 1
+	}
+
+	ratio, err := sampleFromProbability(rounds, r.nodes, r.probability)
+	if err != nil {
+		// inputs were validated when the ratio was created
+		r.logger.Printf("%s: failed to adjust sample ratio", err)
+		return
+	}
+
+	ratio = r.bound(ratio)
+	if ratio != r.ratio {
+		r.logger.Printf("sample ratio adjusted from %s to %s with %.2f rounds per block", r.ratio, ratio, r.roundsPerBlock)
+	}
+
+	r.ratio = ratio
+}
+
+func (r *adaptiveSampleRatio) bound(ratio sampleRatio) sampleRatio {
+	if ratio < r.min {
+		return r.min
+	}
+
+	if ratio > r.max {
+		return r.max
+	}
+
+	return ratio
+}
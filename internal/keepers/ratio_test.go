@@ -0,0 +1,89 @@
+package keepers
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveSampleRatio(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+
+	expected := func(rounds int) sampleRatio {
+		ratio, err := sampleFromProbability(rounds, 3, 0.99999)
+		require.NoError(t, err)
+		return ratio
+	}
+
+	observe := func(r *adaptiveSampleRatio, blocks, roundsPerBlock int) {
+		for i := 0; i < blocks; i++ {
+			for j := 0; j < roundsPerBlock; j++ {
+				r.ObserveRound()
+			}
+			r.ObserveHead()
+		}
+	}
+
+	r, err := newAdaptiveSampleRatio(10, 3, 0.99999, 0, 1, logger)
+	require.NoError(t, err)
+
+	// a single round per block is assumed until rounds are measured
+	assert.Equal(t, expected(10), r.Ratio())
+
+	// rounds before the first head are not counted
+	r.ObserveRound()
+	r.ObserveHead()
+	assert.Equal(t, expected(10), r.Ratio())
+	assert.Equal(t, float64(1), r.RoundsPerBlock())
+
+	// five rounds per block results in two rounds observing new results
+	// within the target of ten rounds
+	observe(r, roundsPerBlockWindow, 5)
+	assert.Equal(t, float64(5), r.RoundsPerBlock())
+	assert.Equal(t, expected(2), r.Ratio())
+	assert.Greater(t, r.Ratio(), expected(10))
+
+	// fewer rounds than blocks lowers the ratio back to the static ratio
+	observe(r, roundsPerBlockWindow, 0)
+	assert.Equal(t, float64(0), r.RoundsPerBlock())
+	assert.Equal(t, expected(10), r.Ratio())
+
+	t.Run("Bounds", func(t *testing.T) {
+		r, err := newAdaptiveSampleRatio(10, 3, 0.99999, 0.5, 0.6, logger)
+		require.NoError(t, err)
+
+		assert.Equal(t, sampleRatio(0.5), r.Ratio())
+
+		observe(r, roundsPerBlockWindow+1, 10)
+		assert.Equal(t, sampleRatio(0.6), r.Ratio())
+	})
+
+	t.Run("Invalid Bounds", func(t *testing.T) {
+		_, err := newAdaptiveSampleRatio(10, 3, 0.99999, 0.6, 0.5, logger)
+		assert.Error(t, err)
+
+		_, err = newAdaptiveSampleRatio(10, 3, 0.99999, 0, 2, logger)
+		assert.Error(t, err)
+	})
+}
+
+func TestSampleRatioBounds(t *testing.T) {
+	min, max, err := sampleRatioBounds("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, sampleRatio(0), min)
+	assert.Equal(t, sampleRatio(1), max)
+
+	min, max, err = sampleRatioBounds("0.1", "0.5")
+	assert.NoError(t, err)
+	assert.Equal(t, sampleRatio(0.1), min)
+	assert.Equal(t, sampleRatio(0.5), max)
+
+	_, _, err = sampleRatioBounds("a", "")
+	assert.Error(t, err)
+
+	_, _, err = sampleRatioBounds("", "b")
+	assert.Error(t, err)
+}
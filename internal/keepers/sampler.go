@@ -0,0 +1,124 @@
+package keepers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/smartcontractkit/libocr/commontypes"
+	"github.com/smartcontractkit/libocr/offchainreporting2/types"
+	"golang.org/x/crypto/sha3"
+
+	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+// upkeepSampler selects the upkeeps a node checks from the active upkeeps at
+// a head
+type upkeepSampler interface {
+	Sample(head ktypes.BlockKey, keys []ktypes.UpkeepKey, ratio sampleRatio) []ktypes.UpkeepKey
+}
+
+func newUpkeepSampler(strategy ktypes.SamplerStrategy, oracle commontypes.OracleID, nodes, copies int, digest types.ConfigDigest, ratio sampleRatio) (upkeepSampler, error) {
+	switch strategy {
+	case ktypes.SamplerRandom:
+		return &randomSampler{shuffler: new(cryptoShuffler[ktypes.UpkeepKey])}, nil
+	case ktypes.SamplerCoverage:
+		return newCoverageSampler(oracle, nodes, copies, digest, ratio)
+	default:
+		return nil, fmt.Errorf("unknown sampler '%s'", strategy)
+	}
+}
+
+// randomSampler selects upkeeps at random independently of other nodes
+type randomSampler struct {
+	shuffler shuffler[ktypes.UpkeepKey]
+}
+
+func (s *randomSampler) Sample(_ ktypes.BlockKey, keys []ktypes.UpkeepKey, ratio sampleRatio) []ktypes.UpkeepKey {
+	size := ratio.OfInt(len(keys))
+	if size <= 0 {
+		return nil
+	}
+
+	return s.shuffler.Shuffle(keys)[:size]
+}
+
+// coverageSampler partitions the active upkeeps across oracles such that
+// coverage is deterministic. oracles are split into groups of at least the
+// configured number of copies and all oracles in a group check the same
+// window of upkeeps at each block, which allows check results to reach the
+// observation quorum. group windows are spread evenly over the sorted active
+// upkeeps from an offset derived from the config digest and advance by the
+// sample size every block. with a stable active set and a sampling job for
+// each head, every upkeep is checked by at least the configured number of
+// copies within ceil(upkeeps / (groups * sample size)) blocks. the sample
+// size is derived from the ratio of the shared offchain config and not from
+// the ratio provided to Sample, which may be adapted to the rounds per block
+// measured by the node, such that all nodes in a group agree on the window.
+type coverageSampler struct {
+	group  int
+	groups int
+	seed   uint64
+	ratio  sampleRatio
+}
+
+func newCoverageSampler(oracle commontypes.OracleID, nodes, copies int, digest types.ConfigDigest, ratio sampleRatio) (*coverageSampler, error) {
+	if nodes <= 0 {
+		return nil, fmt.Errorf("number of nodes must be greater than 0")
+	}
+
+	if copies <= 0 || copies > nodes {
+		return nil, fmt.Errorf("number of copies must be between 1 and the number of nodes %d", nodes)
+	}
+
+	groups := nodes / copies
+
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(digest[:])
+
+	return &coverageSampler{
+		group:  int(oracle) % groups,
+		groups: groups,
+		seed:   binary.BigEndian.Uint64(hash.Sum(nil)[:8]),
+		ratio:  ratio,
+	}, nil
+}
+
+func (s *coverageSampler) Sample(head ktypes.BlockKey, keys []ktypes.UpkeepKey, _ sampleRatio) []ktypes.UpkeepKey {
+	count := len(keys)
+
+	size := s.ratio.OfInt(count)
+	if size <= 0 {
+		return nil
+	}
+
+	if size > count {
+		size = count
+	}
+
+	// all nodes sort the same active set in the same order
+	sorted := make([]ktypes.UpkeepKey, count)
+	copy(sorted, keys)
+	sort.Sort(sortUpkeepKeys(sorted))
+
+	block, ok := new(big.Int).SetString(string(head), 10)
+	if !ok {
+		block = new(big.Int)
+	}
+
+	// the offset rotates by the sample size every block such that windows of
+	// consecutive blocks are adjacent
+	offset := new(big.Int).Mul(block, big.NewInt(int64(size)))
+	offset.Add(offset, new(big.Int).SetUint64(s.seed))
+	offset.Mod(offset, big.NewInt(int64(count)))
+
+	start := (offset.Int64() + int64(s.group)*int64(count)/int64(s.groups)) % int64(count)
+
+	sampled := make([]ktypes.UpkeepKey, size)
+	for i := range sampled {
+		sampled[i] = sorted[(start+int64(i))%int64(count)]
+	}
+
+	return sampled
+}
@@ -0,0 +1,139 @@
+package keepers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/smartcontractkit/libocr/commontypes"
+	"github.com/smartcontractkit/libocr/offchainreporting2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+func TestCoverageSampler(t *testing.T) {
+	const (
+		nodes  = 6
+		copies = 2
+		count  = 30
+	)
+
+	digest := types.ConfigDigest{0x01}
+	ratio := sampleRatio(0.1)
+
+	samplers := make([]upkeepSampler, nodes)
+	for i := range samplers {
+		sampler, err := newUpkeepSampler(ktypes.SamplerCoverage, commontypes.OracleID(i), nodes, copies, digest, ratio)
+		require.NoError(t, err)
+
+		samplers[i] = sampler
+	}
+
+	keys := make([]ktypes.UpkeepKey, count)
+	for i := range keys {
+		keys[i] = ktypes.UpkeepKey(fmt.Sprintf("1|%d", i+1))
+	}
+
+	// 3 groups of 2 nodes check 3 upkeeps each per block so all upkeeps are
+	// covered within 4 blocks
+	checkedBy := make(map[string]map[int]struct{})
+	for block := 100; block < 104; block++ {
+		head := ktypes.BlockKey(fmt.Sprintf("%d", block))
+
+		sampled := make([][]ktypes.UpkeepKey, nodes)
+		for i, sampler := range samplers {
+			sampled[i] = sampler.Sample(head, keys, ratio)
+			assert.Len(t, sampled[i], 3)
+
+			for _, key := range sampled[i] {
+				if _, ok := checkedBy[string(key)]; !ok {
+					checkedBy[string(key)] = make(map[int]struct{})
+				}
+
+				checkedBy[string(key)][i] = struct{}{}
+			}
+		}
+
+		// nodes in the same group check the same upkeeps at the same block
+		for i := 0; i < nodes/copies; i++ {
+			assert.Equal(t, sampled[i], sampled[i+nodes/copies])
+		}
+	}
+
+	for _, key := range keys {
+		assert.GreaterOrEqual(t, len(checkedBy[string(key)]), copies, string(key))
+	}
+
+	// the provided keys are not reordered
+	assert.Equal(t, ktypes.UpkeepKey("1|1"), keys[0])
+}
+
+func TestCoverageSampler_Digest(t *testing.T) {
+	keys := make([]ktypes.UpkeepKey, 100)
+	for i := range keys {
+		keys[i] = ktypes.UpkeepKey(fmt.Sprintf("1|%d", i+1))
+	}
+
+	a, err := newCoverageSampler(0, 4, 1, types.ConfigDigest{0x01}, 0.1)
+	require.NoError(t, err)
+
+	b, err := newCoverageSampler(0, 4, 1, types.ConfigDigest{0x02}, 0.1)
+	require.NoError(t, err)
+
+	// the same config results in the same sample
+	assert.Equal(t, a.Sample("1", keys, 0.1), a.Sample("1", keys, 0.1))
+	assert.NotEqual(t, a.Sample("1", keys, 0.1), b.Sample("1", keys, 0.1))
+
+	all, err := newCoverageSampler(0, 4, 1, types.ConfigDigest{0x01}, 2)
+	require.NoError(t, err)
+
+	none, err := newCoverageSampler(0, 4, 1, types.ConfigDigest{0x01}, 0)
+	require.NoError(t, err)
+
+	assert.Len(t, all.Sample("1", keys, 0.1), 100)
+	assert.Nil(t, none.Sample("1", keys, 0.1))
+	assert.Nil(t, a.Sample("1", nil, 0.5))
+}
+
+func TestCoverageSampler_LocalRatio(t *testing.T) {
+	keys := make([]ktypes.UpkeepKey, 100)
+	for i := range keys {
+		keys[i] = ktypes.UpkeepKey(fmt.Sprintf("1|%d", i+1))
+	}
+
+	// two nodes in the same group with different adapted ratios
+	a, err := newCoverageSampler(0, 4, 2, types.ConfigDigest{0x01}, 0.1)
+	require.NoError(t, err)
+
+	b, err := newCoverageSampler(2, 4, 2, types.ConfigDigest{0x01}, 0.1)
+	require.NoError(t, err)
+
+	// the window is derived from the shared ratio such that both nodes check
+	// the same upkeeps at each block
+	for _, head := range []ktypes.BlockKey{"100", "101", "102"} {
+		sampled := a.Sample(head, keys, 0.1)
+		assert.Len(t, sampled, 10)
+		assert.Equal(t, sampled, b.Sample(head, keys, 0.3))
+	}
+}
+
+func TestRandomSampler(t *testing.T) {
+	keys := []ktypes.UpkeepKey{ktypes.UpkeepKey("1|1"), ktypes.UpkeepKey("1|2"), ktypes.UpkeepKey("1|3"), ktypes.UpkeepKey("1|4")}
+
+	sampler := &randomSampler{shuffler: new(noShuffleShuffler[ktypes.UpkeepKey])}
+
+	assert.Equal(t, keys[:2], sampler.Sample("1", keys, 0.5))
+	assert.Nil(t, sampler.Sample("1", keys, 0))
+}
+
+func TestNewUpkeepSampler_Error(t *testing.T) {
+	_, err := newUpkeepSampler(ktypes.SamplerStrategy("unknown"), 0, 4, 1, types.ConfigDigest{}, 0.1)
+	assert.Error(t, err)
+
+	_, err = newUpkeepSampler(ktypes.SamplerCoverage, 0, 0, 1, types.ConfigDigest{}, 0.1)
+	assert.Error(t, err)
+
+	_, err = newUpkeepSampler(ktypes.SamplerCoverage, 0, 4, 5, types.ConfigDigest{}, 0.1)
+	assert.Error(t, err)
+}
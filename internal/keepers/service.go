@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"runtime"
 	"sync"
 	"time"
 
@@ -13,38 +12,48 @@ import (
 	"github.com/smartcontractkit/ocr2keepers/pkg/types"
 )
 
-// keyBatchSize is the value of max items in the eth_call batch
-const keyBatchSize = 10
+const (
+	// keyBatchSize is the value of max items in the eth_call batch
+	keyBatchSize = 10
+	// sampleHistoryLength is the number of heads for which sampling results
+	// are retained
+	sampleHistoryLength = 10
+)
 
 var ErrTooManyErrors = fmt.Errorf("too many errors in parallel worker process")
 
 type onDemandUpkeepService struct {
 	logger           *log.Logger
-	ratio            sampleRatio
+	ratio            sampleRatioProvider
 	headSubscriber   types.HeadSubscriber
 	registry         types.Registry
-	shuffler         shuffler[types.UpkeepKey]
+	limiter          *rpcLimiter
+	sampler          upkeepSampler
 	cache            *util.Cache[types.UpkeepResult]
-	cacheCleaner     *util.IntervalCacheCleaner[types.UpkeepResult]
 	samplingResults  samplingUpkeepsResults
 	samplingDuration time.Duration
 	workers          *workerGroup[types.UpkeepResults]
-	stopProcs        chan struct{}
+	supervisor       *util.Supervisor
+	// heads holds the latest head waiting to be sampled
+	heads chan types.BlockKey
 }
 
 // newOnDemandUpkeepService provides an object that implements the UpkeepService
 // by running a worker pool that makes RPC network calls every time upkeeps
 // need to be sampled. This variant has limitations in how quickly large numbers
-// of upkeeps can be checked. Be aware that network calls are not rate limited
-// from this service.
+// of upkeeps can be checked. Registry calls from sampling and from the report
+// phase wait on the provided limiter; a nil limiter does not limit calls.
+// Check results are stored in the provided cache which is owned by the caller
+// and can outlive the service.
 func newOnDemandUpkeepService(
-	ratio sampleRatio,
+	ratio sampleRatioProvider,
+	sampler upkeepSampler,
 	headSubscriber types.HeadSubscriber,
 	registry types.Registry,
+	limiter *rpcLimiter,
+	cache *util.Cache[types.UpkeepResult],
 	logger *log.Logger,
 	samplingDuration time.Duration,
-	cacheExpire time.Duration,
-	cacheClean time.Duration,
 	workers int,
 	workerQueueLength int,
 ) *onDemandUpkeepService {
@@ -53,17 +62,13 @@ func newOnDemandUpkeepService(
 		ratio:            ratio,
 		headSubscriber:   headSubscriber,
 		registry:         registry,
+		limiter:          limiter,
 		samplingDuration: samplingDuration,
-		shuffler:         new(cryptoShuffler[types.UpkeepKey]),
-		cache:            util.NewCache[types.UpkeepResult](cacheExpire),
-		cacheCleaner:     util.NewIntervalCacheCleaner[types.UpkeepResult](cacheClean),
+		sampler:          sampler,
+		cache:            cache,
 		workers:          newWorkerGroup[types.UpkeepResults](workers, workerQueueLength),
-		stopProcs:        make(chan struct{}),
 	}
 
-	// stop the cleaner go-routine once the upkeep service is no longer reachable
-	runtime.SetFinalizer(s, func(srv *onDemandUpkeepService) { srv.stop() })
-
 	// start background services
 	s.start()
 
@@ -72,12 +77,16 @@ func newOnDemandUpkeepService(
 
 var _ upkeepService = (*onDemandUpkeepService)(nil)
 
-func (s *onDemandUpkeepService) SampleUpkeeps(_ context.Context, filters ...func(types.UpkeepKey) bool) (types.UpkeepResults, error) {
+// SampleUpkeeps returns the eligible results of the sampling job that ran on
+// the provided block. An empty block returns the results of the latest
+// sampling job. Results collected so far are returned while the job is still
+// running and remain available until they are evicted by newer heads.
+func (s *onDemandUpkeepService) SampleUpkeeps(_ context.Context, block types.BlockKey, filters ...func(types.UpkeepKey) bool) (types.UpkeepResults, error) {
 	if s.workers == nil {
 		panic("cannot sample upkeeps without runner")
 	}
 
-	results := s.samplingResults.get()
+	results := s.samplingResults.get(block)
 	if len(results) == 0 {
 		return nil, nil
 	}
@@ -99,7 +108,23 @@ EachKey:
 	return filteredResults, nil
 }
 
-func (s *onDemandUpkeepService) CheckUpkeep(ctx context.Context, keys ...types.UpkeepKey) (types.UpkeepResults, error) {
+// LatestSampledBlock returns the block of the most recently completed
+// sampling job. A block with a sampling job still running is not returned.
+func (s *onDemandUpkeepService) LatestSampledBlock() (types.BlockKey, bool) {
+	return s.samplingResults.latestCompleted()
+}
+
+// HasSampledBlock indicates whether the sampling job for the provided block
+// completed and its results are retained by the service.
+func (s *onDemandUpkeepService) HasSampledBlock(block types.BlockKey) bool {
+	return s.samplingResults.completed(block)
+}
+
+func (s *onDemandUpkeepService) CheckUpkeep(ctx context.Context, keys ...types.UpkeepKey) (_ types.UpkeepResults, err error) {
+	// a panic caused by a bad RPC response fails the check instead of the
+	// node process
+	defer util.RecoverPanic(&err)
+
 	var (
 		wg                sync.WaitGroup
 		results           = make([]types.UpkeepResult, len(keys))
@@ -133,6 +158,12 @@ func (s *onDemandUpkeepService) CheckUpkeep(ctx context.Context, keys ...types.U
 		return results, nil
 	}
 
+	// checks outside of sampling are made while building a report and use
+	// the rate reserved for the report phase
+	if err := s.limiter.Wait(ctx, reportPhase, len(nonCachedKeys)); err != nil {
+		return nil, fmt.Errorf("%w: service failed to check upkeep from registry within rate limit", err)
+	}
+
 	// check upkeep at block number in key
 	// return result including performData
 	checkResults, err := s.registry.CheckUpkeep(ctx, nonCachedKeys...)
@@ -149,92 +180,206 @@ func (s *onDemandUpkeepService) CheckUpkeep(ctx context.Context, keys ...types.U
 	return results, nil
 }
 
-func (s *onDemandUpkeepService) start() {
-	// TODO: if this process panics, restart it
-	go s.cacheCleaner.Run(s.cache)
-	go func() {
-		if err := s.runSamplingUpkeeps(); err != nil {
-			s.logger.Fatal(err)
+// CachedUpkeep returns cached check results for the provided keys and the
+// keys that were not found in the cache. No network calls are made.
+func (s *onDemandUpkeepService) CachedUpkeep(keys ...types.UpkeepKey) (types.UpkeepResults, []types.UpkeepKey) {
+	results := make(types.UpkeepResults, 0, len(keys))
+	missed := make([]types.UpkeepKey, 0)
+
+	for _, key := range keys {
+		if result, cached := s.cache.Get(string(key)); cached {
+			results = append(results, result)
+		} else {
+			missed = append(missed, key)
 		}
-	}()
+	}
+
+	return results, missed
 }
 
-func (s *onDemandUpkeepService) stop() {
-	close(s.stopProcs)
-	s.cacheCleaner.Stop()
+// Healthy returns an error naming the background processes that failed and
+// are waiting to be restarted
+func (s *onDemandUpkeepService) Healthy() error {
+	if s.supervisor == nil {
+		return nil
+	}
+
+	return s.supervisor.Healthy()
 }
 
-func (s *onDemandUpkeepService) runSamplingUpkeeps() error {
-	ctx, cancel := context.WithCancel(context.Background())
+// start runs the background processes under a supervisor that restarts a
+// process after a panic or an error
+func (s *onDemandUpkeepService) start() {
+	s.heads = make(chan types.BlockKey, 1)
+	s.supervisor = util.NewSupervisor(s.logger, util.DefaultMinRestartBackoff, util.DefaultMaxRestartBackoff)
 
-	headTriggerCh := make(chan struct{}, 1)
-	defer close(headTriggerCh)
+	s.supervisor.Go("upkeep service head subscription", s.runHeadSubscription)
+	s.supervisor.Go("upkeep service sampling", s.runSamplingUpkeeps)
+}
+
+// Close stops the background processes and the worker group. In-flight
+// registry calls are cancelled and Close returns once all go-routines of the
+// service have exited.
+func (s *onDemandUpkeepService) Close() error {
+	s.stop()
+	return nil
+}
 
-	// Start the sampling upkeep process for heads
-	go func() {
-		for range headTriggerCh {
-			s.processLatestHead(ctx)
+// stop stops the sampling process before the worker group such that a
+// running sampling job collects the results of all work it queued
+func (s *onDemandUpkeepService) stop() {
+	if s.supervisor != nil {
+		s.supervisor.Stop()
+	}
+
+	s.workers.Stop()
+}
+
+// runSamplingUpkeeps runs a sampling job for each head received from the
+// head subscription until the context is cancelled
+func (s *onDemandUpkeepService) runSamplingUpkeeps(ctx context.Context) error {
+	for {
+		select {
+		case head := <-s.heads:
+			s.processLatestHead(ctx, head)
+		case <-ctx.Done():
+			return nil
 		}
-	}()
+	}
+}
 
-	// Cancel context when receiving the stop signal
-	go func() {
-		<-s.stopProcs
-		cancel()
-	}()
+// runHeadSubscription queues new heads to be sampled until the context is
+// cancelled
+func (s *onDemandUpkeepService) runHeadSubscription(ctx context.Context) error {
+	err := s.headSubscriber.OnNewHead(ctx, func(head types.BlockKey) {
+		// an adaptive ratio measures the rounds between heads
+		if adaptive, ok := s.ratio.(*adaptiveSampleRatio); ok {
+			adaptive.ObserveHead()
+		}
 
-	return s.headSubscriber.OnNewHead(ctx, func(_ types.BlockKey) {
 		// This is needed in order to do not block the process when a new head comes in.
 		// The running upkeep sampling process should be finished first before starting
-		// sampling for the next head.
+		// sampling for the next head. A head waiting to be sampled is replaced
+		// by the newer head.
 		select {
-		case headTriggerCh <- struct{}{}:
+		case s.heads <- head:
 		default:
+			select {
+			case <-s.heads:
+			default:
+			}
+
+			select {
+			case s.heads <- head:
+			default:
+			}
 		}
 	})
+
+	// the subscription ending because the service stopped is not a failure
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: head subscription failed", err)
+	}
+
+	return fmt.Errorf("head subscription ended")
 }
 
 // processLatestHead performs checking upkeep logic for all eligible keys of the given head
-func (s *onDemandUpkeepService) processLatestHead(ctx context.Context) {
+func (s *onDemandUpkeepService) processLatestHead(ctx context.Context, head types.BlockKey) {
+	// a head replaced by a reorg at the same height is sampled again; the
+	// results of the replaced head are dropped
+	hash := s.headHash(head)
+	reorged := s.samplingResults.replaced(head, hash)
+	if reorged {
+		s.logger.Printf("head %s was replaced by a reorg; sampling again", head)
+	}
+
+	// results are added to those already collected for a head so a head
+	// that was already sampled is not sampled again
+	if s.samplingResults.has(head) {
+		s.logger.Printf("head %s already sampled", head)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, s.samplingDuration)
 	defer cancel()
 
-	// Get only the active upkeeps from the contract. This should not include
-	// any cancelled upkeeps.
-	keys, err := s.registry.GetActiveUpkeepKeys(ctx, "0")
+	// Get only the active upkeeps from the contract at the head that triggered
+	// this job. This should not include any cancelled upkeeps. Results of the
+	// previous head remain the latest if no results are collected for this head.
+	if err := s.limiter.Wait(ctx, samplingPhase, 1); err != nil {
+		s.logger.Printf("%s: rate limit not met to get upkeeps from registry for sampling", err)
+		return
+	}
+
+	keys, err := s.registry.GetActiveUpkeepKeys(ctx, head)
 	if err != nil {
-		s.samplingResults.purge()
 		s.logger.Printf("%s: failed to get upkeeps from registry for sampling", err)
 		return
 	}
 
+	// cached check results at the head are from the replaced block
+	if reorged {
+		for _, key := range keys {
+			s.cache.Delete(string(key))
+		}
+	}
+
 	s.logger.Printf("%d active upkeep keys found in registry", len(keys))
+	s.samplingResults.setHash(head, hash)
 	if len(keys) == 0 {
-		s.samplingResults.purge()
+		s.samplingResults.set(head, nil)
+		s.samplingResults.complete(head)
 		return
 	}
 
-	// select x upkeeps at random from set
-	keys = s.shuffler.Shuffle(keys)
-	size := s.ratio.OfInt(len(keys))
+	// select a ratio of upkeeps from the set
+	ratio := s.ratio.Ratio()
+	keys = s.sampler.Sample(head, keys, ratio)
 
-	s.logger.Printf("%d results selected by provided ratio %s", size, s.ratio)
-	if size <= 0 {
-		s.samplingResults.purge()
+	s.logger.Printf("%d results selected by provided ratio %s", len(keys), ratio)
+	if len(keys) == 0 {
+		s.samplingResults.set(head, nil)
+		s.samplingResults.complete(head)
 		return
 	}
 
-	upkeepResults, err := s.parallelCheck(ctx, keys[:size])
+	// eligible results are added to the sampling results for the head as each
+	// batch completes such that results collected before the sampling
+	// duration elapses are available to observations
+	upkeepResults, err := s.parallelCheck(ctx, head, keys)
 	if err != nil {
-		s.samplingResults.purge()
-		s.logger.Printf("%s: failed to parallel check upkeeps", err)
+		s.logger.Printf("%s: failed to parallel check upkeeps; %d partial results retained", err, len(upkeepResults))
 		return
 	}
 
-	s.samplingResults.set(upkeepResults)
+	// all batches for the head are finished; record the head as sampled
+	// even when no results were eligible
+	s.samplingResults.add(head)
+	s.samplingResults.complete(head)
+}
+
+// headHash returns the hash of a head if the head subscriber provides hashes
+// of the heads it delivered
+func (s *onDemandUpkeepService) headHash(head types.BlockKey) string {
+	hasher, ok := s.headSubscriber.(types.HeadHasher)
+	if !ok {
+		return ""
+	}
+
+	hash, _ := hasher.HeadHash(head)
+
+	return hash
 }
 
-func (s *onDemandUpkeepService) parallelCheck(ctx context.Context, keys []types.UpkeepKey) (types.UpkeepResults, error) {
+// parallelCheck checks the provided keys with the worker group and adds
+// eligible results to the sampling results of the head as they are collected.
+// All collected eligible results are also returned.
+func (s *onDemandUpkeepService) parallelCheck(ctx context.Context, head types.BlockKey, keys []types.UpkeepKey) (types.UpkeepResults, error) {
 	samples := newSyncedArray[types.UpkeepResult]()
 
 	if len(keys) == 0 {
@@ -255,7 +400,7 @@ func (s *onDemandUpkeepService) parallelCheck(ctx context.Context, keys []types.
 	// function's context and will terminate when that context is cancelled
 	// resulting in multiple errors being collected by this listener.
 	done := make(chan struct{})
-	go s.aggregateWorkerResults(&wg, &wResults, samples, done)
+	go s.aggregateWorkerResults(&wg, &wResults, head, samples, done)
 
 	// go through keys and check the cache first
 	// if an item doesn't exist on the cache, send the items to the worker threads
@@ -282,6 +427,10 @@ func (s *onDemandUpkeepService) parallelCheck(ctx context.Context, keys []types.
 	}
 	wg.Wait()
 
+	if cached := samples.Values(); len(cached) > 0 {
+		s.samplingResults.add(head, cached...)
+	}
+
 	// Create batches from the given keys.
 	// Max keyBatchSize items in the batch.
 	keysBatches := createBatches(keysToSend, keyBatchSize)
@@ -290,7 +439,7 @@ func (s *onDemandUpkeepService) parallelCheck(ctx context.Context, keys []types.
 		// all jobs should complete before completing the function
 		s.logger.Printf("attempting to send keys to worker group")
 		wg.Add(1)
-		if err := s.workers.Do(ctx, makeWorkerFunc(ctx, s.logger, s.registry, batch)); err != nil {
+		if err := s.workers.Do(ctx, makeWorkerFunc(ctx, s.logger, s.registry, s.limiter, batch)); err != nil {
 			if !errors.Is(err, ErrContextCancelled) {
 				// the worker process has probably stopped so the function
 				// should terminate with an error
@@ -330,7 +479,7 @@ func (s *onDemandUpkeepService) parallelCheck(ctx context.Context, keys []types.
 	return samples.Values(), nil
 }
 
-func (s *onDemandUpkeepService) aggregateWorkerResults(w *sync.WaitGroup, r *workerResults, sa *syncedArray[types.UpkeepResult], done chan struct{}) {
+func (s *onDemandUpkeepService) aggregateWorkerResults(w *sync.WaitGroup, r *workerResults, head types.BlockKey, sa *syncedArray[types.UpkeepResult], done chan struct{}) {
 	s.logger.Printf("starting service to read worker results")
 
 Outer:
@@ -341,13 +490,19 @@ Outer:
 				r.AddSuccess(1)
 
 				// Cache results
+				eligible := make(types.UpkeepResults, 0, len(result.Data))
 				for i := range result.Data {
 					res := result.Data[i]
 					s.cache.Set(string(res.Key), res, util.DefaultCacheExpiration)
 					if res.State == types.Eligible {
 						sa.Append(res)
+						eligible = append(eligible, res)
 					}
 				}
+
+				if len(eligible) > 0 {
+					s.samplingResults.add(head, eligible...)
+				}
 			} else {
 				r.SetLastErr(result.Err)
 				s.logger.Printf("error received from worker result: %s", result.Err)
@@ -361,7 +516,7 @@ Outer:
 	}
 }
 
-func makeWorkerFunc(jobCtx context.Context, logger *log.Logger, registry types.Registry, keys []types.UpkeepKey) work[types.UpkeepResults] {
+func makeWorkerFunc(jobCtx context.Context, logger *log.Logger, registry types.Registry, limiter *rpcLimiter, keys []types.UpkeepKey) work[types.UpkeepResults] {
 	keysStr := upkeepKeysToString(keys)
 	logger.Printf("check upkeep job created for keys: %s", keysStr)
 	return func(serviceCtx context.Context) (types.UpkeepResults, error) {
@@ -387,6 +542,13 @@ func makeWorkerFunc(jobCtx context.Context, logger *log.Logger, registry types.R
 			}
 		}()
 
+		// waiting on the limiter holds the worker such that the number of
+		// workers bounds the calls waiting for the rate limit
+		if err := limiter.Wait(c, samplingPhase, len(keys)); err != nil {
+			done <- struct{}{}
+			return nil, fmt.Errorf("%w: rate limit not met to check upkeep keys: %s", err, keysStr)
+		}
+
 		start := time.Now()
 
 		// perform check and update cache with result
@@ -473,30 +635,191 @@ func (wr *workerResults) FailureRate() float64 {
 	return float64(wr.failure) / float64(wr.total())
 }
 
+// samplingUpkeepsResults holds sampling results for the most recent heads
+// such that a node can observe at a block proposed by the round leader. The
+// history is limited to sampleHistoryLength heads. Results are collected
+// while a sampling job runs and a block is recorded as completed once the job
+// has finished.
 type samplingUpkeepsResults struct {
-	upkeepResults types.UpkeepResults
+	blocks        []types.BlockKey
+	upkeepResults map[types.BlockKey]types.UpkeepResults
+	done          map[types.BlockKey]struct{}
+	// hashes holds the hash of the head sampled at a block when it is known
+	hashes map[types.BlockKey]string
 	sync.Mutex
 }
 
-func (sur *samplingUpkeepsResults) purge() {
+// set replaces the results for the provided block
+func (sur *samplingUpkeepsResults) set(block types.BlockKey, results types.UpkeepResults) {
+	sur.Lock()
+	defer sur.Unlock()
+
+	sur.track(block)
+
+	sur.upkeepResults[block] = make(types.UpkeepResults, len(results))
+	copy(sur.upkeepResults[block], results)
+}
+
+// add appends results to those already collected for the provided block. The
+// block is retained even when no results are provided.
+func (sur *samplingUpkeepsResults) add(block types.BlockKey, results ...types.UpkeepResult) {
+	sur.Lock()
+	defer sur.Unlock()
+
+	sur.track(block)
+
+	sur.upkeepResults[block] = append(sur.upkeepResults[block], results...)
+}
+
+// track records the block as the latest if it is not already retained and
+// evicts the oldest blocks beyond the history length
+func (sur *samplingUpkeepsResults) track(block types.BlockKey) {
+	if sur.upkeepResults == nil {
+		sur.upkeepResults = make(map[types.BlockKey]types.UpkeepResults)
+	}
+
+	if _, ok := sur.upkeepResults[block]; ok {
+		return
+	}
+
+	sur.blocks = append(sur.blocks, block)
+	sur.upkeepResults[block] = make(types.UpkeepResults, 0)
+
+	for len(sur.blocks) > sampleHistoryLength {
+		delete(sur.upkeepResults, sur.blocks[0])
+		delete(sur.done, sur.blocks[0])
+		delete(sur.hashes, sur.blocks[0])
+		sur.blocks = sur.blocks[1:]
+	}
+}
+
+// setHash records the hash of the head sampled at the block and retains the
+// block. An empty hash is not recorded.
+func (sur *samplingUpkeepsResults) setHash(block types.BlockKey, hash string) {
 	sur.Lock()
-	sur.upkeepResults = make(types.UpkeepResults, 0)
-	sur.Unlock()
+	defer sur.Unlock()
+
+	if len(hash) == 0 {
+		return
+	}
+
+	sur.track(block)
+
+	if sur.hashes == nil {
+		sur.hashes = make(map[types.BlockKey]string)
+	}
+
+	sur.hashes[block] = hash
+}
+
+// replaced indicates whether the results retained for the block were sampled
+// at a head with a hash other than the provided hash. Results of a replaced
+// head are removed such that the block can be sampled again. Blocks without
+// a known hash are never replaced.
+func (sur *samplingUpkeepsResults) replaced(block types.BlockKey, hash string) bool {
+	sur.Lock()
+	defer sur.Unlock()
+
+	stored, ok := sur.hashes[block]
+	if !ok || len(hash) == 0 || stored == hash {
+		return false
+	}
+
+	delete(sur.upkeepResults, block)
+	delete(sur.done, block)
+	delete(sur.hashes, block)
+
+	for i := range sur.blocks {
+		if sur.blocks[i] == block {
+			sur.blocks = append(sur.blocks[:i], sur.blocks[i+1:]...)
+			break
+		}
+	}
+
+	return true
 }
 
-func (sur *samplingUpkeepsResults) set(results types.UpkeepResults) {
+// complete records the sampling job of a retained block as finished
+func (sur *samplingUpkeepsResults) complete(block types.BlockKey) {
 	sur.Lock()
-	sur.upkeepResults = make(types.UpkeepResults, len(results))
-	copy(sur.upkeepResults, results)
-	sur.Unlock()
+	defer sur.Unlock()
+
+	if _, ok := sur.upkeepResults[block]; !ok {
+		return
+	}
+
+	if sur.done == nil {
+		sur.done = make(map[types.BlockKey]struct{})
+	}
+
+	sur.done[block] = struct{}{}
 }
 
-func (sur *samplingUpkeepsResults) get() types.UpkeepResults {
+// get returns a copy of the results for the provided block. An empty block
+// returns results for the latest block set.
+func (sur *samplingUpkeepsResults) get(block types.BlockKey) types.UpkeepResults {
 	sur.Lock()
-	results := make(types.UpkeepResults, len(sur.upkeepResults))
-	copy(results, sur.upkeepResults)
-	sur.upkeepResults = make(types.UpkeepResults, 0)
-	sur.Unlock()
+	defer sur.Unlock()
+
+	if len(block) == 0 {
+		if len(sur.blocks) == 0 {
+			return types.UpkeepResults{}
+		}
+
+		block = sur.blocks[len(sur.blocks)-1]
+	}
+
+	stored, ok := sur.upkeepResults[block]
+	if !ok {
+		return types.UpkeepResults{}
+	}
+
+	results := make(types.UpkeepResults, len(stored))
+	copy(results, stored)
 
 	return results
 }
+
+func (sur *samplingUpkeepsResults) latest() (types.BlockKey, bool) {
+	sur.Lock()
+	defer sur.Unlock()
+
+	if len(sur.blocks) == 0 {
+		return "", false
+	}
+
+	return sur.blocks[len(sur.blocks)-1], true
+}
+
+// latestCompleted returns the most recent block with a finished sampling job
+func (sur *samplingUpkeepsResults) latestCompleted() (types.BlockKey, bool) {
+	sur.Lock()
+	defer sur.Unlock()
+
+	for i := len(sur.blocks) - 1; i >= 0; i-- {
+		if _, ok := sur.done[sur.blocks[i]]; ok {
+			return sur.blocks[i], true
+		}
+	}
+
+	return "", false
+}
+
+// has indicates whether results are retained for the block, including
+// partial results of a sampling job that has not finished
+func (sur *samplingUpkeepsResults) has(block types.BlockKey) bool {
+	sur.Lock()
+	defer sur.Unlock()
+
+	_, ok := sur.upkeepResults[block]
+	return ok
+}
+
+// completed indicates whether the sampling job of a retained block finished
+func (sur *samplingUpkeepsResults) completed(block types.BlockKey) bool {
+	sur.Lock()
+	defer sur.Unlock()
+
+	_, ok := sur.done[block]
+	return ok
+}
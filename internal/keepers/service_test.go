@@ -3,9 +3,11 @@ package keepers
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"sync"
 	"testing"
 	"time"
 
@@ -119,17 +121,21 @@ func Test_onDemandUpkeepService_SampleUpkeeps(t *testing.T) {
 		logger:           l,
 		ratio:            sampleRatio(0.5),
 		registry:         rg,
-		shuffler:         new(noShuffleShuffler[ktypes.UpkeepKey]),
+		sampler:          &randomSampler{shuffler: new(noShuffleShuffler[ktypes.UpkeepKey])},
 		cache:            util.NewCache[ktypes.UpkeepResult](1 * time.Second),
-		cacheCleaner:     util.NewIntervalCacheCleaner[types.UpkeepResult](time.Second),
 		workers:          newWorkerGroup[ktypes.UpkeepResults](2, 10),
 		samplingDuration: time.Second * 5,
 	}
 
-	svc.samplingResults.set(returnResults)
+	svc.samplingResults.set(ktypes.BlockKey("1"), returnResults)
 
 	// this test does not include the cache cleaner or log subscriber
-	result, err := svc.SampleUpkeeps(ctx)
+	result, err := svc.SampleUpkeeps(ctx, ktypes.BlockKey("1"))
+	assert.NoError(t, err)
+	assert.Equal(t, returnResults, result)
+
+	// results remain available to every call
+	result, err = svc.SampleUpkeeps(ctx, ktypes.BlockKey("1"))
 	assert.NoError(t, err)
 	assert.Equal(t, returnResults, result)
 
@@ -155,14 +161,13 @@ func Test_onDemandUpkeepService_runSamplingUpkeeps(t *testing.T) {
 		hs := ktypes.NewMockHeadSubscriber(t)
 		subscribed := make(chan struct{}, 1)
 		header := types.BlockKey("1")
-		stopProcs := make(chan struct{})
 
 		hs.On("OnNewHead", mock.Anything, mock.Anything).
 			Run(func(args mock.Arguments) {
 				cb, ok := args.Get(1).(func(blockKey types.BlockKey))
 				assert.True(t, ok)
 				cb(header)
-				<-stopProcs
+				<-args.Get(0).(context.Context).Done()
 			}).Return(nil)
 
 		actives := make([]ktypes.UpkeepKey, 10)
@@ -170,7 +175,7 @@ func Test_onDemandUpkeepService_runSamplingUpkeeps(t *testing.T) {
 			actives[i] = ktypes.UpkeepKey(fmt.Sprintf("1|%d", i+1))
 		}
 
-		rg.Mock.On("GetActiveUpkeepKeys", mock.Anything, types.BlockKey("0")).
+		rg.Mock.On("GetActiveUpkeepKeys", mock.Anything, header).
 			Return(actives, nil)
 
 		returnResults := make(ktypes.UpkeepResults, 5)
@@ -207,12 +212,10 @@ func Test_onDemandUpkeepService_runSamplingUpkeeps(t *testing.T) {
 			headSubscriber:   hs,
 			ratio:            sampleRatio(0.5),
 			registry:         rg,
-			shuffler:         new(noShuffleShuffler[ktypes.UpkeepKey]),
+			sampler:          &randomSampler{shuffler: new(noShuffleShuffler[ktypes.UpkeepKey])},
 			cache:            util.NewCache[ktypes.UpkeepResult](1 * time.Second),
-			cacheCleaner:     util.NewIntervalCacheCleaner[types.UpkeepResult](time.Second),
 			workers:          newWorkerGroup[ktypes.UpkeepResults](2, 10),
 			samplingDuration: time.Second * 5,
-			stopProcs:        stopProcs,
 		}
 
 		// Start all required processes
@@ -227,7 +230,7 @@ func Test_onDemandUpkeepService_runSamplingUpkeeps(t *testing.T) {
 		var actualResults types.UpkeepResults
 		for i := 0; i < 5; i++ {
 			time.Sleep(time.Second)
-			actualResults = svc.samplingResults.get()
+			actualResults = svc.samplingResults.get(header)
 			if len(actualResults) > 0 {
 				break
 			}
@@ -246,17 +249,16 @@ func Test_onDemandUpkeepService_runSamplingUpkeeps(t *testing.T) {
 		hs := ktypes.NewMockHeadSubscriber(t)
 		subscribed := make(chan struct{}, 1)
 		header := types.BlockKey("1")
-		stopProcs := make(chan struct{})
 
 		hs.On("OnNewHead", mock.Anything, mock.Anything).
 			Run(func(args mock.Arguments) {
 				cb, ok := args.Get(1).(func(blockKey types.BlockKey))
 				assert.True(t, ok)
 				cb(header)
-				<-stopProcs
+				<-args.Get(0).(context.Context).Done()
 			}).Return(nil)
 
-		rg.Mock.On("GetActiveUpkeepKeys", mock.Anything, ktypes.BlockKey("0")).
+		rg.Mock.On("GetActiveUpkeepKeys", mock.Anything, header).
 			Run(func(args mock.Arguments) {
 				close(subscribed)
 			}).
@@ -269,10 +271,8 @@ func Test_onDemandUpkeepService_runSamplingUpkeeps(t *testing.T) {
 			registry:         rg,
 			headSubscriber:   hs,
 			cache:            util.NewCache[ktypes.UpkeepResult](20 * time.Millisecond),
-			cacheCleaner:     util.NewIntervalCacheCleaner[types.UpkeepResult](time.Second),
 			workers:          newWorkerGroup[ktypes.UpkeepResults](2, 10),
 			samplingDuration: time.Second * 5,
-			stopProcs:        stopProcs,
 		}
 
 		// Start background processes
@@ -294,14 +294,13 @@ func Test_onDemandUpkeepService_runSamplingUpkeeps(t *testing.T) {
 		hs := ktypes.NewMockHeadSubscriber(t)
 		subscribed := make(chan struct{}, 1)
 		header := types.BlockKey("1")
-		stopProcs := make(chan struct{})
 
 		hs.On("OnNewHead", mock.Anything, mock.Anything).
 			Run(func(args mock.Arguments) {
 				cb, ok := args.Get(1).(func(blockKey types.BlockKey))
 				assert.True(t, ok)
 				cb(header)
-				<-stopProcs
+				<-args.Get(0).(context.Context).Done()
 			}).Return(nil)
 
 		actives := make([]ktypes.UpkeepKey, 10)
@@ -309,7 +308,7 @@ func Test_onDemandUpkeepService_runSamplingUpkeeps(t *testing.T) {
 			actives[i] = ktypes.UpkeepKey(fmt.Sprintf("1|%d", i+1))
 		}
 
-		rg.Mock.On("GetActiveUpkeepKeys", mock.Anything, ktypes.BlockKey("0")).
+		rg.Mock.On("GetActiveUpkeepKeys", mock.Anything, header).
 			Return(actives, nil)
 
 		rg.Mock.On("CheckUpkeep", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
@@ -332,12 +331,10 @@ func Test_onDemandUpkeepService_runSamplingUpkeeps(t *testing.T) {
 			headSubscriber:   hs,
 			ratio:            sampleRatio(0.5),
 			registry:         rg,
-			shuffler:         new(noShuffleShuffler[ktypes.UpkeepKey]),
+			sampler:          &randomSampler{shuffler: new(noShuffleShuffler[ktypes.UpkeepKey])},
 			cache:            util.NewCache[ktypes.UpkeepResult](1 * time.Second),
-			cacheCleaner:     util.NewIntervalCacheCleaner[types.UpkeepResult](time.Second),
 			workers:          newWorkerGroup[ktypes.UpkeepResults](2, 10),
 			samplingDuration: time.Second * 5,
-			stopProcs:        stopProcs,
 		}
 
 		// Start background processes
@@ -358,8 +355,368 @@ func Test_onDemandUpkeepService_runSamplingUpkeeps(t *testing.T) {
 	})
 }
 
+func Test_onDemandUpkeepService_RecoverSamplingPanic(t *testing.T) {
+	rg := ktypes.NewMockRegistry(t)
+	hs := ktypes.NewMockHeadSubscriber(t)
+	panicked := make(chan struct{})
+
+	hs.On("OnNewHead", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			cb := args.Get(1).(func(blockKey types.BlockKey))
+			cb(ktypes.BlockKey("1"))
+			<-panicked
+			cb(ktypes.BlockKey("2"))
+			<-args.Get(0).(context.Context).Done()
+		}).Return(nil)
+
+	rg.Mock.On("GetActiveUpkeepKeys", mock.Anything, ktypes.BlockKey("1")).
+		Run(func(_ mock.Arguments) {
+			close(panicked)
+			panic("bad rpc response")
+		})
+	rg.Mock.On("GetActiveUpkeepKeys", mock.Anything, ktypes.BlockKey("2")).
+		Return([]ktypes.UpkeepKey{}, nil)
+
+	svc := &onDemandUpkeepService{
+		logger:           log.New(io.Discard, "", 0),
+		headSubscriber:   hs,
+		ratio:            sampleRatio(0.5),
+		registry:         rg,
+		cache:            util.NewCache[ktypes.UpkeepResult](time.Second),
+		workers:          newWorkerGroup[ktypes.UpkeepResults](2, 10),
+		samplingDuration: time.Second,
+	}
+
+	svc.start()
+	defer svc.stop()
+
+	// the sampling process is restarted and samples the next head
+	assert.Eventually(t, func() bool {
+		return svc.HasSampledBlock(ktypes.BlockKey("2"))
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, svc.supervisor.Healthy())
+}
+
+func Test_onDemandUpkeepService_Healthy(t *testing.T) {
+	rg := ktypes.NewMockRegistry(t)
+	hs := ktypes.NewMockHeadSubscriber(t)
+
+	hs.On("OnNewHead", mock.Anything, mock.Anything).Return(fmt.Errorf("subscription failed"))
+
+	svc := &onDemandUpkeepService{
+		logger:           log.New(io.Discard, "", 0),
+		headSubscriber:   hs,
+		ratio:            sampleRatio(0.5),
+		registry:         rg,
+		cache:            util.NewCache[ktypes.UpkeepResult](time.Second),
+		workers:          newWorkerGroup[ktypes.UpkeepResults](2, 10),
+		samplingDuration: time.Second,
+	}
+
+	assert.NoError(t, svc.Healthy())
+
+	svc.start()
+	defer svc.stop()
+
+	// the failed head subscription is reported until it is restarted
+	var err error
+	assert.Eventually(t, func() bool {
+		err = svc.Healthy()
+		return errors.Is(err, util.ErrTaskUnhealthy)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.ErrorContains(t, err, "upkeep service head subscription")
+}
+
+func Test_onDemandUpkeepService_processLatestHead(t *testing.T) {
+	actives := make([]ktypes.UpkeepKey, 2*keyBatchSize)
+	for i := range actives {
+		actives[i] = ktypes.UpkeepKey(fmt.Sprintf("2|%d", i+1))
+	}
+
+	eligible := ktypes.UpkeepResult{Key: actives[0], State: types.Eligible, PerformData: []byte("1")}
+
+	newService := func(rg *ktypes.MockRegistry) *onDemandUpkeepService {
+		return &onDemandUpkeepService{
+			logger:           log.New(io.Discard, "", 0),
+			ratio:            sampleRatio(1),
+			registry:         rg,
+			sampler:          &randomSampler{shuffler: new(noShuffleShuffler[ktypes.UpkeepKey])},
+			cache:            util.NewCache[ktypes.UpkeepResult](time.Second),
+			workers:          newWorkerGroup[ktypes.UpkeepResults](2, 10),
+			samplingDuration: 100 * time.Millisecond,
+		}
+	}
+
+	t.Run("partial results are retained", func(t *testing.T) {
+		rg := ktypes.NewMockRegistry(t)
+		svc := newService(rg)
+
+		svc.samplingResults.set(ktypes.BlockKey("1"), ktypes.UpkeepResults{{Key: ktypes.UpkeepKey("1|1"), State: types.Eligible}})
+
+		rg.Mock.On("GetActiveUpkeepKeys", mock.Anything, ktypes.BlockKey("2")).Return(actives, nil)
+
+		args := make([]interface{}, keyBatchSize+1)
+		args[0] = mock.Anything
+		for i := 1; i < len(args); i++ {
+			args[i] = mock.Anything
+		}
+
+		// the first batch succeeds and the second runs until the sampling
+		// duration elapses
+		rg.Mock.On("CheckUpkeep", args...).
+			Return(func(ctx context.Context, keys ...ktypes.UpkeepKey) ktypes.UpkeepResults {
+				for _, key := range keys {
+					if bytes.Equal(key, eligible.Key) {
+						return ktypes.UpkeepResults{eligible}
+					}
+				}
+
+				<-ctx.Done()
+				return nil
+			}, func(ctx context.Context, keys ...ktypes.UpkeepKey) error {
+				return ctx.Err()
+			}).Times(2)
+
+		svc.processLatestHead(context.Background(), ktypes.BlockKey("2"))
+
+		latest, ok := svc.samplingResults.latest()
+		assert.True(t, ok)
+		assert.Equal(t, ktypes.BlockKey("2"), latest)
+
+		// results are available to every observation
+		for i := 0; i < 2; i++ {
+			results, err := svc.SampleUpkeeps(context.Background(), ktypes.BlockKey(""))
+			assert.NoError(t, err)
+			assert.Equal(t, ktypes.UpkeepResults{eligible}, results)
+		}
+
+		// an already sampled head is not sampled again
+		svc.processLatestHead(context.Background(), ktypes.BlockKey("2"))
+	})
+
+	t.Run("head is not proposed until all batches finish", func(t *testing.T) {
+		rg := ktypes.NewMockRegistry(t)
+		svc := newService(rg)
+		svc.samplingDuration = 5 * time.Second
+
+		svc.samplingResults.set(ktypes.BlockKey("1"), nil)
+		svc.samplingResults.complete(ktypes.BlockKey("1"))
+
+		rg.Mock.On("GetActiveUpkeepKeys", mock.Anything, ktypes.BlockKey("2")).Return(actives, nil)
+
+		args := make([]interface{}, keyBatchSize+1)
+		for i := range args {
+			args[i] = mock.Anything
+		}
+
+		// the first batch succeeds and the second waits until it is released
+		release := make(chan struct{})
+		rg.Mock.On("CheckUpkeep", args...).
+			Return(func(ctx context.Context, keys ...ktypes.UpkeepKey) ktypes.UpkeepResults {
+				for _, key := range keys {
+					if bytes.Equal(key, eligible.Key) {
+						return ktypes.UpkeepResults{eligible}
+					}
+				}
+
+				<-release
+				return ktypes.UpkeepResults{}
+			}, func(ctx context.Context, keys ...ktypes.UpkeepKey) error {
+				return nil
+			}).Times(2)
+
+		done := make(chan struct{})
+		go func() {
+			svc.processLatestHead(context.Background(), ktypes.BlockKey("2"))
+			close(done)
+		}()
+
+		// partial results are available while the slow batch runs
+		assert.Eventually(t, func() bool {
+			results, err := svc.SampleUpkeeps(context.Background(), ktypes.BlockKey("2"))
+			return err == nil && len(results) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		// the leader proposes the latest completed head
+		assert.False(t, svc.HasSampledBlock(ktypes.BlockKey("2")))
+
+		proposed, ok := svc.LatestSampledBlock()
+		assert.True(t, ok)
+		assert.Equal(t, ktypes.BlockKey("1"), proposed)
+
+		close(release)
+		<-done
+
+		assert.True(t, svc.HasSampledBlock(ktypes.BlockKey("2")))
+
+		proposed, ok = svc.LatestSampledBlock()
+		assert.True(t, ok)
+		assert.Equal(t, ktypes.BlockKey("2"), proposed)
+	})
+
+	t.Run("head replaced at the same height is sampled again", func(t *testing.T) {
+		rg := ktypes.NewMockRegistry(t)
+		hs := &hashedHeadSubscriber{hashes: map[ktypes.BlockKey]string{"2": "0xa"}}
+
+		svc := newService(rg)
+		svc.headSubscriber = hs
+
+		key := ktypes.UpkeepKey("2|1")
+		replaced := ktypes.UpkeepResult{Key: key, State: types.Eligible, PerformData: []byte("a")}
+		canonical := ktypes.UpkeepResult{Key: key, State: types.Eligible, PerformData: []byte("b")}
+
+		rg.Mock.On("GetActiveUpkeepKeys", mock.Anything, ktypes.BlockKey("2")).Return([]ktypes.UpkeepKey{key}, nil).Times(2)
+		rg.Mock.On("CheckUpkeep", mock.Anything, key).Return(ktypes.UpkeepResults{replaced}, nil).Once()
+		rg.Mock.On("CheckUpkeep", mock.Anything, key).Return(ktypes.UpkeepResults{canonical}, nil).Once()
+
+		svc.processLatestHead(context.Background(), ktypes.BlockKey("2"))
+
+		results, err := svc.SampleUpkeeps(context.Background(), ktypes.BlockKey("2"))
+		assert.NoError(t, err)
+		assert.Equal(t, ktypes.UpkeepResults{replaced}, results)
+
+		// the same head is not sampled again
+		svc.processLatestHead(context.Background(), ktypes.BlockKey("2"))
+
+		// a head with a new hash at the same height replaces the results
+		hs.setHash(ktypes.BlockKey("2"), "0xb")
+		svc.processLatestHead(context.Background(), ktypes.BlockKey("2"))
+
+		assert.True(t, svc.HasSampledBlock(ktypes.BlockKey("2")))
+
+		results, err = svc.SampleUpkeeps(context.Background(), ktypes.BlockKey("2"))
+		assert.NoError(t, err)
+		assert.Equal(t, ktypes.UpkeepResults{canonical}, results)
+	})
+
+	t.Run("previous results are retained without new results", func(t *testing.T) {
+		rg := ktypes.NewMockRegistry(t)
+		svc := newService(rg)
+
+		previous := ktypes.UpkeepResults{{Key: ktypes.UpkeepKey("1|1"), State: types.Eligible}}
+		svc.samplingResults.set(ktypes.BlockKey("1"), previous)
+
+		rg.Mock.On("GetActiveUpkeepKeys", mock.Anything, ktypes.BlockKey("2")).Return(nil, fmt.Errorf("contract error"))
+
+		svc.processLatestHead(context.Background(), ktypes.BlockKey("2"))
+
+		latest, ok := svc.samplingResults.latest()
+		assert.True(t, ok)
+		assert.Equal(t, ktypes.BlockKey("1"), latest)
+		assert.False(t, svc.HasSampledBlock(ktypes.BlockKey("2")))
+
+		results, err := svc.SampleUpkeeps(context.Background(), ktypes.BlockKey(""))
+		assert.NoError(t, err)
+		assert.Equal(t, previous, results)
+	})
+}
+
+func Test_samplingUpkeepsResults(t *testing.T) {
+	var sur samplingUpkeepsResults
+
+	_, ok := sur.latest()
+	assert.False(t, ok)
+
+	for i := 1; i <= sampleHistoryLength+2; i++ {
+		sur.set(ktypes.BlockKey(fmt.Sprintf("%d", i)), ktypes.UpkeepResults{{Key: ktypes.UpkeepKey(fmt.Sprintf("%d|1", i))}})
+	}
+
+	latest, ok := sur.latest()
+	assert.True(t, ok)
+	assert.Equal(t, ktypes.BlockKey(fmt.Sprintf("%d", sampleHistoryLength+2)), latest)
+
+	// oldest blocks are evicted from the history
+	assert.False(t, sur.has(ktypes.BlockKey("1")))
+	assert.False(t, sur.has(ktypes.BlockKey("2")))
+	assert.True(t, sur.has(ktypes.BlockKey("3")))
+
+	assert.Equal(t, ktypes.UpkeepResults{{Key: ktypes.UpkeepKey("3|1")}}, sur.get(ktypes.BlockKey("3")))
+	assert.Equal(t, ktypes.UpkeepResults{{Key: ktypes.UpkeepKey("3|1")}}, sur.get(ktypes.BlockKey("3")))
+
+	// an empty block key returns the latest results
+	assert.Equal(t, ktypes.UpkeepResults{{Key: ktypes.UpkeepKey(fmt.Sprintf("%d|1", sampleHistoryLength+2))}}, sur.get(""))
+
+	sur.set(ktypes.BlockKey("4"), nil)
+	assert.True(t, sur.has(ktypes.BlockKey("4")))
+	assert.Len(t, sur.get(ktypes.BlockKey("4")), 0)
+
+	// results are added incrementally and a new block becomes the latest
+	next := ktypes.BlockKey(fmt.Sprintf("%d", sampleHistoryLength+3))
+	sur.add(next)
+	assert.True(t, sur.has(next))
+	assert.Len(t, sur.get(""), 0)
+
+	sur.add(next, ktypes.UpkeepResult{Key: ktypes.UpkeepKey("13|1")})
+	sur.add(next, ktypes.UpkeepResult{Key: ktypes.UpkeepKey("13|2")})
+	assert.Equal(t, ktypes.UpkeepResults{{Key: ktypes.UpkeepKey("13|1")}, {Key: ktypes.UpkeepKey("13|2")}}, sur.get(next))
+	assert.False(t, sur.has(ktypes.BlockKey("3")))
+
+	// only blocks with a finished sampling job are completed
+	_, ok = sur.latestCompleted()
+	assert.False(t, ok)
+	assert.False(t, sur.completed(next))
+
+	sur.complete(ktypes.BlockKey("5"))
+	sur.complete(ktypes.BlockKey("3"))
+
+	latest, ok = sur.latestCompleted()
+	assert.True(t, ok)
+	assert.Equal(t, ktypes.BlockKey("5"), latest)
+	assert.False(t, sur.completed(ktypes.BlockKey("3")))
+
+	sur.complete(next)
+
+	latest, ok = sur.latestCompleted()
+	assert.True(t, ok)
+	assert.Equal(t, next, latest)
+	assert.True(t, sur.completed(next))
+}
+
+// hashedHeadSubscriber provides hashes of heads; heads are delivered by
+// calling processLatestHead directly
+type hashedHeadSubscriber struct {
+	mu     sync.Mutex
+	hashes map[ktypes.BlockKey]string
+}
+
+func (hs *hashedHeadSubscriber) OnNewHead(ctx context.Context, _ func(ktypes.BlockKey)) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (hs *hashedHeadSubscriber) HeadHash(block ktypes.BlockKey) (string, bool) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hash, ok := hs.hashes[block]
+	return hash, ok
+}
+
+func (hs *hashedHeadSubscriber) setHash(block ktypes.BlockKey, hash string) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hs.hashes[block] = hash
+}
+
 type noShuffleShuffler[T any] struct{}
 
 func (_ *noShuffleShuffler[T]) Shuffle(a []T) []T {
 	return a
 }
+
+func Test_onDemandUpkeepService_CachedUpkeep(t *testing.T) {
+	cached := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("1|1"), State: ktypes.Eligible, PerformData: []byte("1")}
+
+	svc := &onDemandUpkeepService{
+		cache: util.NewCache[ktypes.UpkeepResult](time.Second),
+	}
+	svc.cache.Set(string(cached.Key), cached, util.DefaultCacheExpiration)
+
+	results, missed := svc.CachedUpkeep(cached.Key, ktypes.UpkeepKey("1|2"))
+
+	assert.Equal(t, ktypes.UpkeepResults{cached}, results)
+	assert.Equal(t, []ktypes.UpkeepKey{ktypes.UpkeepKey("1|2")}, missed)
+}
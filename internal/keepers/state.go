@@ -0,0 +1,75 @@
+package keepers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.uber.org/multierr"
+
+	"github.com/smartcontractkit/ocr2keepers/internal/util"
+	"github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+// registryState is the state of a registry that outlives plugin instances.
+// OCR replaces the plugin instance on each config change. Carrying check
+// results and transmit lockouts over to the new instance prevents upkeeps
+// from being performed twice around a config change.
+type registryState struct {
+	cache        *util.Cache[types.UpkeepResult]
+	cacheCleaner *util.IntervalCacheCleaner[types.UpkeepResult]
+	coordinator  *reportCoordinator
+	supervisor   *util.Supervisor
+}
+
+func newRegistryState(
+	registry types.Registry,
+	logs types.PerformLogProvider,
+	store types.CoordinatorStore,
+	logger *log.Logger,
+	cacheExpire time.Duration,
+	cacheClean time.Duration,
+	lockoutWindow time.Duration,
+	minConfs int,
+	reorgDepth int64,
+) (*registryState, error) {
+	coordinator, err := newReportCoordinator(registry, lockoutWindow, cacheClean, logs, store, minConfs, reorgDepth, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &registryState{
+		cache:        util.NewCache[types.UpkeepResult](cacheExpire),
+		cacheCleaner: util.NewIntervalCacheCleaner[types.UpkeepResult](cacheClean),
+		coordinator:  coordinator,
+		supervisor:   util.NewSupervisor(logger, util.DefaultMinRestartBackoff, util.DefaultMaxRestartBackoff),
+	}
+
+	s.supervisor.Go("upkeep service cache cleaner", func(_ context.Context) error {
+		s.cacheCleaner.Run(s.cache)
+		return nil
+	})
+
+	return s, nil
+}
+
+// configure applies the offchain config of a new plugin instance to the
+// existing state
+func (s *registryState) configure(lockoutWindow time.Duration, minConfs int, reorgDepth int64) {
+	s.coordinator.configure(lockoutWindow, minConfs, reorgDepth)
+}
+
+// Healthy returns an error naming the failed background processes of the
+// cache cleaner and the report coordinator
+func (s *registryState) Healthy() error {
+	return multierr.Combine(s.supervisor.Healthy(), s.coordinator.Healthy())
+}
+
+// Close stops the cache cleaner and the report coordinator and returns once
+// their go-routines have exited
+func (s *registryState) Close() error {
+	s.cacheCleaner.Stop()
+	s.supervisor.Stop()
+
+	return s.coordinator.Close()
+}
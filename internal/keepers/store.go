@@ -0,0 +1,285 @@
+package keepers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+
+	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+const (
+	// minCompactionRecords is the min number of records written to a file
+	// store before the file is compacted
+	minCompactionRecords = 1_000
+)
+
+var (
+	ErrStoreClosed = fmt.Errorf("coordinator store closed")
+)
+
+var (
+	_ ktypes.CoordinatorStore = (*MemoryCoordinatorStore)(nil)
+	_ ktypes.CoordinatorStore = (*FileCoordinatorStore)(nil)
+)
+
+// coordinatorRecordID identifies the record that a new record replaces
+type coordinatorRecordID struct {
+	recordType ktypes.CoordinatorRecordType
+	key        string
+}
+
+func recordID(r ktypes.CoordinatorRecord) coordinatorRecordID {
+	return coordinatorRecordID{recordType: r.Type, key: string(r.Key)}
+}
+
+// MemoryCoordinatorStore keeps the records of the report coordinator in
+// memory. Records do not survive a restart of the node.
+type MemoryCoordinatorStore struct {
+	mu      sync.Mutex
+	records map[coordinatorRecordID]ktypes.CoordinatorRecord
+}
+
+func NewMemoryCoordinatorStore() *MemoryCoordinatorStore {
+	return &MemoryCoordinatorStore{
+		records: make(map[coordinatorRecordID]ktypes.CoordinatorRecord),
+	}
+}
+
+// Load returns the records that have not expired and removes expired records
+func (s *MemoryCoordinatorStore) Load() ([]ktypes.CoordinatorRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	records := make([]ktypes.CoordinatorRecord, 0, len(s.records))
+
+	for id, record := range s.records {
+		if record.Expired(now) {
+			delete(s.records, id)
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func (s *MemoryCoordinatorStore) Store(record ktypes.CoordinatorRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[recordID(record)] = record
+
+	return nil
+}
+
+// FileCoordinatorStore persists the records of the report coordinator to an
+// append-only file with one JSON encoded record per line. A record replaces
+// earlier records of the same type and key. The file is compacted to the
+// records that have not expired when it is opened and each time the number
+// of records written to the file doubles. Records are written to the file
+// before Store returns but the file is not synced on each write.
+type FileCoordinatorStore struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	records map[coordinatorRecordID]ktypes.CoordinatorRecord
+	// written is the number of records in the file
+	written int
+	// compactAt is the number of records in the file that triggers the next
+	// compaction
+	compactAt int
+}
+
+// NewFileCoordinatorStore opens the store at the provided path and loads
+// the records in the file. The file is created if it does not exist.
+func NewFileCoordinatorStore(path string) (*FileCoordinatorStore, error) {
+	s := &FileCoordinatorStore{
+		path:    path,
+		records: make(map[coordinatorRecordID]ktypes.CoordinatorRecord),
+	}
+
+	if err := s.read(); err != nil {
+		return nil, fmt.Errorf("%w: failed to read coordinator store '%s'", err, path)
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, fmt.Errorf("%w: failed to compact coordinator store '%s'", err, path)
+	}
+
+	return s, nil
+}
+
+// Load returns the records that have not expired
+func (s *FileCoordinatorStore) Load() ([]ktypes.CoordinatorRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	records := make([]ktypes.CoordinatorRecord, 0, len(s.records))
+
+	for _, record := range s.records {
+		if !record.Expired(now) {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+// Store appends the record to the file
+func (s *FileCoordinatorStore) Store(record ktypes.CoordinatorRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return ErrStoreClosed
+	}
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("%w: failed to encode coordinator record", err)
+	}
+
+	if _, err := s.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("%w: failed to write coordinator record", err)
+	}
+
+	s.records[recordID(record)] = record
+	s.written++
+
+	if s.written >= s.compactAt {
+		if err := s.compact(); err != nil {
+			return fmt.Errorf("%w: failed to compact coordinator store", err)
+		}
+	}
+
+	return nil
+}
+
+// Close closes the file. Records cannot be stored after the store is
+// closed.
+func (s *FileCoordinatorStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+// read loads the records in the file. A malformed last line is the result
+// of an interrupted write and is ignored.
+func (s *FileCoordinatorStore) read() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var (
+		scanner   = bufio.NewScanner(f)
+		line      int
+		malformed error
+	)
+
+	for scanner.Scan() {
+		line++
+
+		if malformed != nil {
+			return malformed
+		}
+
+		var record ktypes.CoordinatorRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			malformed = fmt.Errorf("%w: malformed record on line %d", err, line)
+			continue
+		}
+
+		s.records[recordID(record)] = record
+	}
+
+	return scanner.Err()
+}
+
+// compact replaces the file with a file of the records that have not expired.
+// The compacted file is opened for appending before it replaces the file such
+// that the store keeps writing to the current file when compaction fails.
+func (s *FileCoordinatorStore) compact() error {
+	now := time.Now()
+	tmp := s.path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	// discard removes the compacted file when it does not replace the file
+	discard := func(err error) error {
+		return multierr.Combine(err, f.Close(), os.Remove(tmp))
+	}
+
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+
+	var written int
+	for id, record := range s.records {
+		if record.Expired(now) {
+			delete(s.records, id)
+			continue
+		}
+
+		if err := encoder.Encode(record); err != nil {
+			return discard(err)
+		}
+
+		written++
+	}
+
+	if err := w.Flush(); err != nil {
+		return discard(err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return discard(err)
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return discard(err)
+	}
+
+	// new records are appended to the compacted file and the replaced file
+	// is no longer written to
+	replaced := s.file
+	s.file = f
+
+	s.written = written
+	s.compactAt = 2 * written
+	if s.compactAt < minCompactionRecords {
+		s.compactAt = minCompactionRecords
+	}
+
+	if replaced != nil {
+		return replaced.Close()
+	}
+
+	return nil
+}
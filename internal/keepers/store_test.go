@@ -0,0 +1,175 @@
+package keepers
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+func TestMemoryCoordinatorStore(t *testing.T) {
+	s := NewMemoryCoordinatorStore()
+
+	require.NoError(t, s.Store(ktypes.CoordinatorRecord{Type: ktypes.TransmitRecord, Key: []byte("1|1")}))
+	require.NoError(t, s.Store(ktypes.CoordinatorRecord{Type: ktypes.TransmitRecord, Key: []byte("1|1"), Confirmed: true}))
+	require.NoError(t, s.Store(ktypes.CoordinatorRecord{Type: ktypes.IDLockoutRecord, Key: []byte("1|1")}))
+	require.NoError(t, s.Store(ktypes.CoordinatorRecord{Type: ktypes.IDLockoutRecord, Key: []byte("2"), Expires: time.Now().Add(-time.Second)}))
+
+	// a record replaces a record of the same type and key and expired
+	// records are not loaded
+	records, err := s.Load()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []ktypes.CoordinatorRecord{
+		{Type: ktypes.TransmitRecord, Key: []byte("1|1"), Confirmed: true},
+		{Type: ktypes.IDLockoutRecord, Key: []byte("1|1")},
+	}, records)
+	assert.Len(t, s.records, 2)
+}
+
+func TestFileCoordinatorStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coordinator.log")
+	expires := time.Now().Add(time.Hour).Round(0)
+
+	s, err := NewFileCoordinatorStore(path)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Store(ktypes.CoordinatorRecord{Type: ktypes.IDLockoutRecord, Key: []byte("1"), Expires: expires}))
+	require.NoError(t, s.Store(ktypes.CoordinatorRecord{Type: ktypes.TransmitRecord, Key: []byte("1|1"), Expires: expires}))
+	require.NoError(t, s.Store(ktypes.CoordinatorRecord{Type: ktypes.IDLockoutRecord, Key: []byte("1"), Block: "2", Expires: expires}))
+	require.NoError(t, s.Store(ktypes.CoordinatorRecord{Type: ktypes.TransmitRecord, Key: []byte("1|2"), Expires: time.Now().Add(-time.Second)}))
+	require.NoError(t, s.Close())
+
+	assert.ErrorIs(t, s.Store(ktypes.CoordinatorRecord{Type: ktypes.TransmitRecord, Key: []byte("1|3")}), ErrStoreClosed)
+
+	expected := []ktypes.CoordinatorRecord{
+		{Type: ktypes.IDLockoutRecord, Key: []byte("1"), Block: "2", Expires: expires},
+		{Type: ktypes.TransmitRecord, Key: []byte("1|1"), Expires: expires},
+	}
+
+	// records are restored when the store is opened again
+	s, err = NewFileCoordinatorStore(path)
+	require.NoError(t, err)
+
+	records, err := s.Load()
+	require.NoError(t, err)
+	assertRecords(t, expected, records)
+	require.NoError(t, s.Close())
+
+	// the file was compacted to the records that have not expired
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, splitLines(b), 2)
+
+	t.Run("Interrupted Write", func(t *testing.T) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(`{"type":2,"key":"1|`))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		s, err := NewFileCoordinatorStore(path)
+		require.NoError(t, err)
+
+		records, err := s.Load()
+		require.NoError(t, err)
+		assertRecords(t, expected, records)
+		require.NoError(t, s.Close())
+	})
+
+	t.Run("Malformed Record", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "coordinator.log")
+		require.NoError(t, os.WriteFile(path, []byte("malformed\n{\"type\":2,\"key\":\"1|1\"}\n"), 0o600))
+
+		_, err := NewFileCoordinatorStore(path)
+		assert.Error(t, err)
+	})
+}
+
+func TestFileCoordinatorStore_Compaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coordinator.log")
+
+	s, err := NewFileCoordinatorStore(path)
+	require.NoError(t, err)
+
+	defer s.Close()
+
+	// replacing the same record compacts the file once the min number of
+	// records is written
+	for i := 0; i < minCompactionRecords; i++ {
+		require.NoError(t, s.Store(ktypes.CoordinatorRecord{Type: ktypes.IDLockoutRecord, Key: []byte("1")}))
+	}
+
+	assert.Equal(t, 1, s.written)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, splitLines(b), 1)
+}
+
+func TestFileCoordinatorStore_CompactionRenameFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coordinator.log")
+
+	s, err := NewFileCoordinatorStore(path)
+	require.NoError(t, err)
+
+	defer s.Close()
+
+	require.NoError(t, s.Store(ktypes.CoordinatorRecord{Type: ktypes.IDLockoutRecord, Key: []byte("1")}))
+
+	// a non-empty directory at the path of the file cannot be replaced by
+	// the compacted file
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.Mkdir(path, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "blocker"), nil, 0o600))
+
+	assert.Error(t, s.compact())
+	assert.NoFileExists(t, path+".tmp")
+
+	// the store keeps writing to the current file
+	require.NotNil(t, s.file)
+	assert.NoError(t, s.Store(ktypes.CoordinatorRecord{Type: ktypes.IDLockoutRecord, Key: []byte("2")}))
+
+	require.NoError(t, os.RemoveAll(path))
+	require.NoError(t, s.compact())
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, splitLines(b), 2)
+
+	assert.NoError(t, s.Store(ktypes.CoordinatorRecord{Type: ktypes.IDLockoutRecord, Key: []byte("3")}))
+
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, splitLines(b), 3)
+}
+
+func assertRecords(t *testing.T, expected, actual []ktypes.CoordinatorRecord) {
+	t.Helper()
+
+	require.Len(t, actual, len(expected))
+
+	for _, e := range expected {
+		var found bool
+		for _, a := range actual {
+			if a.Type == e.Type && bytes.Equal(a.Key, e.Key) {
+				found = true
+				assert.Equal(t, e.Block, a.Block)
+				assert.Equal(t, e.Confirmed, a.Confirmed)
+				assert.True(t, e.Expires.Equal(a.Expires))
+			}
+		}
+
+		assert.True(t, found, "record %s not found", e.Key)
+	}
+}
+
+func splitLines(b []byte) []string {
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
@@ -0,0 +1,271 @@
+package keepers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	rnd "math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smartcontractkit/libocr/offchainreporting2/types"
+	"golang.org/x/crypto/sha3"
+
+	"github.com/smartcontractkit/ocr2keepers/internal/util"
+	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+// observationTruncator orders the eligible results of an observation. The
+// observation keeps a prefix of the ordered results that fits in the max
+// observation length.
+type observationTruncator interface {
+	// Order returns the results in the order they are added to the
+	// observation
+	Order(rt types.ReportTimestamp, results ktypes.UpkeepResults) ktypes.UpkeepResults
+	// Observed records the results kept in the observation
+	Observed(kept ktypes.UpkeepResults)
+}
+
+func newObservationTruncator(policy ktypes.ObservationTruncation, registry ktypes.Registry, lastPerformed func(ktypes.UpkeepIdentifier) (time.Time, bool)) (observationTruncator, error) {
+	switch policy {
+	case ktypes.TruncateSorted:
+		return &sortedTruncator{registry: registry}, nil
+	case ktypes.TruncateRotating:
+		return &rotatingTruncator{registry: registry}, nil
+	case ktypes.TruncateRandom:
+		return &randomTruncator{registry: registry}, nil
+	case ktypes.TruncateLeastRecentlyPerformed:
+		return &leastRecentlyPerformedTruncator{registry: registry, lastPerformed: lastPerformed}, nil
+	default:
+		return nil, fmt.Errorf("unknown observation truncation '%s'", policy)
+	}
+}
+
+// sortedTruncator orders results by key
+type sortedTruncator struct {
+	registry ktypes.Registry
+}
+
+func (t *sortedTruncator) Order(_ types.ReportTimestamp, results ktypes.UpkeepResults) ktypes.UpkeepResults {
+	return sortedResults(results, t.registry)
+}
+
+func (t *sortedTruncator) Observed(_ ktypes.UpkeepResults) {}
+
+// rotatingTruncator orders results by upkeep id starting after the last id
+// kept in the previous observation. ids are ordered by value such that the
+// order does not depend on the block of the key. Results with keys that
+// cannot be parsed are added last.
+type rotatingTruncator struct {
+	registry ktypes.Registry
+	mu       sync.Mutex
+	last     ktypes.UpkeepIdentifier
+}
+
+func (t *rotatingTruncator) Order(_ types.ReportTimestamp, results ktypes.UpkeepResults) ktypes.UpkeepResults {
+	type idResult struct {
+		id     ktypes.UpkeepIdentifier
+		result ktypes.UpkeepResult
+	}
+
+	ordered := make([]idResult, 0, len(results))
+	unparsed := make(ktypes.UpkeepResults, 0)
+
+	// results for the same id are kept in key order
+	for _, result := range sortedResults(results, t.registry) {
+		id, err := t.registry.IdentifierFromKey(result.Key)
+		if err != nil {
+			unparsed = append(unparsed, result)
+			continue
+		}
+
+		ordered = append(ordered, idResult{id: id, result: result})
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return compareIdentifiers(ordered[i].id, ordered[j].id) < 0
+	})
+
+	t.mu.Lock()
+	last := t.last
+	t.mu.Unlock()
+
+	start := 0
+	if last != nil {
+		start = sort.Search(len(ordered), func(i int) bool {
+			return compareIdentifiers(ordered[i].id, last) > 0
+		})
+	}
+
+	output := make(ktypes.UpkeepResults, 0, len(results))
+	for i := range ordered {
+		output = append(output, ordered[(start+i)%len(ordered)].result)
+	}
+
+	return append(output, unparsed...)
+}
+
+func (t *rotatingTruncator) Observed(kept ktypes.UpkeepResults) {
+	if len(kept) == 0 {
+		return
+	}
+
+	id, err := t.registry.IdentifierFromKey(kept[len(kept)-1].Key)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.last = id
+}
+
+// randomTruncator shuffles results sorted by key with a seed derived from the
+// report timestamp. all nodes in a round shuffle the same results in the same
+// order.
+type randomTruncator struct {
+	registry ktypes.Registry
+}
+
+func (t *randomTruncator) Order(rt types.ReportTimestamp, results ktypes.UpkeepResults) ktypes.UpkeepResults {
+	shuffled := sortedResults(results, t.registry)
+
+	r := rnd.New(util.NewKeyedCryptoRandSource(roundKey(rt)))
+	r.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	return shuffled
+}
+
+func (t *randomTruncator) Observed(_ ktypes.UpkeepResults) {}
+
+// leastRecentlyPerformedTruncator orders results by the time since the last
+// perform of the upkeep id with the longest time first. Upkeeps without a
+// perform are ordered before all others. Ties are ordered by key.
+type leastRecentlyPerformedTruncator struct {
+	registry      ktypes.Registry
+	lastPerformed func(ktypes.UpkeepIdentifier) (time.Time, bool)
+}
+
+func (t *leastRecentlyPerformedTruncator) Order(_ types.ReportTimestamp, results ktypes.UpkeepResults) ktypes.UpkeepResults {
+	performed := make(map[string]time.Time, len(results))
+	for _, result := range results {
+		id, err := t.registry.IdentifierFromKey(result.Key)
+		if err != nil {
+			continue
+		}
+
+		if last, ok := t.lastPerformed(id); ok {
+			performed[string(result.Key)] = last
+		}
+	}
+
+	// the stable sort keeps ties in key order
+	ordered := sortedResults(results, t.registry)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := performed[string(ordered[i].Key)], performed[string(ordered[j].Key)]
+		return a.Before(b)
+	})
+
+	return ordered
+}
+
+func (t *leastRecentlyPerformedTruncator) Observed(_ ktypes.UpkeepResults) {}
+
+// sortedResults returns a copy of the results ordered by the block of the key
+// in the order of the registry and then by upkeep id. Results with keys that
+// cannot be parsed or ordered are added last in the order of the keys as
+// strings. The provided results are not modified.
+func sortedResults(results ktypes.UpkeepResults, registry ktypes.Registry) ktypes.UpkeepResults {
+	type parsedResult struct {
+		ok     bool
+		block  ktypes.BlockKey
+		id     ktypes.UpkeepIdentifier
+		result ktypes.UpkeepResult
+	}
+
+	parsed := make([]parsedResult, len(results))
+	for i, result := range results {
+		parsed[i].result = result
+
+		block, err := registry.BlockFromKey(result.Key)
+		if err != nil {
+			continue
+		}
+
+		id, err := registry.IdentifierFromKey(result.Key)
+		if err != nil {
+			continue
+		}
+
+		// a block that cannot be ordered against itself is not ordered
+		if _, err := registry.CompareBlocks(block, block); err != nil {
+			continue
+		}
+
+		parsed[i] = parsedResult{ok: true, block: block, id: id, result: result}
+	}
+
+	sort.SliceStable(parsed, func(i, j int) bool {
+		a, b := parsed[i], parsed[j]
+		if a.ok != b.ok {
+			return a.ok
+		}
+
+		if a.ok {
+			if cmp, err := registry.CompareBlocks(a.block, b.block); err == nil && cmp != 0 {
+				return cmp < 0
+			}
+
+			if cmp := compareIdentifiers(a.id, b.id); cmp != 0 {
+				return cmp < 0
+			}
+		}
+
+		return string(a.result.Key) < string(b.result.Key)
+	})
+
+	sorted := make(ktypes.UpkeepResults, len(parsed))
+	for i, p := range parsed {
+		sorted[i] = p.result
+	}
+
+	return sorted
+}
+
+// compareIdentifiers orders upkeep ids as unsigned big-endian numbers. ids
+// encoded as bytes or as decimal strings without leading zeros are both
+// ordered by value.
+func compareIdentifiers(a, b ktypes.UpkeepIdentifier) int {
+	a, b = bytes.TrimLeft(a, "\x00"), bytes.TrimLeft(b, "\x00")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+
+		return 1
+	}
+
+	return bytes.Compare(a, b)
+}
+
+// roundKey derives a key from the config digest, epoch, and round that is
+// the same for all nodes in a round. the key is built in the same way as the
+// libocr transmit selector.
+func roundKey(rt types.ReportTimestamp) [16]byte {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(rt.ConfigDigest[:])
+	temp := make([]byte, 8)
+	binary.LittleEndian.PutUint64(temp, uint64(rt.Epoch))
+	hash.Write(temp)
+	binary.LittleEndian.PutUint64(temp, uint64(rt.Round))
+	hash.Write(temp)
+
+	var key [16]byte
+	copy(key[:], hash.Sum(nil))
+
+	return key
+}
@@ -0,0 +1,212 @@
+package keepers
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/smartcontractkit/libocr/offchainreporting2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+func TestNewObservationTruncator(t *testing.T) {
+	mr := ktypes.NewMockRegistry(t)
+	lastPerformed := func(ktypes.UpkeepIdentifier) (time.Time, bool) { return time.Time{}, false }
+
+	for policy, expected := range map[ktypes.ObservationTruncation]observationTruncator{
+		ktypes.TruncateSorted:                 &sortedTruncator{},
+		ktypes.TruncateRotating:               &rotatingTruncator{},
+		ktypes.TruncateRandom:                 &randomTruncator{},
+		ktypes.TruncateLeastRecentlyPerformed: &leastRecentlyPerformedTruncator{},
+	} {
+		truncator, err := newObservationTruncator(policy, mr, lastPerformed)
+		require.NoError(t, err)
+		assert.IsType(t, expected, truncator)
+	}
+
+	_, err := newObservationTruncator(ktypes.ObservationTruncation("unknown"), mr, lastPerformed)
+	assert.Error(t, err)
+}
+
+func TestRotatingTruncator(t *testing.T) {
+	truncator := &rotatingTruncator{registry: newTestKeyRegistry(t)}
+
+	results := eligibleResults([]ktypes.UpkeepKey{
+		ktypes.UpkeepKey("1|4"),
+		ktypes.UpkeepKey("1|2"),
+		ktypes.UpkeepKey("1|3"),
+		ktypes.UpkeepKey("1|1"),
+	})
+
+	ordered := truncator.Order(types.ReportTimestamp{}, results)
+	assert.Equal(t, eligibleResults([]ktypes.UpkeepKey{
+		ktypes.UpkeepKey("1|1"),
+		ktypes.UpkeepKey("1|2"),
+		ktypes.UpkeepKey("1|3"),
+		ktypes.UpkeepKey("1|4"),
+	}), ordered)
+
+	truncator.Observed(ordered[:3])
+
+	// the next observation starts after the last id kept regardless of the
+	// block of the keys
+	ordered = truncator.Order(types.ReportTimestamp{}, eligibleResults([]ktypes.UpkeepKey{
+		ktypes.UpkeepKey("2|1"),
+		ktypes.UpkeepKey("2|2"),
+		ktypes.UpkeepKey("2|4"),
+	}))
+	assert.Equal(t, eligibleResults([]ktypes.UpkeepKey{
+		ktypes.UpkeepKey("2|4"),
+		ktypes.UpkeepKey("2|1"),
+		ktypes.UpkeepKey("2|2"),
+	}), ordered)
+}
+
+func TestRotatingTruncator_IdentifierOrder(t *testing.T) {
+	truncator := &rotatingTruncator{registry: newTestKeyRegistry(t)}
+
+	// ids are ordered by value and not as strings
+	ordered := truncator.Order(types.ReportTimestamp{}, eligibleResults([]ktypes.UpkeepKey{
+		ktypes.UpkeepKey("1|10"),
+		ktypes.UpkeepKey("1|9"),
+		ktypes.UpkeepKey("1|100"),
+	}))
+	assert.Equal(t, eligibleResults([]ktypes.UpkeepKey{
+		ktypes.UpkeepKey("1|9"),
+		ktypes.UpkeepKey("1|10"),
+		ktypes.UpkeepKey("1|100"),
+	}), ordered)
+
+	truncator.Observed(ordered[:1])
+
+	ordered = truncator.Order(types.ReportTimestamp{}, eligibleResults([]ktypes.UpkeepKey{
+		ktypes.UpkeepKey("2|100"),
+		ktypes.UpkeepKey("2|9"),
+		ktypes.UpkeepKey("2|10"),
+	}))
+	assert.Equal(t, eligibleResults([]ktypes.UpkeepKey{
+		ktypes.UpkeepKey("2|10"),
+		ktypes.UpkeepKey("2|100"),
+		ktypes.UpkeepKey("2|9"),
+	}), ordered)
+}
+
+func TestSortedTruncator(t *testing.T) {
+	truncator := &sortedTruncator{registry: newTestKeyRegistry(t)}
+
+	results := eligibleResults([]ktypes.UpkeepKey{
+		ktypes.UpkeepKey("1000|2"),
+		ktypes.UpkeepKey("999|10"),
+		ktypes.UpkeepKey("999|9"),
+	})
+
+	// blocks are ordered by the registry and ids by value
+	ordered := truncator.Order(types.ReportTimestamp{}, results)
+	assert.Equal(t, eligibleResults([]ktypes.UpkeepKey{
+		ktypes.UpkeepKey("999|9"),
+		ktypes.UpkeepKey("999|10"),
+		ktypes.UpkeepKey("1000|2"),
+	}), ordered)
+
+	// the provided results are not reordered
+	assert.Equal(t, ktypes.UpkeepKey("1000|2"), results[0].Key)
+}
+
+func TestRandomTruncator(t *testing.T) {
+	truncator := &randomTruncator{registry: newTestKeyRegistry(t)}
+
+	keys := makeLongKeys(50)
+
+	reversed := make([]ktypes.UpkeepKey, len(keys))
+	for i, key := range keys {
+		reversed[len(keys)-1-i] = key
+	}
+
+	rt := types.ReportTimestamp{Epoch: 1, Round: 1}
+
+	// all nodes order the same results in the same order in a round
+	ordered := truncator.Order(rt, eligibleResults(keys))
+	assert.Equal(t, ordered, truncator.Order(rt, eligibleResults(reversed)))
+	assert.NotEqual(t, eligibleResults(keys), ordered)
+
+	// the order changes with the round
+	assert.NotEqual(t, ordered, truncator.Order(types.ReportTimestamp{Epoch: 1, Round: 2}, eligibleResults(keys)))
+
+	// the provided results are not reordered
+	results := eligibleResults(keys)
+	truncator.Order(rt, results)
+	assert.Equal(t, eligibleResults(keys), results)
+}
+
+func TestLeastRecentlyPerformedTruncator(t *testing.T) {
+	now := time.Now()
+	performed := map[string]time.Time{
+		"1": now.Add(-time.Minute),
+		"2": now,
+		"3": now.Add(-time.Hour),
+	}
+
+	truncator := &leastRecentlyPerformedTruncator{
+		registry: newTestKeyRegistry(t),
+		lastPerformed: func(id ktypes.UpkeepIdentifier) (time.Time, bool) {
+			last, ok := performed[string(id)]
+			return last, ok
+		},
+	}
+
+	ordered := truncator.Order(types.ReportTimestamp{}, eligibleResults([]ktypes.UpkeepKey{
+		ktypes.UpkeepKey("1|1"),
+		ktypes.UpkeepKey("1|2"),
+		ktypes.UpkeepKey("1|3"),
+		ktypes.UpkeepKey("1|5"),
+		ktypes.UpkeepKey("1|4"),
+	}))
+
+	// upkeeps without a perform are kept first
+	assert.Equal(t, eligibleResults([]ktypes.UpkeepKey{
+		ktypes.UpkeepKey("1|4"),
+		ktypes.UpkeepKey("1|5"),
+		ktypes.UpkeepKey("1|3"),
+		ktypes.UpkeepKey("1|1"),
+		ktypes.UpkeepKey("1|2"),
+	}), ordered)
+}
+
+func TestObservation_Truncation(t *testing.T) {
+	ms := new(MockedUpkeepService)
+	mf := new(MockedFilterer)
+
+	registry := newTestKeyRegistry(t)
+	plugin := &keepers{
+		service:   ms,
+		registry:  registry,
+		logger:    log.New(io.Discard, "", 0),
+		filter:    mf,
+		truncator: &rotatingTruncator{registry: registry},
+	}
+
+	keys := makeLongKeys(20)
+
+	mf.Mock.On("Filter").Return(func(k ktypes.UpkeepKey) bool { return true })
+	ms.Mock.On("SampleUpkeeps", mock.Anything, mock.Anything).Return(func() ktypes.UpkeepResults {
+		return eligibleResults(keys)
+	}, nil)
+
+	// the first observation keeps the first 8 keys and the next observation
+	// continues with the keys that were dropped
+	b, err := plugin.Observation(context.Background(), types.ReportTimestamp{}, types.Query{})
+	require.NoError(t, err)
+	assert.Equal(t, types.Observation(mustEncodeKeys(keys[:8])), b)
+	assert.Equal(t, uint64(12), plugin.droppedFromObservations.Load())
+
+	b, err = plugin.Observation(context.Background(), types.ReportTimestamp{}, types.Query{})
+	require.NoError(t, err)
+	assert.Equal(t, types.Observation(mustEncodeKeys(keys[8:16])), b)
+	assert.Equal(t, uint64(24), plugin.droppedFromObservations.Load())
+}
@@ -20,8 +20,13 @@ func (r sampleRatio) String() string {
 }
 
 type upkeepService interface {
-	SampleUpkeeps(context.Context, ...func(types.UpkeepKey) bool) (types.UpkeepResults, error)
+	SampleUpkeeps(context.Context, types.BlockKey, ...func(types.UpkeepKey) bool) (types.UpkeepResults, error)
+	LatestSampledBlock() (types.BlockKey, bool)
+	HasSampledBlock(types.BlockKey) bool
 	CheckUpkeep(context.Context, ...types.UpkeepKey) (types.UpkeepResults, error)
+	CachedUpkeep(...types.UpkeepKey) (types.UpkeepResults, []types.UpkeepKey)
+	Healthy() error
+	Close() error
 }
 
 type filterer interface {
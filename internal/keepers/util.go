@@ -10,6 +10,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/smartcontractkit/libocr/commontypes"
 	"github.com/smartcontractkit/libocr/offchainreporting2/types"
 	"github.com/smartcontractkit/ocr2keepers/internal/util"
 	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
@@ -76,10 +77,6 @@ func dedupe[T any](inputs [][]T, filters ...func(T) bool) ([]T, error) {
 		return nil, fmt.Errorf("%w: must provide at least 1", ErrNotEnoughInputs)
 	}
 
-	if len(inputs) == 1 {
-		return inputs[0], nil
-	}
-
 	var max int
 	for _, input := range inputs {
 		max += len(input)
@@ -113,9 +110,7 @@ func dedupe[T any](inputs [][]T, filters ...func(T) bool) ([]T, error) {
 	return output, nil
 }
 
-func shuffledDedupedKeyList(attributed []types.AttributedObservation, key [16]byte, filters ...func(ktypes.UpkeepKey) bool) ([]ktypes.UpkeepKey, error) {
-	var err error
-
+func shuffledDedupedKeyList(attributed []types.AttributedObservation, key [16]byte, codec ktypes.KeyCodec, filters ...func(ktypes.UpkeepKey) bool) ([]ktypes.UpkeepKey, error) {
 	kys := make([][]ktypes.UpkeepKey, len(attributed))
 	for i, attr := range attributed {
 		b := []byte(attr.Observation)
@@ -123,8 +118,7 @@ func shuffledDedupedKeyList(attributed []types.AttributedObservation, key [16]by
 			continue
 		}
 
-		var ob []ktypes.UpkeepKey
-		err = decode(b, &ob)
+		ob, err := decodeObservation(b, codec)
 		if err != nil {
 			return nil, fmt.Errorf("%w: cannot prepare sorted key list; observation not properly encoded", err)
 		}
@@ -147,6 +141,287 @@ func shuffledDedupedKeyList(attributed []types.AttributedObservation, key [16]by
 	return keys, nil
 }
 
+// atBlock returns a filter that keeps only keys at the provided block. Keys
+// that cannot be parsed or ordered against the block are dropped.
+func atBlock(block ktypes.BlockKey, registry ktypes.Registry) func(ktypes.UpkeepKey) bool {
+	return func(key ktypes.UpkeepKey) bool {
+		keyBlock, err := registry.BlockFromKey(key)
+		if err != nil {
+			return false
+		}
+
+		cmp, err := registry.CompareBlocks(keyBlock, block)
+		return err == nil && cmp == 0
+	}
+}
+
+// latestByID reduces the provided values to a single value per upkeep id such
+// that an upkeep is checked and reported at most once. The value with the key
+// at the latest block is kept and takes the position of the first value
+// observed for the id. Keys at the same block are ordered as strings. The
+// selection does not depend on the order of values for the same id so all
+// nodes select the same keys for the same set of observations. Values with
+// keys that cannot be parsed or ordered are dropped.
+func latestByID[T any](values []T, keyOf func(T) ktypes.UpkeepKey, registry ktypes.Registry) []T {
+	type latest struct {
+		index int
+		key   ktypes.UpkeepKey
+		block ktypes.BlockKey
+	}
+
+	output := make([]T, 0, len(values))
+	byID := make(map[string]*latest)
+
+	for _, value := range values {
+		key := keyOf(value)
+
+		id, err := registry.IdentifierFromKey(key)
+		if err != nil {
+			continue
+		}
+
+		block, err := registry.BlockFromKey(key)
+		if err != nil {
+			continue
+		}
+
+		current, ok := byID[string(id)]
+		if !ok {
+			byID[string(id)] = &latest{index: len(output), key: key, block: block}
+			output = append(output, value)
+			continue
+		}
+
+		cmp, err := registry.CompareBlocks(block, current.block)
+		if err != nil {
+			// the block that cannot be ordered against itself is dropped
+			if _, err := registry.CompareBlocks(block, block); err != nil {
+				continue
+			}
+
+			cmp = 1
+		}
+
+		if cmp > 0 || (cmp == 0 && string(key) < string(current.key)) {
+			current.key = key
+			current.block = block
+			output[current.index] = value
+		}
+	}
+
+	return output
+}
+
+// withinCheckBlockWindow returns the results checked within the window that
+// ends at the latest check block of the results. Results with keys that
+// cannot be parsed or ordered are dropped.
+func withinCheckBlockWindow(results ktypes.UpkeepResults, window ktypes.CheckBlockWindow, registry ktypes.Registry) (ktypes.UpkeepResults, error) {
+	blocks := make([]ktypes.BlockKey, len(results))
+
+	var latest ktypes.BlockKey
+	for i, result := range results {
+		block, err := registry.BlockFromKey(result.Key)
+		if err != nil {
+			continue
+		}
+
+		blocks[i] = block
+
+		if len(latest) == 0 {
+			latest = block
+			continue
+		}
+
+		if after, err := ktypes.BlockAfter(registry, block, latest); err == nil && after {
+			latest = block
+		}
+	}
+
+	if len(latest) == 0 {
+		return nil, nil
+	}
+
+	earliest, err := window.EarliestCheckBlock(latest)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(ktypes.UpkeepResults, 0, len(results))
+	for i, result := range results {
+		if len(blocks[i]) == 0 {
+			continue
+		}
+
+		if cmp, err := registry.CompareBlocks(blocks[i], earliest); err == nil && cmp >= 0 {
+			output = append(output, result)
+		}
+	}
+
+	return output, nil
+}
+
+func upkeepKey(key ktypes.UpkeepKey) ktypes.UpkeepKey {
+	return key
+}
+
+func resultKey(result ktypes.UpkeepResult) ktypes.UpkeepKey {
+	return result.Key
+}
+
+// observationQuorum counts the distinct oracles that observed each upkeep id
+// and each upkeep key across all attributed observations. Keys for upkeep
+// ids observed by fewer oracles than the threshold are filtered out and
+// recorded.
+type observationQuorum struct {
+	threshold    int
+	codec        ktypes.KeyCodec
+	observers    map[string]map[commontypes.OracleID]struct{}
+	keyObservers map[string]map[commontypes.OracleID]struct{}
+	short        map[string]int
+	mu           sync.Mutex
+}
+
+func newObservationQuorum(attributed []types.AttributedObservation, threshold int, codec ktypes.KeyCodec) (*observationQuorum, error) {
+	q := &observationQuorum{
+		threshold:    threshold,
+		codec:        codec,
+		observers:    make(map[string]map[commontypes.OracleID]struct{}),
+		keyObservers: make(map[string]map[commontypes.OracleID]struct{}),
+		short:        make(map[string]int),
+	}
+
+	for _, attr := range attributed {
+		b := []byte(attr.Observation)
+		if len(b) == 0 {
+			continue
+		}
+
+		keys, err := decodeObservation(b, codec)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot count observers; observation not properly encoded", err)
+		}
+
+		for _, key := range keys {
+			id, err := codec.IdentifierFromKey(key)
+			if err != nil {
+				continue
+			}
+
+			if _, ok := q.observers[string(id)]; !ok {
+				q.observers[string(id)] = make(map[commontypes.OracleID]struct{})
+			}
+
+			q.observers[string(id)][attr.Observer] = struct{}{}
+
+			if _, ok := q.keyObservers[string(key)]; !ok {
+				q.keyObservers[string(key)] = make(map[commontypes.OracleID]struct{})
+			}
+
+			q.keyObservers[string(key)][attr.Observer] = struct{}{}
+		}
+	}
+
+	return q, nil
+}
+
+// Filter returns false for keys where the upkeep id was observed by fewer
+// oracles than the quorum threshold.
+func (q *observationQuorum) Filter() func(ktypes.UpkeepKey) bool {
+	return func(key ktypes.UpkeepKey) bool {
+		id, err := q.codec.IdentifierFromKey(key)
+		if err != nil {
+			return false
+		}
+
+		count := len(q.observers[string(id)])
+		if count >= q.threshold {
+			return true
+		}
+
+		q.mu.Lock()
+		q.short[string(key)] = count
+		q.mu.Unlock()
+
+		return false
+	}
+}
+
+// KeyObserved indicates whether the exact key was observed by at least the
+// quorum threshold of distinct oracles. The block of an upkeep is chosen only
+// from keys observed by a quorum such that a single oracle cannot force a key
+// at a block no other oracle observed.
+func (q *observationQuorum) KeyObserved(key ktypes.UpkeepKey) bool {
+	return len(q.keyObservers[string(key)]) >= q.threshold
+}
+
+// ShortOfQuorum returns the keys that were filtered out with the number of
+// distinct oracles that observed the upkeep id.
+func (q *observationQuorum) ShortOfQuorum() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	short := make(map[string]int, len(q.short))
+	for key, count := range q.short {
+		short[key] = count
+	}
+
+	return short
+}
+
+// agreedResultDigests returns the result digest for each key where a single
+// digest was observed by at least threshold distinct oracles. Keys where more
+// than one digest reaches the threshold are not included.
+func agreedResultDigests(attributed []types.AttributedObservation, threshold int, codec ktypes.KeyCodec) (map[string][resultDigestLength]byte, error) {
+	observers := make(map[string]map[[resultDigestLength]byte]map[commontypes.OracleID]struct{})
+
+	for _, attr := range attributed {
+		b := []byte(attr.Observation)
+		if len(b) == 0 {
+			continue
+		}
+
+		observed, err := decodeObservedKeys(b, codec)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot collect result digests; observation not properly encoded", err)
+		}
+
+		for _, o := range observed {
+			if o.Digest == nil {
+				continue
+			}
+
+			if _, ok := observers[string(o.Key)]; !ok {
+				observers[string(o.Key)] = make(map[[resultDigestLength]byte]map[commontypes.OracleID]struct{})
+			}
+
+			if _, ok := observers[string(o.Key)][*o.Digest]; !ok {
+				observers[string(o.Key)][*o.Digest] = make(map[commontypes.OracleID]struct{})
+			}
+
+			observers[string(o.Key)][*o.Digest][attr.Observer] = struct{}{}
+		}
+	}
+
+	agreed := make(map[string][resultDigestLength]byte)
+	for key, digests := range observers {
+		var matches int
+		var match [resultDigestLength]byte
+
+		for digest, oracles := range digests {
+			if len(oracles) >= threshold {
+				matches++
+				match = digest
+			}
+		}
+
+		if matches == 1 {
+			agreed[key] = match
+		}
+	}
+
+	return agreed, nil
+}
+
 func sampleFromProbability(rounds, nodes int, probability float32) (sampleRatio, error) {
 	var ratio sampleRatio
 
@@ -212,67 +487,50 @@ func (a *syncedArray[T]) Values() []T {
 	return a.data
 }
 
-func limitedLengthEncode(keys []ktypes.UpkeepKey, limit int) ([]byte, error) {
-	if len(keys) == 0 {
-		return encode([]ktypes.UpkeepKey{})
-	}
+// limitedLengthEncode encodes a prefix of the provided keys such that the
+// encoded observation does not exceed the limit and returns the number of
+// keys encoded. The observation length is tracked exactly while keys are
+// added. Keys are split by the provided key codec.
+func limitedLengthEncode(keys []ktypes.UpkeepKey, limit int, codec ktypes.KeyCodec) ([]byte, int, error) {
+	return limitedLengthEncodeWith(newObservationBuilder(codec), keys, nil, limit)
+}
 
-	// limit the number of keys that can be added to an observation
-	// OCR observation limit is set to 1_000 bytes so this should be under the
-	// limit
-	var tot int
-	var idx int
-
-	// json encoding byte arrays follows a linear progression of byte length
-	// vs encoded length. the following is the magic equation where x is the
-	// byte array length and y is the encoded length.
-	// eq: y = 1.32 * x + 7.31
-
-	// if the total plus padding for json encoding is less than the max, another
-	// key can be included
-	c := true
-	for c && idx < len(keys) {
-		tot += len(keys[idx])
-
-		// because we are encoding an array of byte arrays, some bytes are added
-		// per byte array and all byte arrays could be different lengths.
-		// this is only for the purpose of estimation so add some padding for
-		// each byte array
-		v := (1.32 * float64(tot)) + 7.31 + float64((idx+1)*2)
-		if int(math.Ceil(v)) > limit {
-			c = false
-		}
+// limitedLengthEncodeResults encodes a prefix of the provided results with a
+// digest of each result such that the encoded observation does not exceed
+// the limit and returns the number of results encoded.
+func limitedLengthEncodeResults(results ktypes.UpkeepResults, limit int, codec ktypes.KeyCodec) ([]byte, int, error) {
+	keys := make([]ktypes.UpkeepKey, len(results))
+	digests := make([][resultDigestLength]byte, len(results))
 
-		idx++
+	for i, result := range results {
+		keys[i] = result.Key
+		digests[i] = resultDigest(result)
 	}
 
-	toEncode := keys[:idx]
-
-	var b []byte
-	var err error
+	return limitedLengthEncodeWith(newResultObservationBuilder(codec), keys, digests, limit)
+}
 
-	b, err = encode(toEncode)
-	if err != nil {
-		return nil, err
+func limitedLengthEncodeWith(ob *observationBuilder, keys []ktypes.UpkeepKey, digests [][resultDigestLength]byte, limit int) ([]byte, int, error) {
+	if ob.Len() > limit {
+		return nil, 0, fmt.Errorf("%w: limit %d is less than the minimum observation length", ErrInvalidObservation, limit)
 	}
 
-	// finally we walk backward from the estimate if the resulting length is
-	// larger than our limit. this ensures that the output is within range.
-	for len(b) > limit {
-		idx--
-		if idx == 0 {
-			return encode([]ktypes.UpkeepKey{})
+	var added int
+	for i, key := range keys {
+		if ob.LenWith(key) > limit {
+			break
 		}
 
-		toEncode = keys[:idx]
-
-		b, err = encode(toEncode)
-		if err != nil {
-			return nil, err
+		if digests != nil {
+			ob.AddWithDigest(key, digests[i])
+		} else {
+			ob.Add(key)
 		}
+
+		added++
 	}
 
-	return b, nil
+	return ob.Encode(), added, nil
 }
 
 func upkeepKeysToString(keys []ktypes.UpkeepKey) string {
@@ -9,6 +9,7 @@ import (
 	"github.com/smartcontractkit/libocr/offchainreporting2/types"
 	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestCryptoShuffler(t *testing.T) {
@@ -62,9 +63,110 @@ func TestDedupe(t *testing.T) {
 	}
 }
 
+func TestShuffledDedupedKeyList_LegacyObservations(t *testing.T) {
+	obs := []types.AttributedObservation{
+		{Observation: types.Observation(mustEncodeLegacyKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("1|1"), ktypes.UpkeepKey("1|2")}))},
+		{Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("1|2"), ktypes.UpkeepKey("2|3")}))},
+	}
+
+	keys, err := shuffledDedupedKeyList(obs, [16]byte{}, testKeyCodec{})
+	assert.NoError(t, err)
+
+	sort.Sort(sortUpkeepKeys(keys))
+	assert.Equal(t, []ktypes.UpkeepKey{ktypes.UpkeepKey("1|1"), ktypes.UpkeepKey("1|2"), ktypes.UpkeepKey("2|3")}, keys)
+}
+
+func TestLatestByID(t *testing.T) {
+	mr := newTestKeyRegistry(t)
+
+	keys := []ktypes.UpkeepKey{
+		ktypes.UpkeepKey("100|5"),
+		ktypes.UpkeepKey("99|6"),
+		ktypes.UpkeepKey("1000|5"),
+		ktypes.UpkeepKey("101|5"),
+		ktypes.UpkeepKey("99|7"),
+	}
+
+	// the key at the latest block takes the position of the first key for
+	// the upkeep id
+	expected := []ktypes.UpkeepKey{
+		ktypes.UpkeepKey("1000|5"),
+		ktypes.UpkeepKey("99|6"),
+		ktypes.UpkeepKey("99|7"),
+	}
+
+	assert.Equal(t, expected, latestByID(keys, upkeepKey, mr))
+
+	// the selection does not depend on the order of keys
+	reversed := make([]ktypes.UpkeepKey, len(keys))
+	for i, key := range keys {
+		reversed[len(keys)-1-i] = key
+	}
+
+	assert.ElementsMatch(t, expected, latestByID(reversed, upkeepKey, mr))
+
+	t.Run("Unordered Blocks", func(t *testing.T) {
+		mr := ktypes.NewMockRegistry(t)
+
+		mr.Mock.On("IdentifierFromKey", mock.Anything).Return(ktypes.UpkeepIdentifier("5"), nil)
+		mr.Mock.On("BlockFromKey", mock.Anything).Return(testBlockFromKey, nil)
+		mr.Mock.On("CompareBlocks", ktypes.BlockKey("100"), ktypes.BlockKey("100")).Return(0, nil).Maybe()
+		mr.Mock.On("CompareBlocks", mock.Anything, mock.Anything).Return(0, fmt.Errorf("not a block number"))
+
+		// the key with a block that cannot be ordered is dropped
+		assert.Equal(t, []ktypes.UpkeepKey{ktypes.UpkeepKey("100|5")}, latestByID([]ktypes.UpkeepKey{ktypes.UpkeepKey("0x64|5"), ktypes.UpkeepKey("100|5")}, upkeepKey, mr))
+		assert.Equal(t, []ktypes.UpkeepKey{ktypes.UpkeepKey("100|5")}, latestByID([]ktypes.UpkeepKey{ktypes.UpkeepKey("100|5"), ktypes.UpkeepKey("0x64|5")}, upkeepKey, mr))
+	})
+}
+
+func TestObservationQuorum(t *testing.T) {
+	obs := []types.AttributedObservation{
+		{Observer: 0, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("1|1"), ktypes.UpkeepKey("1|2")}))},
+		{Observer: 1, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("2|1"), ktypes.UpkeepKey("1|3")}))},
+		{Observer: 2, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("1|1")}))},
+		// a single oracle observing the same id twice counts once
+		{Observer: 3, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{ktypes.UpkeepKey("1|2"), ktypes.UpkeepKey("2|2")}))},
+	}
+
+	q, err := newObservationQuorum(obs, 2, testKeyCodec{})
+	assert.NoError(t, err)
+
+	keys, err := shuffledDedupedKeyList(obs, [16]byte{}, testKeyCodec{}, q.Filter())
+	assert.NoError(t, err)
+
+	sort.Sort(sortUpkeepKeys(keys))
+	assert.Equal(t, []ktypes.UpkeepKey{ktypes.UpkeepKey("1|1"), ktypes.UpkeepKey("1|2"), ktypes.UpkeepKey("2|1"), ktypes.UpkeepKey("2|2")}, keys)
+	assert.Equal(t, map[string]int{"1|3": 1}, q.ShortOfQuorum())
+}
+
+func TestAgreedResultDigests(t *testing.T) {
+	r1 := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("1|1"), State: ktypes.Eligible, PerformData: []byte("abcd")}
+	r2 := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("1|2"), State: ktypes.Eligible, PerformData: []byte("abcd")}
+	r2b := ktypes.UpkeepResult{Key: ktypes.UpkeepKey("1|2"), State: ktypes.Eligible, PerformData: []byte("efgh")}
+
+	obs := []types.AttributedObservation{
+		{Observer: 0, Observation: types.Observation(mustEncodeResults(ktypes.UpkeepResults{r1, r2}))},
+		{Observer: 1, Observation: types.Observation(mustEncodeResults(ktypes.UpkeepResults{r1, r2b}))},
+		// observations without digests do not count towards agreement
+		{Observer: 2, Observation: types.Observation(mustEncodeKeys([]ktypes.UpkeepKey{r1.Key, r2.Key}))},
+	}
+
+	agreed, err := agreedResultDigests(obs, 2, testKeyCodec{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][32]byte{"1|1": resultDigest(r1)}, agreed)
+
+	agreed, err = agreedResultDigests(obs, 1, testKeyCodec{})
+	assert.NoError(t, err)
+	// conflicting digests at the threshold are not agreed on
+	assert.Equal(t, map[string][32]byte{"1|1": resultDigest(r1)}, agreed)
+
+	_, err = agreedResultDigests([]types.AttributedObservation{{Observation: types.Observation([]byte{0xff})}}, 1, testKeyCodec{})
+	assert.ErrorIs(t, err, ErrInvalidObservation)
+}
+
 func TestSortedDedup_Error(t *testing.T) {
 	obs := []types.AttributedObservation{{Observation: types.Observation([]byte("incorrectly encoded"))}}
-	_, err := shuffledDedupedKeyList(obs, [16]byte{})
+	_, err := shuffledDedupedKeyList(obs, [16]byte{}, testKeyCodec{})
 	assert.NotNil(t, err)
 }
 
@@ -104,7 +206,7 @@ func BenchmarkSortedDedupedKeyListFunc(b *testing.B) {
 			for n := 0; n < b.N; n++ {
 
 				b.StartTimer()
-				_, err := shuffledDedupedKeyList(ob, [16]byte{})
+				_, err := shuffledDedupedKeyList(ob, [16]byte{}, testKeyCodec{})
 				b.StopTimer()
 
 				if err != nil {
@@ -177,7 +279,7 @@ func TestLimitedLengthEncode(t *testing.T) {
 			keys[i] = make([]byte, test.KeyLength)
 		}
 
-		b, err := limitedLengthEncode(keys, test.MaxLength)
+		b, _, err := limitedLengthEncode(keys, test.MaxLength, testKeyCodec{})
 		t.Logf("length: %d", len(b))
 
 		assert.NoError(t, err)
@@ -185,6 +287,33 @@ func TestLimitedLengthEncode(t *testing.T) {
 	}
 }
 
+func TestLimitedLengthEncode_Exact(t *testing.T) {
+	keys := make([]ktypes.UpkeepKey, 500)
+	for i := range keys {
+		keys[i] = ktypes.UpkeepKey(fmt.Sprintf("%d|%d", 100+i%3, 1_000_000+i))
+	}
+
+	for limit := 3; limit <= 1000; limit++ {
+		b, _, err := limitedLengthEncode(keys, limit, testKeyCodec{})
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(b), limit)
+
+		decoded, err := decodeObservation(b, testKeyCodec{})
+		assert.NoError(t, err)
+
+		// the next key would have exceeded the limit
+		if len(decoded) < len(keys) {
+			ob := newObservationBuilder(testKeyCodec{})
+			for _, key := range keys[:len(decoded)] {
+				ob.Add(key)
+			}
+
+			assert.Equal(t, len(b), ob.Len())
+			assert.Greater(t, ob.LenWith(keys[len(decoded)]), limit)
+		}
+	}
+}
+
 func FuzzLimitedLengthEncode(f *testing.F) {
 	f.Add(4, 10)
 	f.Fuzz(func(t *testing.T, a int, b int) {
@@ -203,14 +332,13 @@ func FuzzLimitedLengthEncode(f *testing.F) {
 			keys[i] = ktypes.UpkeepKey(make([]byte, rand.Intn(b)))
 		}
 
-		bt, err := limitedLengthEncode(keys, 1000)
+		bt, _, err := limitedLengthEncode(keys, 1000, testKeyCodec{})
 
 		assert.NoError(t, err)
 		assert.LessOrEqual(t, len(bt), 1000, "keys: %d; length: %d", a, b)
 
 		if a > 0 {
-			output := make([]ktypes.UpkeepKey, 0)
-			err = decode(bt, &output)
+			output, err := decodeObservation(bt, testKeyCodec{})
 			assert.NoError(t, err)
 
 			assert.Greater(t, len(bt), 0, "length of bytes :: keys: %d; length: %d", a, b)
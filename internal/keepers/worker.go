@@ -3,9 +3,10 @@ package keepers
 import (
 	"context"
 	"fmt"
-	"runtime"
 	"sync"
 	"time"
+
+	"github.com/smartcontractkit/ocr2keepers/internal/util"
 )
 
 var (
@@ -30,7 +31,7 @@ type worker[T any] struct {
 func (w *worker[T]) Do(ctx context.Context, r chan workResult[T], wrk work[T]) {
 	start := time.Now()
 
-	data, err := wrk(ctx)
+	data, err := w.call(ctx, wrk)
 	result := workResult[T]{
 		Worker: w.Name,
 		Data:   data,
@@ -52,6 +53,14 @@ func (w *worker[T]) Do(ctx context.Context, r chan workResult[T], wrk work[T]) {
 	}
 }
 
+// call runs the work and returns a panic, such as one caused by a bad RPC
+// response, as the work error
+func (w *worker[T]) call(ctx context.Context, wrk work[T]) (data T, err error) {
+	defer util.RecoverPanic(&err)
+
+	return wrk(ctx)
+}
+
 type workerGroup[T any] struct {
 	maxWorkers    int
 	activeWorkers int
@@ -59,6 +68,9 @@ type workerGroup[T any] struct {
 	queue         chan work[T]
 	queueClosed   bool
 	stop          chan struct{}
+	stopper       sync.Once
+	done          chan struct{}
+	running       sync.WaitGroup
 	results       chan workResult[T]
 	mu            sync.Mutex
 }
@@ -69,10 +81,13 @@ func newWorkerGroup[T any](workers int, queue int) *workerGroup[T] {
 		workers:    make(chan *worker[T], workers),
 		queue:      make(chan work[T], queue),
 		stop:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
 		results:    make(chan workResult[T], queue),
 	}
 
 	go func(g *workerGroup[T]) {
+		defer close(g.done)
+
 		// timer := time.NewTimer(5 * time.Second)
 		ctx, cancel := context.WithCancel(context.Background())
 		for {
@@ -88,11 +103,20 @@ func newWorkerGroup[T any](workers int, queue int) *workerGroup[T] {
 					g.activeWorkers++
 				} else {
 					// wait for a worker to be available
-					wkr = <-g.workers
+					select {
+					case wkr = <-g.workers:
+					case <-g.stop:
+						g.close(cancel)
+						return
+					}
 				}
 
 				// have worker do the work
-				go wkr.Do(ctx, g.results, item)
+				g.running.Add(1)
+				go func(wkr *worker[T], item work[T]) {
+					defer g.running.Done()
+					wkr.Do(ctx, g.results, item)
+				}(wkr, item)
 
 				// timer.Reset(5 * time.Second)
 				/*
@@ -104,21 +128,25 @@ func newWorkerGroup[T any](workers int, queue int) *workerGroup[T] {
 						}
 				*/
 			case <-g.stop:
-				g.mu.Lock()
-				close(g.queue)
-				g.queueClosed = true
-				g.mu.Unlock()
-				cancel()
+				g.close(cancel)
 				return
 			}
 		}
 	}(wg)
 
-	runtime.SetFinalizer(wg, func(g *workerGroup[T]) { close(g.stop) })
-
 	return wg
 }
 
+// close closes the queue and cancels the context of running work. Queued
+// work that has not started is dropped.
+func (wg *workerGroup[T]) close(cancel context.CancelFunc) {
+	wg.mu.Lock()
+	close(wg.queue)
+	wg.queueClosed = true
+	wg.mu.Unlock()
+	cancel()
+}
+
 // Do adds a new work item onto the work queue. This function blocks until
 // the work queue clears up or the context is cancelled.
 func (wg *workerGroup[T]) Do(ctx context.Context, w work[T]) error {
@@ -143,6 +171,13 @@ func (wg *workerGroup[T]) Do(ctx context.Context, w work[T]) error {
 	}
 }
 
+// Stop stops the worker group and cancels running work. Stop returns once all
+// worker go-routines have exited and can be called more than once.
 func (wg *workerGroup[T]) Stop() {
-	close(wg.stop)
+	wg.stopper.Do(func() {
+		close(wg.stop)
+	})
+
+	<-wg.done
+	wg.running.Wait()
 }
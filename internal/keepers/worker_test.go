@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/smartcontractkit/ocr2keepers/internal/util"
 )
 
 func TestWorker(t *testing.T) {
@@ -407,3 +409,26 @@ func BenchmarkWorkerGroup(b *testing.B) {
 		b.ReportMetric(0, "ns/op")
 	})
 }
+
+func TestWorker_Panic(t *testing.T) {
+	w := &worker[int]{
+		Name:  "worker",
+		Queue: make(chan *worker[int], 1),
+	}
+
+	results := make(chan workResult[int], 1)
+
+	// a panic in the work is returned as the work error
+	w.Do(context.Background(), results, func(_ context.Context) (int, error) {
+		panic("bad rpc response")
+	})
+
+	r := <-results
+
+	var panicErr *util.PanicError
+	assert.ErrorAs(t, r.Err, &panicErr)
+	assert.Equal(t, "bad rpc response", panicErr.Value)
+
+	// the worker is available again
+	assert.Equal(t, w, <-w.Queue)
+}
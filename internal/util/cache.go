@@ -35,8 +35,14 @@ type Cache[T any] struct {
 	data              map[string]CacheItem[T]
 }
 
-func (c *Cache[T]) Set(key string, value T, expire time.Duration) {
+// Set stores a value that expires after the provided duration and returns the
+// stored item
+func (c *Cache[T]) Set(key string, value T, expire time.Duration) CacheItem[T] {
 	var exp int64
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if expire == DefaultCacheExpiration {
 		expire = c.defaultExpiration
 	}
@@ -45,12 +51,31 @@ func (c *Cache[T]) Set(key string, value T, expire time.Duration) {
 		exp = time.Now().Add(expire).UnixNano()
 	}
 
-	c.mu.Lock()
-	c.data[key] = CacheItem[T]{
+	item := CacheItem[T]{
 		Item:    value,
 		Expires: exp,
 	}
-	c.mu.Unlock()
+
+	c.data[key] = item
+
+	return item
+}
+
+// SetItem stores an item with the expiration of the item
+func (c *Cache[T]) SetItem(key string, item CacheItem[T]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.data[key] = item
+}
+
+// SetDefaultExpiration changes the expiration of items set with the default
+// expiration from now on. Items already in the cache keep their expiration.
+func (c *Cache[T]) SetDefaultExpiration(expiration time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.defaultExpiration = expiration
 }
 
 func (c *Cache[T]) Get(key string) (T, bool) {
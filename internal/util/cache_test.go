@@ -45,6 +45,18 @@ func TestCacheSet(t *testing.T) {
 	assert.Equal(t, 2, len(c.data), "cache should contain 2 keys")
 }
 
+func TestCacheSetDefaultExpiration(t *testing.T) {
+	c := NewCache[int](time.Minute)
+	c.Set("key1", 1, DefaultCacheExpiration)
+
+	c.SetDefaultExpiration(time.Hour)
+	c.Set("key2", 2, DefaultCacheExpiration)
+
+	// items already set keep their expiration
+	assert.Less(t, c.data["key1"].Expires, time.Now().Add(2*time.Minute).UnixNano())
+	assert.Greater(t, c.data["key2"].Expires, time.Now().Add(59*time.Minute).UnixNano())
+}
+
 func TestCacheGet(t *testing.T) {
 	tests := []struct {
 		Name       string
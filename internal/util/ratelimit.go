@@ -0,0 +1,106 @@
+package util
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket is a token bucket rate limiter. Tokens are added at a constant
+// rate up to the burst size. Taking more tokens than are available puts the
+// bucket in debt which later takers have to wait out. This allows requests
+// larger than the burst size while keeping the long term rate.
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewTokenBucket creates a full bucket that refills at the provided rate of
+// tokens per second and holds at most burst tokens.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	b := &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+
+	b.last = b.now()
+
+	return b
+}
+
+// TryTake takes n tokens only if they are available without waiting.
+// Requests larger than the burst size are allowed once the bucket is full.
+func (b *TokenBucket) TryTake(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+
+	if b.tokens < math.Min(float64(n), b.burst) {
+		return false
+	}
+
+	b.tokens -= float64(n)
+
+	return true
+}
+
+// Take takes n tokens and blocks until the tokens are available or the
+// context is cancelled. Tokens are returned to the bucket if the context is
+// cancelled while waiting.
+func (b *TokenBucket) Take(ctx context.Context, n int) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	b.mu.Lock()
+	b.refill()
+	b.tokens -= float64(n)
+	deficit := -b.tokens
+	b.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(deficit / b.rate * float64(time.Second)))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.Put(n)
+		return ctx.Err()
+	}
+}
+
+// Put returns n tokens to the bucket
+func (b *TokenBucket) Put(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	b.tokens = math.Min(b.tokens+float64(n), b.burst)
+}
+
+func (b *TokenBucket) refill() {
+	now := b.now()
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+
+	if elapsed > 0 {
+		b.tokens = math.Min(b.tokens+elapsed*b.rate, b.burst)
+	}
+}
@@ -0,0 +1,71 @@
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := NewTokenBucket(10, 5)
+	b.now = func() time.Time { return now }
+	b.last = now
+
+	// the bucket starts full
+	assert.True(t, b.TryTake(5))
+	assert.False(t, b.TryTake(1))
+
+	// tokens are refilled at the configured rate
+	now = now.Add(100 * time.Millisecond)
+	assert.True(t, b.TryTake(1))
+	assert.False(t, b.TryTake(1))
+
+	// the bucket does not fill beyond the burst size
+	now = now.Add(10 * time.Second)
+	assert.True(t, b.TryTake(5))
+	assert.False(t, b.TryTake(1))
+
+	// requests larger than the burst size are allowed from a full bucket
+	now = now.Add(time.Second)
+	assert.True(t, b.TryTake(8))
+	assert.False(t, b.TryTake(1))
+
+	// the debt has to be repaid before tokens are available
+	now = now.Add(300 * time.Millisecond)
+	assert.False(t, b.TryTake(1))
+
+	now = now.Add(100 * time.Millisecond)
+	assert.True(t, b.TryTake(1))
+
+	b.Put(3)
+	assert.True(t, b.TryTake(3))
+}
+
+func TestTokenBucket_Take(t *testing.T) {
+	b := NewTokenBucket(100, 1)
+
+	assert.NoError(t, b.Take(context.Background(), 1))
+
+	// the next token is available after 10ms
+	start := time.Now()
+	assert.NoError(t, b.Take(context.Background(), 1))
+	assert.GreaterOrEqual(t, time.Since(start), 5*time.Millisecond)
+
+	t.Run("Cancelled", func(t *testing.T) {
+		b := NewTokenBucket(0.1, 1)
+		assert.NoError(t, b.Take(context.Background(), 1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		assert.ErrorIs(t, b.Take(ctx, 1), context.DeadlineExceeded)
+
+		// the tokens of the cancelled take are returned
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		assert.InDelta(t, 0, b.tokens, 0.01)
+	})
+}
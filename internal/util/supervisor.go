@@ -0,0 +1,215 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMinRestartBackoff is the default delay before a failed task is
+	// first restarted
+	DefaultMinRestartBackoff = 100 * time.Millisecond
+	// DefaultMaxRestartBackoff is the default limit of the delay between
+	// restarts of a repeatedly failing task
+	DefaultMaxRestartBackoff = 30 * time.Second
+)
+
+var (
+	ErrTaskUnhealthy = fmt.Errorf("supervised task unhealthy")
+)
+
+// PanicError is a panic recovered as an error. The stack is captured where
+// the panic was recovered and includes the panicking call.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("recovered panic: %v", e.Value)
+}
+
+// RecoverPanic recovers a panic and assigns it as a *PanicError to the
+// provided error. It must be deferred directly.
+func RecoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Value: r, Stack: debug.Stack()}
+	}
+}
+
+// Task is a named background process run by a Supervisor. A task should
+// return when the provided context is cancelled. A task that returns nil is
+// complete and is not restarted.
+type Task func(context.Context) error
+
+// TaskHealth is a snapshot of the state of a supervised task
+type TaskHealth struct {
+	Name        string
+	Running     bool
+	Restarts    int
+	LastStarted time.Time
+	LastErr     error
+}
+
+// Supervisor runs named background tasks. Panics in a task are recovered and
+// logged with the stack trace. Tasks that panic or return an error are
+// restarted with a backoff that doubles with each consecutive failure up to
+// the max backoff. The backoff is reset when a task ran for longer than the
+// max backoff before failing.
+type Supervisor struct {
+	logger     *log.Logger
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	mu         sync.RWMutex
+	tasks      map[string]*TaskHealth
+}
+
+func NewSupervisor(logger *log.Logger, minBackoff, maxBackoff time.Duration) *Supervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+
+	return &Supervisor{
+		logger:     logger,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		ctx:        ctx,
+		cancel:     cancel,
+		tasks:      make(map[string]*TaskHealth),
+	}
+}
+
+// Go starts the provided task in a new go-routine under supervision
+func (s *Supervisor) Go(name string, task Task) {
+	s.mu.Lock()
+	s.tasks[name] = &TaskHealth{Name: name}
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.supervise(name, task)
+}
+
+// Health returns the state of all tasks sorted by name
+func (s *Supervisor) Health() []TaskHealth {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	health := make([]TaskHealth, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		health = append(health, *task)
+	}
+
+	sort.Slice(health, func(i, j int) bool {
+		return health[i].Name < health[j].Name
+	})
+
+	return health
+}
+
+// Healthy returns an error naming the tasks that failed and are waiting to
+// be restarted
+func (s *Supervisor) Healthy() error {
+	var failed []string
+	for _, task := range s.Health() {
+		if !task.Running && task.LastErr != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s)", task.Name, task.LastErr))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: %s", ErrTaskUnhealthy, strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// Stop cancels the context provided to all tasks and waits for the tasks to
+// return. Tasks are not restarted after Stop is called.
+func (s *Supervisor) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *Supervisor) supervise(name string, task Task) {
+	defer s.wg.Done()
+
+	backoff := s.minBackoff
+
+	for {
+		started := time.Now()
+		s.update(name, func(h *TaskHealth) {
+			h.Running = true
+			h.LastStarted = started
+		})
+
+		err := s.call(task)
+		if s.ctx.Err() != nil {
+			// errors returned because the supervisor stopped are expected
+			err = nil
+		}
+
+		s.update(name, func(h *TaskHealth) {
+			h.Running = false
+			h.LastErr = err
+		})
+
+		if err == nil {
+			return
+		}
+
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			s.logger.Printf("%s: task '%s' panicked\n%s", err, name, panicErr.Stack)
+		} else {
+			s.logger.Printf("%s: task '%s' failed", err, name)
+		}
+
+		if time.Since(started) > s.maxBackoff {
+			backoff = s.minBackoff
+		}
+
+		s.logger.Printf("restarting task '%s' in %s", name, backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		s.update(name, func(h *TaskHealth) {
+			h.Restarts++
+		})
+
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+func (s *Supervisor) call(task Task) (err error) {
+	defer RecoverPanic(&err)
+
+	return task(s.ctx)
+}
+
+func (s *Supervisor) update(name string, fn func(*TaskHealth)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(s.tasks[name])
+}
@@ -0,0 +1,145 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type syncBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.String()
+}
+
+func TestSupervisor(t *testing.T) {
+	var logs syncBuffer
+	s := NewSupervisor(log.New(&logs, "", 0), time.Millisecond, 4*time.Millisecond)
+
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+
+	restarted := make(chan struct{})
+
+	// the task panics on the first call, fails on the second, and runs until
+	// stopped on the third
+	s.Go("test task", func(ctx context.Context) error {
+		mu.Lock()
+		calls++
+		call := calls
+		mu.Unlock()
+
+		switch call {
+		case 1:
+			panic("bad rpc response")
+		case 2:
+			return fmt.Errorf("rpc error")
+		default:
+			close(restarted)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+	})
+
+	select {
+	case <-restarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task was not restarted")
+	}
+
+	health := s.Health()
+	require.Len(t, health, 1)
+	assert.Equal(t, "test task", health[0].Name)
+	assert.Equal(t, 2, health[0].Restarts)
+	assert.True(t, health[0].Running)
+	assert.NoError(t, s.Healthy())
+
+	s.Stop()
+
+	assert.Equal(t, 3, calls)
+	assert.False(t, s.Health()[0].Running)
+	assert.NoError(t, s.Healthy(), "a task stopped by the supervisor is not unhealthy")
+
+	// panics are logged with the stack
+	assert.Contains(t, logs.String(), "recovered panic: bad rpc response: task 'test task' panicked")
+	assert.Contains(t, logs.String(), "supervisor_test.go")
+	assert.Contains(t, logs.String(), "rpc error: task 'test task' failed")
+	assert.Contains(t, logs.String(), "restarting task 'test task' in 1ms")
+	assert.Contains(t, logs.String(), "restarting task 'test task' in 2ms")
+}
+
+func TestSupervisor_Complete(t *testing.T) {
+	var logs syncBuffer
+	s := NewSupervisor(log.New(&logs, "", 0), time.Millisecond, time.Millisecond)
+
+	var calls int
+	s.Go("complete", func(_ context.Context) error {
+		calls++
+		return nil
+	})
+
+	s.Stop()
+
+	// a task that returns nil is not restarted
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 0, s.Health()[0].Restarts)
+	assert.NoError(t, s.Healthy())
+}
+
+func TestSupervisor_Unhealthy(t *testing.T) {
+	var logs syncBuffer
+	s := NewSupervisor(log.New(&logs, "", 0), time.Hour, time.Hour)
+
+	failed := make(chan struct{})
+	s.Go("failing", func(_ context.Context) error {
+		defer close(failed)
+		return fmt.Errorf("rpc error")
+	})
+
+	<-failed
+
+	// the task is waiting for the restart backoff
+	assert.Eventually(t, func() bool {
+		return s.Healthy() != nil
+	}, time.Second, time.Millisecond)
+	assert.ErrorIs(t, s.Healthy(), ErrTaskUnhealthy)
+	assert.Contains(t, s.Healthy().Error(), "failing (rpc error)")
+
+	// stop does not wait for the backoff
+	s.Stop()
+	assert.Equal(t, 0, s.Health()[0].Restarts)
+}
+
+func TestRecoverPanic(t *testing.T) {
+	fn := func() (err error) {
+		defer RecoverPanic(&err)
+		panic("test")
+	}
+
+	err := fn()
+
+	var panicErr *PanicError
+	require.ErrorAs(t, err, &panicErr)
+	assert.Equal(t, "test", panicErr.Value)
+	assert.NotEmpty(t, panicErr.Stack)
+}
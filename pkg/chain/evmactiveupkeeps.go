@@ -0,0 +1,442 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+const (
+	// ActiveUpkeepReconcileBlocks is the number of blocks after which the
+	// tracked active upkeeps are replaced by a full scan of the registry
+	ActiveUpkeepReconcileBlocks uint64 = 1000
+	// UpkeepInfoBatchSize is the max number of getUpkeep calls sent in a
+	// single batch call
+	UpkeepInfoBatchSize = 1000
+)
+
+var (
+	// activeUpkeepTopics are the events that change the set of active
+	// upkeeps
+	activeUpkeepTopics = []common.Hash{
+		keeperRegistryABI.Events["UpkeepRegistered"].ID,
+		keeperRegistryABI.Events["UpkeepReceived"].ID,
+		keeperRegistryABI.Events["UpkeepCanceled"].ID,
+		keeperRegistryABI.Events["UpkeepMigrated"].ID,
+		keeperRegistryABI.Events["UpkeepPaused"].ID,
+		keeperRegistryABI.Events["UpkeepUnpaused"].ID,
+	}
+)
+
+// activeUpkeepSet tracks the active upkeep ids of a registry. A full scan
+// provides a snapshot of the active upkeeps and registry events update the
+// snapshot on each later block. Paused upkeeps are tracked separately and
+// are not active. The set is scanned again when the last applied block was
+// reorged out of the canonical chain.
+type activeUpkeepSet struct {
+	mu     sync.Mutex
+	active map[string]*big.Int
+	paused map[string]*big.Int
+	// block is the last block applied to the set; 0 before the first scan
+	block uint64
+	// hash is the hash of the last applied block; empty when not known
+	hash common.Hash
+	// scanned is the block of the last full scan
+	scanned uint64
+	// version is incremented on each update of the set
+	version uint64
+}
+
+func newActiveUpkeepSet() *activeUpkeepSet {
+	return &activeUpkeepSet{
+		active: make(map[string]*big.Int),
+		paused: make(map[string]*big.Int),
+	}
+}
+
+// snapshot returns a copy of the tracked upkeeps and the block they apply to
+func (s *activeUpkeepSet) snapshot() activeUpkeepSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := activeUpkeepSnapshot{
+		active:  make(map[string]*big.Int, len(s.active)),
+		paused:  make(map[string]*big.Int, len(s.paused)),
+		block:   s.block,
+		hash:    s.hash,
+		scanned: s.scanned,
+		version: s.version,
+	}
+
+	for key, id := range s.active {
+		snapshot.active[key] = id
+	}
+
+	for key, id := range s.paused {
+		snapshot.paused[key] = id
+	}
+
+	return snapshot
+}
+
+// update replaces the tracked upkeeps with a snapshot derived from the set.
+// A snapshot is dropped when the set was updated since the snapshot was
+// taken unless the snapshot is at a later block.
+func (s *activeUpkeepSet) update(snapshot activeUpkeepSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if snapshot.version != s.version && snapshot.block <= s.block {
+		return
+	}
+
+	s.active = snapshot.active
+	s.paused = snapshot.paused
+	s.block = snapshot.block
+	s.hash = snapshot.hash
+	s.scanned = snapshot.scanned
+	s.version++
+}
+
+// activeUpkeepSnapshot is a copy of the tracked upkeeps at a block
+type activeUpkeepSnapshot struct {
+	active  map[string]*big.Int
+	paused  map[string]*big.Int
+	block   uint64
+	hash    common.Hash
+	scanned uint64
+	version uint64
+}
+
+// activeUpkeepIDs returns the active upkeep ids at the provided block sorted
+// by id. The set is scanned again when no snapshot exists, the last scan is
+// more than ActiveUpkeepReconcileBlocks behind the block, or the last applied
+// block was reorged out. Blocks before the last applied block are scanned
+// without changing the tracked set. Registry calls are made on a copy of the
+// set such that the set is not locked while calls are made.
+func (r *evmRegistryv2_0) activeUpkeepIDs(ctx context.Context, ref blockRef) ([]*big.Int, error) {
+	block := ref.number.Uint64()
+
+	current := r.activeUpkeeps.snapshot()
+
+	if block < current.block {
+		active, _, err := r.scanActiveUpkeeps(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		return sortedIDs(active), nil
+	}
+
+	rescan := current.block == 0 || block-current.scanned >= ActiveUpkeepReconcileBlocks
+	if !rescan {
+		reorged, err := r.blockReorged(ctx, current.block, current.hash)
+		if err != nil {
+			return nil, err
+		}
+
+		rescan = reorged
+	}
+
+	if !rescan && block > current.block {
+		applied, err := r.applyActiveUpkeepEvents(ctx, current, block)
+		if err != nil {
+			return nil, err
+		}
+
+		// events of removed logs cannot be rolled back from the set
+		rescan = !applied
+	}
+
+	if rescan {
+		active, paused, err := r.scanActiveUpkeeps(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		current = activeUpkeepSnapshot{
+			active:  active,
+			paused:  paused,
+			scanned: block,
+			version: current.version,
+		}
+	}
+
+	current.block = block
+	current.hash = ref.hash
+	r.activeUpkeeps.update(current)
+
+	return sortedIDs(current.active), nil
+}
+
+// blockReorged indicates whether a block with the provided hash was reorged
+// out of the canonical chain. The canonical hash is taken from heads
+// delivered by the client and fetched otherwise. A block without a known
+// hash cannot be checked.
+func (r *evmRegistryv2_0) blockReorged(ctx context.Context, block uint64, hash common.Hash) (bool, error) {
+	if hash == (common.Hash{}) {
+		return false, nil
+	}
+
+	if hasher, ok := r.client.(headHasher); ok {
+		if canonical, ok := hasher.headHash(block); ok {
+			return canonical != hash, nil
+		}
+	}
+
+	header, err := r.client.HeaderByNumber(ctx, new(big.Int).SetUint64(block))
+	if err != nil {
+		return false, fmt.Errorf("%w: %s: EVM failed to fetch block header", err, ErrRegistryCallFailure)
+	}
+
+	return header.Hash() != hash, nil
+}
+
+// scanActiveUpkeeps pages through all upkeep ids of the registry and splits
+// them into active and paused upkeeps. All calls are made on the same block.
+func (r *evmRegistryv2_0) scanActiveUpkeeps(ctx context.Context, ref blockRef) (map[string]*big.Int, map[string]*big.Int, error) {
+	registry, err := r.callerAt(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := &bind.CallOpts{
+		Context:     ctx,
+		BlockNumber: ref.number,
+	}
+
+	state, err := registry.GetState(opts)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get contract state at block number %d", ref.number.Int64())
+	}
+
+	ids := make([]*big.Int, 0)
+	for int64(len(ids)) < state.State.NumUpkeeps.Int64() {
+		startIndex := int64(len(ids))
+		maxCount := state.State.NumUpkeeps.Int64() - int64(len(ids))
+
+		if maxCount > ActiveUpkeepIDBatchSize {
+			maxCount = ActiveUpkeepIDBatchSize
+		}
+
+		nextIDs, err := registry.GetActiveUpkeepIDs(opts, big.NewInt(startIndex), big.NewInt(maxCount))
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to get active upkeep IDs from index %d to %d (both inclusive)", startIndex, startIndex+maxCount-1)
+		}
+
+		if len(nextIDs) == 0 {
+			break
+		}
+
+		ids = append(ids, nextIDs...)
+	}
+
+	paused, err := r.pausedUpkeeps(ctx, ref, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	active := make(map[string]*big.Int, len(ids))
+	for _, id := range ids {
+		if _, ok := paused[id.String()]; !ok {
+			active[id.String()] = id
+		}
+	}
+
+	return active, paused, nil
+}
+
+// pausedUpkeeps returns the provided upkeeps that are paused at the block.
+// The upkeeps are fetched in batch calls of at most UpkeepInfoBatchSize
+// upkeeps.
+func (r *evmRegistryv2_0) pausedUpkeeps(ctx context.Context, ref blockRef, ids []*big.Int) (map[string]*big.Int, error) {
+	paused := make(map[string]*big.Int)
+
+	for start := 0; start < len(ids); start += UpkeepInfoBatchSize {
+		end := start + UpkeepInfoBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		if err := r.fetchPausedUpkeeps(ctx, ref, ids[start:end], paused); err != nil {
+			return nil, err
+		}
+	}
+
+	return paused, nil
+}
+
+// fetchPausedUpkeeps adds the provided upkeeps that are paused at the block
+// to paused in a single batch call
+func (r *evmRegistryv2_0) fetchPausedUpkeeps(ctx context.Context, ref blockRef, ids []*big.Int, paused map[string]*big.Int) error {
+	var (
+		reqs    = make([]rpc.BatchElem, len(ids))
+		results = make([]*string, len(ids))
+	)
+
+	for i, id := range ids {
+		payload, err := keeperRegistryABI.Pack("getUpkeep", id)
+		if err != nil {
+			return err
+		}
+
+		var result string
+		reqs[i] = rpc.BatchElem{
+			Method: "eth_call",
+			Args: []interface{}{
+				map[string]interface{}{
+					"to":   r.address.Hex(),
+					"data": hexutil.Bytes(payload),
+				},
+				ref.callArg(),
+			},
+			Result: &result,
+		}
+
+		results[i] = &result
+	}
+
+	if err := r.client.BatchCallContext(ctx, reqs); err != nil {
+		return fmt.Errorf("%w: %s: failed to get upkeeps", err, ErrRegistryCallFailure)
+	}
+
+	var err error
+	for i, req := range reqs {
+		if req.Error != nil {
+			if strings.Contains(req.Error.Error(), "reverted") {
+				// upkeep does not exist at the block
+				continue
+			}
+			// some other error
+			multierr.AppendInto(&err, req.Error)
+			continue
+		}
+
+		info, uErr := unmarshalGetUpkeepResult(*results[i])
+		if uErr != nil {
+			return uErr
+		}
+
+		if info.Paused {
+			paused[ids[i].String()] = ids[i]
+		}
+	}
+
+	return err
+}
+
+// applyActiveUpkeepEvents updates the snapshot with registry events between
+// the block of the snapshot and the provided block. The events are not
+// applied when a log was removed by a reorg since the removed event cannot be
+// rolled back; false is returned such that the set is scanned again.
+func (r *evmRegistryv2_0) applyActiveUpkeepEvents(ctx context.Context, set activeUpkeepSnapshot, block uint64) (bool, error) {
+	logs, err := r.client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(set.block + 1),
+		ToBlock:   new(big.Int).SetUint64(block),
+		Addresses: []common.Address{r.address},
+		Topics:    [][]common.Hash{activeUpkeepTopics},
+	})
+	if err != nil {
+		return false, fmt.Errorf("%w: %s: failed to filter active upkeep events", err, ErrRegistryCallFailure)
+	}
+
+	for _, log := range logs {
+		if log.Removed {
+			return false, nil
+		}
+	}
+
+	for _, log := range logs {
+		if err := r.applyActiveUpkeepEvent(set, log); err != nil {
+			return false, fmt.Errorf("%w: failed to apply active upkeep event in transaction %s", err, log.TxHash)
+		}
+	}
+
+	return true, nil
+}
+
+func (r *evmRegistryv2_0) applyActiveUpkeepEvent(set activeUpkeepSnapshot, log ethtypes.Log) error {
+	if len(log.Topics) == 0 {
+		return fmt.Errorf("log without topics")
+	}
+
+	switch log.Topics[0] {
+	case keeperRegistryABI.Events["UpkeepRegistered"].ID:
+		event, err := r.filterer.ParseUpkeepRegistered(log)
+		if err != nil {
+			return err
+		}
+
+		set.active[event.Id.String()] = event.Id
+	case keeperRegistryABI.Events["UpkeepReceived"].ID:
+		event, err := r.filterer.ParseUpkeepReceived(log)
+		if err != nil {
+			return err
+		}
+
+		set.active[event.Id.String()] = event.Id
+	case keeperRegistryABI.Events["UpkeepCanceled"].ID:
+		event, err := r.filterer.ParseUpkeepCanceled(log)
+		if err != nil {
+			return err
+		}
+
+		delete(set.active, event.Id.String())
+		delete(set.paused, event.Id.String())
+	case keeperRegistryABI.Events["UpkeepMigrated"].ID:
+		event, err := r.filterer.ParseUpkeepMigrated(log)
+		if err != nil {
+			return err
+		}
+
+		delete(set.active, event.Id.String())
+		delete(set.paused, event.Id.String())
+	case keeperRegistryABI.Events["UpkeepPaused"].ID:
+		event, err := r.filterer.ParseUpkeepPaused(log)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := set.active[event.Id.String()]; ok {
+			delete(set.active, event.Id.String())
+			set.paused[event.Id.String()] = event.Id
+		}
+	case keeperRegistryABI.Events["UpkeepUnpaused"].ID:
+		event, err := r.filterer.ParseUpkeepUnpaused(log)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := set.paused[event.Id.String()]; ok {
+			delete(set.paused, event.Id.String())
+			set.active[event.Id.String()] = event.Id
+		}
+	}
+
+	return nil
+}
+
+func sortedIDs(ids map[string]*big.Int) []*big.Int {
+	sorted := make([]*big.Int, 0, len(ids))
+	for _, id := range ids {
+		sorted = append(sorted, id)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Cmp(sorted[j]) < 0
+	})
+
+	return sorted
+}
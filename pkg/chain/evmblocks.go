@@ -0,0 +1,141 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+const (
+	// blockHashCacheSize is the number of blocks before the latest head for
+	// which head hashes are kept
+	blockHashCacheSize = 256
+)
+
+// headHasher is implemented by clients that record the hashes of the heads
+// delivered to head subscribers
+type headHasher interface {
+	headHash(number uint64) (common.Hash, bool)
+}
+
+// blockRef identifies a block by number and, when known, by hash
+type blockRef struct {
+	number *big.Int
+	hash   common.Hash
+}
+
+// callArg returns the block parameter for calls at the block. Blocks with a
+// known hash are called by hash as an EIP-1898 parameter such that the call
+// is made on the same block regardless of the RPC backend that serves it.
+// The block is required to be canonical such that a call on a block that was
+// reorged out fails instead of returning state of an orphaned block. Blocks
+// without a known hash are called by number.
+func (b blockRef) callArg() interface{} {
+	if b.hash == (common.Hash{}) {
+		return hexutil.EncodeBig(b.number)
+	}
+
+	return rpc.BlockNumberOrHashWithHash(b.hash, true)
+}
+
+// blockHashCache keeps the hashes of recent heads by block number
+type blockHashCache struct {
+	mu     sync.Mutex
+	hashes map[uint64]common.Hash
+}
+
+func newBlockHashCache() *blockHashCache {
+	return &blockHashCache{
+		hashes: make(map[uint64]common.Hash),
+	}
+}
+
+func (c *blockHashCache) get(number uint64) (common.Hash, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hash, ok := c.hashes[number]
+
+	return hash, ok
+}
+
+// set stores the hash of a new head and replaces a hash stored for the same
+// block number. The head is the tip of the chain such that hashes of later
+// blocks are from a reorged out chain and are evicted. Hashes of earlier
+// blocks are evicted when the parent of the head does not match the stored
+// parent since the reorg point is below the head and is not known.
+func (c *blockHashCache) set(number uint64, hash, parent common.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if stored, ok := c.hashes[number]; ok && stored == hash {
+		return
+	}
+
+	var reorgedParent bool
+	if number > 0 {
+		stored, ok := c.hashes[number-1]
+		reorgedParent = ok && stored != parent
+	}
+
+	for n := range c.hashes {
+		if n > number || (reorgedParent && n < number) || n+blockHashCacheSize <= number {
+			delete(c.hashes, n)
+		}
+	}
+
+	c.hashes[number] = hash
+}
+
+// blockHashCaller makes contract calls at a block by hash
+type blockHashCaller struct {
+	client types.EVMClient
+	block  blockRef
+}
+
+// CodeAt returns the code of the contract at the block number of the caller.
+// The provided block number is ignored.
+func (c *blockHashCaller) CodeAt(ctx context.Context, contract common.Address, _ *big.Int) ([]byte, error) {
+	return c.client.CodeAt(ctx, contract, c.block.number)
+}
+
+// CallContract calls the contract at the block hash of the caller. The
+// provided block number is ignored.
+func (c *blockHashCaller) CallContract(ctx context.Context, call ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	if call.To == nil {
+		return nil, fmt.Errorf("contract call without address")
+	}
+
+	var result string
+	reqs := []rpc.BatchElem{
+		{
+			Method: "eth_call",
+			Args: []interface{}{
+				map[string]interface{}{
+					"to":   call.To.Hex(),
+					"data": hexutil.Bytes(call.Data),
+				},
+				c.block.callArg(),
+			},
+			Result: &result,
+		},
+	}
+
+	if err := c.client.BatchCallContext(ctx, reqs); err != nil {
+		return nil, err
+	}
+
+	if reqs[0].Error != nil {
+		return nil, reqs[0].Error
+	}
+
+	return hexutil.Decode(result)
+}
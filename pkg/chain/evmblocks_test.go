@@ -0,0 +1,117 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+func TestBlockRef_CallArg(t *testing.T) {
+	ref := blockRef{number: big.NewInt(42)}
+	assert.Equal(t, hexutil.EncodeBig(big.NewInt(42)), ref.callArg(), "blocks without a hash are called by number")
+
+	hash := common.HexToHash("0x01")
+	ref.hash = hash
+	assert.Equal(t, rpc.BlockNumberOrHashWithHash(hash, true), ref.callArg(), "blocks with a hash are called by canonical hash")
+}
+
+func TestBlockHashCache(t *testing.T) {
+	hash := func(n int64) common.Hash {
+		return common.BigToHash(big.NewInt(n))
+	}
+
+	t.Run("heads extend the chain", func(t *testing.T) {
+		c := newBlockHashCache()
+		c.set(1, hash(1), hash(0))
+		c.set(2, hash(2), hash(1))
+
+		h, ok := c.get(1)
+		assert.True(t, ok)
+		assert.Equal(t, hash(1), h)
+
+		h, ok = c.get(2)
+		assert.True(t, ok)
+		assert.Equal(t, hash(2), h)
+
+		_, ok = c.get(3)
+		assert.False(t, ok)
+	})
+
+	t.Run("a head replaces a reorged head and evicts later heads", func(t *testing.T) {
+		c := newBlockHashCache()
+		c.set(1, hash(1), hash(0))
+		c.set(2, hash(2), hash(1))
+		c.set(3, hash(3), hash(2))
+
+		c.set(2, hash(22), hash(1))
+
+		h, ok := c.get(2)
+		assert.True(t, ok)
+		assert.Equal(t, hash(22), h)
+
+		_, ok = c.get(3)
+		assert.False(t, ok, "heads after the reorg point are evicted")
+
+		_, ok = c.get(1)
+		assert.True(t, ok, "the matching parent is kept")
+	})
+
+	t.Run("a head with a reorged parent evicts earlier heads", func(t *testing.T) {
+		c := newBlockHashCache()
+		c.set(1, hash(1), hash(0))
+		c.set(2, hash(2), hash(1))
+
+		c.set(3, hash(33), hash(22))
+
+		_, ok := c.get(1)
+		assert.False(t, ok)
+
+		_, ok = c.get(2)
+		assert.False(t, ok)
+
+		h, ok := c.get(3)
+		assert.True(t, ok)
+		assert.Equal(t, hash(33), h)
+	})
+
+	t.Run("a repeated head does not evict", func(t *testing.T) {
+		c := newBlockHashCache()
+		c.set(1, hash(1), hash(0))
+		c.set(2, hash(2), hash(1))
+		c.set(1, hash(1), hash(0))
+
+		_, ok := c.get(2)
+		assert.True(t, ok)
+	})
+
+	t.Run("old heads are evicted", func(t *testing.T) {
+		c := newBlockHashCache()
+		c.set(1, hash(1), hash(0))
+		c.set(1+blockHashCacheSize, hash(2), common.Hash{})
+
+		_, ok := c.get(1)
+		assert.False(t, ok)
+	})
+}
+
+func TestEVMClient_HeadHash(t *testing.T) {
+	client := &evmClient{heads: newBlockHashCache()}
+
+	_, ok := client.HeadHash(types.BlockKey("42"))
+	assert.False(t, ok)
+
+	client.heads.set(42, common.HexToHash("0x01"), common.Hash{})
+
+	hash, ok := client.HeadHash(types.BlockKey("42"))
+	assert.True(t, ok)
+	assert.Equal(t, common.HexToHash("0x01").Hex(), hash)
+
+	_, ok = client.HeadHash(types.BlockKey("not a block"))
+	assert.False(t, ok)
+}
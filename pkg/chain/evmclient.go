@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	ethtypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
@@ -21,14 +22,19 @@ type evmClient struct {
 	*ethclient.Client
 	rpcClient *rpc.Client
 	batchSize int
+	// heads keeps the hashes of heads delivered by OnNewHead
+	heads *blockHashCache
 }
 
+var _ types.HeadHasher = (*evmClient)(nil)
+
 // NewEVMClient is the constructor of evmClient
 func NewEVMClient(client *rpc.Client, batchSize int) types.EVMClient {
 	return &evmClient{
 		Client:    ethclient.NewClient(client),
 		rpcClient: client,
 		batchSize: batchSize,
+		heads:     newBlockHashCache(),
 	}
 }
 
@@ -77,11 +83,35 @@ func (ec *evmClient) OnNewHead(ctx context.Context, cb func(blockKey types.Block
 				return err
 			}
 		case head := <-ch:
+			ec.heads.set(head.Number.Uint64(), head.Hash(), head.ParentHash)
 			cb(types.BlockKey(head.Number.String()))
 		}
 	}
 }
 
+// headHash returns the hash of a head delivered by OnNewHead. A head replaces
+// an earlier head with the same block number and evicts the heads it reorged
+// out.
+func (ec *evmClient) headHash(number uint64) (common.Hash, bool) {
+	return ec.heads.get(number)
+}
+
+// HeadHash returns the hash of the latest head delivered by OnNewHead at the
+// provided block
+func (ec *evmClient) HeadHash(block types.BlockKey) (string, bool) {
+	number, ok := new(big.Int).SetString(string(block), 10)
+	if !ok || !number.IsUint64() {
+		return "", false
+	}
+
+	hash, ok := ec.heads.get(number.Uint64())
+	if !ok {
+		return "", false
+	}
+
+	return hash.Hex(), true
+}
+
 func (ec *evmClient) createBatches(b []rpc.BatchElem) (batches [][]rpc.BatchElem) {
 	for i := 0; i < len(b); i += ec.batchSize {
 		j := i + ec.batchSize
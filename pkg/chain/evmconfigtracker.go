@@ -0,0 +1,119 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	ocr2types "github.com/smartcontractkit/libocr/offchainreporting2/types"
+
+	"github.com/smartcontractkit/ocr2keepers/pkg/chain/gethwrappers/keeper_registry_wrapper2_0"
+	"github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+// evmContractConfigTracker implements ocr2types.ContractConfigTracker
+// interface for the keeper registry 2.0
+type evmContractConfigTracker struct {
+	registry *keeper_registry_wrapper2_0.KeeperRegistryCaller
+	filterer *keeper_registry_wrapper2_0.KeeperRegistryFilterer
+	client   types.EVMClient
+}
+
+// NewEVMContractConfigTracker is the constructor of evmContractConfigTracker
+func NewEVMContractConfigTracker(address common.Address, client types.EVMClient) (*evmContractConfigTracker, error) {
+	registry, err := keeper_registry_wrapper2_0.NewKeeperRegistryCaller(address, client)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create caller for address and backend", ErrInitializationFailure)
+	}
+
+	filterer, err := keeper_registry_wrapper2_0.NewKeeperRegistryFilterer(address, client)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create filterer for address and backend", ErrInitializationFailure)
+	}
+
+	return &evmContractConfigTracker{
+		registry: registry,
+		filterer: filterer,
+		client:   client,
+	}, nil
+}
+
+// Notify returns nil since config changes are only detected by polling
+func (t *evmContractConfigTracker) Notify() <-chan struct{} {
+	return nil
+}
+
+// LatestConfigDetails returns the block the latest config was set in and its
+// config digest
+func (t *evmContractConfigTracker) LatestConfigDetails(ctx context.Context) (uint64, ocr2types.ConfigDigest, error) {
+	details, err := t.registry.LatestConfigDetails(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return 0, ocr2types.ConfigDigest{}, fmt.Errorf("%w: %s: failed to get latest config details", err, ErrRegistryCallFailure)
+	}
+
+	return uint64(details.BlockNumber), details.ConfigDigest, nil
+}
+
+// LatestConfig returns the config from the last ConfigSet event in the
+// provided block
+func (t *evmContractConfigTracker) LatestConfig(ctx context.Context, changedInBlock uint64) (ocr2types.ContractConfig, error) {
+	iter, err := t.filterer.FilterConfigSet(&bind.FilterOpts{
+		Start:   changedInBlock,
+		End:     &changedInBlock,
+		Context: ctx,
+	})
+	if err != nil {
+		return ocr2types.ContractConfig{}, fmt.Errorf("%w: %s: failed to filter ConfigSet events", err, ErrRegistryCallFailure)
+	}
+
+	var latest *keeper_registry_wrapper2_0.KeeperRegistryConfigSet
+	for iter.Next() {
+		if !iter.Event.Raw.Removed {
+			latest = iter.Event
+		}
+	}
+
+	if err := closeIterator(iter.Error(), iter.Close()); err != nil {
+		return ocr2types.ContractConfig{}, fmt.Errorf("%w: %s: failed to read ConfigSet events", err, ErrRegistryCallFailure)
+	}
+
+	if latest == nil {
+		return ocr2types.ContractConfig{}, fmt.Errorf("%w: no ConfigSet event in block %d", ErrRegistryCallFailure, changedInBlock)
+	}
+
+	return contractConfigFromConfigSetEvent(*latest), nil
+}
+
+// LatestBlockHeight returns the number of the latest block
+func (t *evmContractConfigTracker) LatestBlockHeight(ctx context.Context) (uint64, error) {
+	header, err := t.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: EVM failed to fetch block header", err, ErrRegistryCallFailure)
+	}
+
+	return header.Number.Uint64(), nil
+}
+
+func contractConfigFromConfigSetEvent(changed keeper_registry_wrapper2_0.KeeperRegistryConfigSet) ocr2types.ContractConfig {
+	signers := make([]ocr2types.OnchainPublicKey, len(changed.Signers))
+	for i, addr := range changed.Signers {
+		signers[i] = ocr2types.OnchainPublicKey(addr.Bytes())
+	}
+
+	transmitters := make([]ocr2types.Account, len(changed.Transmitters))
+	for i, addr := range changed.Transmitters {
+		transmitters[i] = ocr2types.Account(addr.Hex())
+	}
+
+	return ocr2types.ContractConfig{
+		ConfigDigest:          changed.ConfigDigest,
+		ConfigCount:           changed.ConfigCount,
+		Signers:               signers,
+		Transmitters:          transmitters,
+		F:                     changed.F,
+		OnchainConfig:         changed.OnchainConfig,
+		OffchainConfigVersion: changed.OffchainConfigVersion,
+		OffchainConfig:        changed.OffchainConfig,
+	}
+}
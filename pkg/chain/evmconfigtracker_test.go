@@ -0,0 +1,84 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	ocr2types "github.com/smartcontractkit/libocr/offchainreporting2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+func TestEVMContractConfigTracker(t *testing.T) {
+	ctx := context.Background()
+	mockClient := types.NewMockEVMClient(t)
+
+	tracker, err := NewEVMContractConfigTracker(common.Address{}, mockClient)
+	require.NoError(t, err)
+
+	assert.Nil(t, tracker.Notify())
+
+	digest := [32]byte{0x01}
+
+	t.Run("LatestConfigDetails", func(t *testing.T) {
+		receiver := NewContractMockReceiver(t, mockClient, keeperRegistryABI)
+		receiver.MockResponse("latestConfigDetails", uint32(2), uint32(10), digest).Once()
+
+		block, d, err := tracker.LatestConfigDetails(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(10), block)
+		assert.Equal(t, ocr2types.ConfigDigest(digest), d)
+	})
+
+	t.Run("LatestConfig", func(t *testing.T) {
+		configSet := keeperRegistryABI.Events["ConfigSet"]
+		signers := []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x02")}
+		transmitters := []common.Address{common.HexToAddress("0x03"), common.HexToAddress("0x04")}
+
+		data, err := configSet.Inputs.Pack(uint32(5), digest, uint64(2), signers, transmitters, uint8(1), []byte("onchain"), uint64(3), []byte("offchain"))
+		require.NoError(t, err)
+
+		mockClient.On("FilterLogs", ctx, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+			return q.FromBlock.Int64() == 10 && q.ToBlock.Int64() == 10 && q.Topics[0][0] == configSet.ID
+		})).Return([]ethtypes.Log{{Topics: []common.Hash{configSet.ID}, Data: data, BlockNumber: 10}}, nil).Once()
+
+		config, err := tracker.LatestConfig(ctx, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, ocr2types.ContractConfig{
+			ConfigDigest:          digest,
+			ConfigCount:           2,
+			Signers:               []ocr2types.OnchainPublicKey{signers[0].Bytes(), signers[1].Bytes()},
+			Transmitters:          []ocr2types.Account{ocr2types.Account(transmitters[0].Hex()), ocr2types.Account(transmitters[1].Hex())},
+			F:                     1,
+			OnchainConfig:         []byte("onchain"),
+			OffchainConfigVersion: 3,
+			OffchainConfig:        []byte("offchain"),
+		}, config)
+	})
+
+	t.Run("LatestConfig Not Found", func(t *testing.T) {
+		mockClient.On("FilterLogs", ctx, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+			return q.FromBlock.Int64() == 11
+		})).Return([]ethtypes.Log{}, nil).Once()
+
+		_, err := tracker.LatestConfig(ctx, 11)
+		assert.ErrorIs(t, err, ErrRegistryCallFailure)
+	})
+
+	t.Run("LatestBlockHeight", func(t *testing.T) {
+		mockClient.On("HeaderByNumber", ctx, (*big.Int)(nil)).
+			Return(&ethtypes.Header{Number: big.NewInt(20)}, nil).
+			Once()
+
+		height, err := tracker.LatestBlockHeight(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(20), height)
+	})
+}
@@ -0,0 +1,345 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.uber.org/multierr"
+
+	"github.com/smartcontractkit/ocr2keepers/pkg/chain/gethwrappers/keeper_registry_wrapper2_0"
+	"github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+// DefaultPerformLogLookback is the default number of blocks polled for perform
+// logs ending at the latest head
+const DefaultPerformLogLookback int64 = 200
+
+var _ types.PerformLogChain = (*evmPerformLogProvider)(nil)
+
+// evmPerformLogProvider implements types.PerformLogProvider interface
+type evmPerformLogProvider struct {
+	filterer *keeper_registry_wrapper2_0.KeeperRegistryFilterer
+	client   types.EVMClient
+	lookback uint64
+
+	mu       sync.Mutex
+	lastHead uint64
+	lastHash common.Hash
+	lastLogs []types.PerformLog
+	// checkBlocks caches the check block of each upkeep id in a transmitted
+	// report by transaction hash. events that only include an upkeep id are
+	// mapped to upkeep keys with this cache.
+	checkBlocks map[common.Hash]map[string]uint32
+}
+
+// NewEVMPerformLogProvider is the constructor of evmPerformLogProvider. Logs
+// are polled in a rolling window of lookback blocks ending at the latest head.
+// A lookback of 0 or less results in DefaultPerformLogLookback.
+func NewEVMPerformLogProvider(address common.Address, client types.EVMClient, lookback int64) (*evmPerformLogProvider, error) {
+	filterer, err := keeper_registry_wrapper2_0.NewKeeperRegistryFilterer(address, client)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create filterer for address and backend", ErrInitializationFailure)
+	}
+
+	if lookback <= 0 {
+		lookback = DefaultPerformLogLookback
+	}
+
+	return &evmPerformLogProvider{
+		filterer:    filterer,
+		client:      client,
+		lookback:    uint64(lookback),
+		checkBlocks: make(map[common.Hash]map[string]uint32),
+	}, nil
+}
+
+// PerformLogs returns logs for upkeeps that were performed and upkeeps that
+// were transmitted in a report but not performed because the report was
+// reorged, stale, or the upkeep had insufficient funds. Logs of reorged
+// reports are flagged as reorged. Logs are sorted by block and log index.
+func (p *evmPerformLogProvider) PerformLogs(ctx context.Context) ([]types.PerformLog, error) {
+	header, err := p.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: EVM failed to fetch block header", err, ErrRegistryCallFailure)
+	}
+
+	head := header.Number.Uint64()
+	hash := header.Hash()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// logs do not change until the next head. a head that replaced the last
+	// polled head at the same height is polled again.
+	if head == p.lastHead && hash == p.lastHash && p.lastLogs != nil {
+		return copyPerformLogs(p.lastLogs), nil
+	}
+
+	var start uint64
+	if head >= p.lookback {
+		start = head - p.lookback + 1
+	}
+
+	opts := &bind.FilterOpts{
+		Start:   start,
+		End:     &head,
+		Context: ctx,
+	}
+
+	keyed, unkeyed, err := p.filterEvents(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.fetchCheckBlocks(ctx, unkeyed); err != nil {
+		return nil, err
+	}
+
+	inWindow := make(map[common.Hash]struct{})
+	for _, l := range unkeyed {
+		inWindow[l.raw.TxHash] = struct{}{}
+
+		block, ok := p.checkBlocks[l.raw.TxHash][l.id.String()]
+		if !ok {
+			// the upkeep id could not be found in the transmitted report
+			continue
+		}
+
+		keyed = append(keyed, keyedLog{
+			key:     BlockAndIdToKey(new(big.Int).SetUint64(uint64(block)), l.id),
+			raw:     l.raw,
+			reorged: l.reorged,
+		})
+	}
+
+	// only keep transactions in the current window
+	for hash := range p.checkBlocks {
+		if _, ok := inWindow[hash]; !ok {
+			delete(p.checkBlocks, hash)
+		}
+	}
+
+	sort.Slice(keyed, func(i, j int) bool {
+		if keyed[i].raw.BlockNumber != keyed[j].raw.BlockNumber {
+			return keyed[i].raw.BlockNumber < keyed[j].raw.BlockNumber
+		}
+
+		return keyed[i].raw.Index < keyed[j].raw.Index
+	})
+
+	logs := make([]types.PerformLog, len(keyed))
+	for i, l := range keyed {
+		logs[i] = types.PerformLog{
+			Key:             l.key,
+			TransmitBlock:   types.BlockKey(strconv.FormatUint(l.raw.BlockNumber, 10)),
+			Confirmations:   int64(head - l.raw.BlockNumber),
+			TransactionHash: l.raw.TxHash.Hex(),
+			BlockNumber:     int64(l.raw.BlockNumber),
+			BlockHash:       l.raw.BlockHash.Hex(),
+			Reorged:         l.reorged,
+		}
+	}
+
+	p.lastHead = head
+	p.lastHash = hash
+	p.lastLogs = logs
+
+	return copyPerformLogs(logs), nil
+}
+
+// PerformLogLookback returns the number of blocks polled for perform logs
+func (p *evmPerformLogProvider) PerformLogLookback() int64 {
+	return int64(p.lookback)
+}
+
+// PolledHead returns the head of the last poll for perform logs
+func (p *evmPerformLogProvider) PolledHead() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return int64(p.lastHead)
+}
+
+// BlockHash returns the hash of a block in the canonical chain in the format
+// of the block hash of perform logs
+func (p *evmPerformLogProvider) BlockHash(ctx context.Context, block int64) (string, error) {
+	header, err := p.client.HeaderByNumber(ctx, big.NewInt(block))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: EVM failed to fetch block header", err, ErrRegistryCallFailure)
+	}
+
+	return header.Hash().Hex(), nil
+}
+
+type keyedLog struct {
+	key     types.UpkeepKey
+	raw     ethtypes.Log
+	reorged bool
+}
+
+type idLog struct {
+	id      *big.Int
+	raw     ethtypes.Log
+	reorged bool
+}
+
+// filterEvents returns UpkeepPerformed events mapped to upkeep keys and report
+// events that only include an upkeep id
+func (p *evmPerformLogProvider) filterEvents(opts *bind.FilterOpts) ([]keyedLog, []idLog, error) {
+	keyed := make([]keyedLog, 0)
+	unkeyed := make([]idLog, 0)
+
+	performed, err := p.filterer.FilterUpkeepPerformed(opts, nil, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: failed to filter UpkeepPerformed events", err, ErrRegistryCallFailure)
+	}
+
+	for performed.Next() {
+		if performed.Event.Raw.Removed {
+			continue
+		}
+
+		keyed = append(keyed, keyedLog{
+			key: BlockAndIdToKey(new(big.Int).SetUint64(uint64(performed.Event.CheckBlockNumber)), performed.Event.Id),
+			raw: performed.Event.Raw,
+		})
+	}
+
+	if err := closeIterator(performed.Error(), performed.Close()); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: failed to read UpkeepPerformed events", err, ErrRegistryCallFailure)
+	}
+
+	reorged, err := p.filterer.FilterReorgedUpkeepReport(opts, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: failed to filter ReorgedUpkeepReport events", err, ErrRegistryCallFailure)
+	}
+
+	for reorged.Next() {
+		if !reorged.Event.Raw.Removed {
+			unkeyed = append(unkeyed, idLog{id: reorged.Event.Id, raw: reorged.Event.Raw, reorged: true})
+		}
+	}
+
+	if err := closeIterator(reorged.Error(), reorged.Close()); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: failed to read ReorgedUpkeepReport events", err, ErrRegistryCallFailure)
+	}
+
+	stale, err := p.filterer.FilterStaleUpkeepReport(opts, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: failed to filter StaleUpkeepReport events", err, ErrRegistryCallFailure)
+	}
+
+	for stale.Next() {
+		if !stale.Event.Raw.Removed {
+			unkeyed = append(unkeyed, idLog{id: stale.Event.Id, raw: stale.Event.Raw})
+		}
+	}
+
+	if err := closeIterator(stale.Error(), stale.Close()); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: failed to read StaleUpkeepReport events", err, ErrRegistryCallFailure)
+	}
+
+	insufficient, err := p.filterer.FilterInsufficientFundsUpkeepReport(opts, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: failed to filter InsufficientFundsUpkeepReport events", err, ErrRegistryCallFailure)
+	}
+
+	for insufficient.Next() {
+		if !insufficient.Event.Raw.Removed {
+			unkeyed = append(unkeyed, idLog{id: insufficient.Event.Id, raw: insufficient.Event.Raw})
+		}
+	}
+
+	if err := closeIterator(insufficient.Error(), insufficient.Close()); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: failed to read InsufficientFundsUpkeepReport events", err, ErrRegistryCallFailure)
+	}
+
+	return keyed, unkeyed, nil
+}
+
+type rpcTransaction struct {
+	Input hexutil.Bytes `json:"input"`
+}
+
+// fetchCheckBlocks decodes the transmitted reports of transactions not yet in
+// the cache
+func (p *evmPerformLogProvider) fetchCheckBlocks(ctx context.Context, logs []idLog) error {
+	var (
+		txReqs    = make([]rpc.BatchElem, 0)
+		txResults = make([]**rpcTransaction, 0)
+		txHashes  = make([]common.Hash, 0)
+		requested = make(map[common.Hash]struct{})
+	)
+
+	for _, l := range logs {
+		if _, ok := p.checkBlocks[l.raw.TxHash]; ok {
+			continue
+		}
+
+		if _, ok := requested[l.raw.TxHash]; ok {
+			continue
+		}
+
+		var result *rpcTransaction
+		txReqs = append(txReqs, rpc.BatchElem{
+			Method: "eth_getTransactionByHash",
+			Args:   []interface{}{l.raw.TxHash},
+			Result: &result,
+		})
+
+		txResults = append(txResults, &result)
+		txHashes = append(txHashes, l.raw.TxHash)
+		requested[l.raw.TxHash] = struct{}{}
+	}
+
+	if len(txReqs) == 0 {
+		return nil
+	}
+
+	if err := p.client.BatchCallContext(ctx, txReqs); err != nil {
+		return err
+	}
+
+	var err error
+	for i, req := range txReqs {
+		if req.Error != nil {
+			multierr.AppendInto(&err, req.Error)
+			continue
+		}
+
+		tx := *txResults[i]
+		if tx == nil {
+			// transaction not found; try again on the next poll
+			continue
+		}
+
+		blocks, dErr := decodeTransmitCheckBlocks(tx.Input)
+		if dErr != nil {
+			// not a transmit transaction; cache as empty to not fetch again
+			blocks = map[string]uint32{}
+		}
+
+		p.checkBlocks[txHashes[i]] = blocks
+	}
+
+	return err
+}
+
+func closeIterator(iterErr error, closeErr error) error {
+	return multierr.Combine(iterErr, closeErr)
+}
+
+func copyPerformLogs(logs []types.PerformLog) []types.PerformLog {
+	c := make([]types.PerformLog, len(logs))
+	copy(c, logs)
+	return c
+}
@@ -0,0 +1,136 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+func TestEVMPerformLogProvider_PerformLogs(t *testing.T) {
+	mockClient := types.NewMockEVMClient(t)
+	ctx := context.Background()
+
+	provider, err := NewEVMPerformLogProvider(common.Address{}, mockClient, 10)
+	require.NoError(t, err)
+
+	mockClient.On("HeaderByNumber", ctx, (*big.Int)(nil)).
+		Return(&ethtypes.Header{Number: big.NewInt(20)}, nil).
+		Twice()
+
+	performed := keeperRegistryABI.Events["UpkeepPerformed"]
+	performedData, err := performed.Inputs.NonIndexed().Pack(uint32(15), big.NewInt(0), big.NewInt(0), big.NewInt(0))
+	require.NoError(t, err)
+
+	performedTx := common.HexToHash("0x01")
+	reorgedTx := common.HexToHash("0x02")
+
+	logs := map[string][]ethtypes.Log{
+		"UpkeepPerformed": {
+			{
+				Topics:      []common.Hash{performed.ID, common.BigToHash(big.NewInt(1)), common.BigToHash(big.NewInt(1))},
+				Data:        performedData,
+				BlockNumber: 16,
+				BlockHash:   common.HexToHash("0x16"),
+				TxHash:      performedTx,
+			},
+		},
+		"ReorgedUpkeepReport": {
+			{
+				Topics:      []common.Hash{keeperRegistryABI.Events["ReorgedUpkeepReport"].ID, common.BigToHash(big.NewInt(2))},
+				BlockNumber: 18,
+				BlockHash:   common.HexToHash("0x18"),
+				TxHash:      reorgedTx,
+			},
+		},
+		"StaleUpkeepReport":             {},
+		"InsufficientFundsUpkeepReport": {},
+	}
+
+	for name, eventLogs := range logs {
+		id := keeperRegistryABI.Events[name].ID
+		mockClient.On("FilterLogs", ctx, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+			return q.FromBlock.Int64() == 11 && q.ToBlock.Int64() == 20 && q.Topics[0][0] == id
+		})).Return(eventLogs, nil).Once()
+	}
+
+	report, err := NewEVMReportEncoder().EncodeReport([]types.UpkeepResult{
+		{Key: types.UpkeepKey("17|2"), PerformData: []byte{}, FastGasWei: big.NewInt(0), LinkNative: big.NewInt(0), CheckBlockNumber: 17},
+	})
+	require.NoError(t, err)
+
+	input, err := keeperRegistryABI.Pack("transmit", [3][32]byte{}, report, [][32]byte{}, [][32]byte{}, [32]byte{})
+	require.NoError(t, err)
+
+	mockClient.On("BatchCallContext", ctx, mock.Anything).
+		Once().
+		Run(func(args mock.Arguments) {
+			batchElems := args.Get(1).([]rpc.BatchElem)
+			assert.Len(t, batchElems, 1)
+			assert.Equal(t, "eth_getTransactionByHash", batchElems[0].Method)
+			assert.Equal(t, reorgedTx, batchElems[0].Args[0])
+
+			*batchElems[0].Result.(**rpcTransaction) = &rpcTransaction{Input: input}
+		}).Return(nil)
+
+	expected := []types.PerformLog{
+		{Key: types.UpkeepKey("15|1"), TransmitBlock: types.BlockKey("16"), Confirmations: 4, TransactionHash: performedTx.Hex(), BlockNumber: 16, BlockHash: common.HexToHash("0x16").Hex()},
+		{Key: types.UpkeepKey("17|2"), TransmitBlock: types.BlockKey("18"), Confirmations: 2, TransactionHash: reorgedTx.Hex(), BlockNumber: 18, BlockHash: common.HexToHash("0x18").Hex(), Reorged: true},
+	}
+
+	result, err := provider.PerformLogs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	// logs are not polled again for the same head
+	result, err = provider.PerformLogs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	// the head of the poll and canonical block hashes confirm reorgs
+	assert.Equal(t, int64(10), provider.PerformLogLookback())
+	assert.Equal(t, int64(20), provider.PolledHead())
+
+	header := &ethtypes.Header{Number: big.NewInt(16)}
+	mockClient.On("HeaderByNumber", ctx, big.NewInt(16)).Return(header, nil).Once()
+
+	hash, err := provider.BlockHash(ctx, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, header.Hash().Hex(), hash)
+
+	// a head that replaces the polled head at the same height is polled again
+	mockClient.On("HeaderByNumber", ctx, (*big.Int)(nil)).
+		Return(&ethtypes.Header{Number: big.NewInt(20), Extra: []byte("reorg")}, nil).
+		Once()
+
+	for name := range logs {
+		id := keeperRegistryABI.Events[name].ID
+		mockClient.On("FilterLogs", ctx, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+			return q.FromBlock.Int64() == 11 && q.ToBlock.Int64() == 20 && q.Topics[0][0] == id
+		})).Return([]ethtypes.Log{}, nil).Once()
+	}
+
+	result, err = provider.PerformLogs(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+}
+
+func TestDecodeTransmitCheckBlocks_Error(t *testing.T) {
+	_, err := decodeTransmitCheckBlocks([]byte{0x01})
+	assert.Error(t, err)
+
+	input, err := keeperRegistryABI.Pack("checkUpkeep", big.NewInt(1))
+	require.NoError(t, err)
+
+	_, err = decodeTransmitCheckBlocks(input)
+	assert.Error(t, err)
+}
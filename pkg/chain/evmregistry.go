@@ -5,14 +5,15 @@ import (
 	"fmt"
 	"math/big"
 	"strings"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/rpc"
-	"github.com/pkg/errors"
 	"go.uber.org/multierr"
 
+	"github.com/smartcontractkit/ocr2keepers/internal/util"
 	"github.com/smartcontractkit/ocr2keepers/pkg/chain/gethwrappers/keeper_registry_wrapper2_0"
 	"github.com/smartcontractkit/ocr2keepers/pkg/types"
 )
@@ -20,6 +21,9 @@ import (
 const (
 	ActiveUpkeepIDBatchSize int64  = 10000
 	separator               string = "|"
+	// ExecuteGasCacheBlocks is the number of blocks after which a cached
+	// execute gas value that was not used or updated is evicted
+	ExecuteGasCacheBlocks uint64 = 1000
 )
 
 var (
@@ -41,9 +45,24 @@ type outStruct struct {
 type evmRegistryv2_0 struct {
 	address  common.Address
 	registry *keeper_registry_wrapper2_0.KeeperRegistryCaller
+	filterer *keeper_registry_wrapper2_0.KeeperRegistryFilterer
 	client   types.EVMClient
+
+	// executeGas caches the execute gas of each upkeep by upkeep id. cached
+	// values are updated from UpkeepGasLimitSet events up to executeGasBlock
+	// with hash executeGasHash. the cache is cleared when that block is
+	// reorged out.
+	executeGasMu    sync.Mutex
+	executeGas      map[string]executeGasEntry
+	executeGasBlock uint64
+	executeGasHash  common.Hash
+
+	// activeUpkeeps tracks the active upkeeps from registry events
+	activeUpkeeps *activeUpkeepSet
 }
 
+var _ types.IdentifierParser = (*evmRegistryv2_0)(nil)
+
 // NewEVMRegistryV2_0 is the constructor of evmRegistryv2_0
 func NewEVMRegistryV2_0(address common.Address, client types.EVMClient) (*evmRegistryv2_0, error) {
 	registry, err := keeper_registry_wrapper2_0.NewKeeperRegistryCaller(address, client)
@@ -51,51 +70,39 @@ func NewEVMRegistryV2_0(address common.Address, client types.EVMClient) (*evmReg
 		return nil, fmt.Errorf("%w: failed to create caller for address and backend", ErrInitializationFailure)
 	}
 
+	filterer, err := keeper_registry_wrapper2_0.NewKeeperRegistryFilterer(address, client)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create filterer for address and backend", ErrInitializationFailure)
+	}
+
 	return &evmRegistryv2_0{
-		address:  address,
-		registry: registry,
-		client:   client,
+		address:       address,
+		registry:      registry,
+		filterer:      filterer,
+		client:        client,
+		executeGas:    make(map[string]executeGasEntry),
+		activeUpkeeps: newActiveUpkeepSet(),
 	}, nil
 }
 
+// GetActiveUpkeepKeys returns keys at the provided block for all upkeeps that
+// are active and not paused. The active upkeeps are tracked from registry
+// events after an initial scan of the registry. Calls are made at the hash of
+// the block when the block is a head delivered by the client.
 func (r *evmRegistryv2_0) GetActiveUpkeepKeys(ctx context.Context, block types.BlockKey) ([]types.UpkeepKey, error) {
-	opts, err := r.buildCallOpts(ctx, block)
+	ref, err := r.blockAt(ctx, block)
 	if err != nil {
 		return nil, err
 	}
 
-	state, err := r.registry.GetState(opts)
+	ids, err := r.activeUpkeepIDs(ctx, ref)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get contract state at block number %d", opts.BlockNumber.Int64())
+		return nil, err
 	}
 
-	keys := make([]types.UpkeepKey, 0)
-	for int64(len(keys)) < state.State.NumUpkeeps.Int64() {
-		startIndex := int64(len(keys))
-		maxCount := state.State.NumUpkeeps.Int64() - int64(len(keys))
-
-		if maxCount > ActiveUpkeepIDBatchSize {
-			maxCount = ActiveUpkeepIDBatchSize
-		}
-
-		nextRawKeys, err := r.registry.GetActiveUpkeepIDs(opts, big.NewInt(startIndex), big.NewInt(maxCount))
-		if err != nil {
-			return nil, errors.Wrapf(err, "failed to get active upkeep IDs from index %d to %d (both inclusive)", startIndex, startIndex+maxCount-1)
-		}
-
-		nextKeys := make([]types.UpkeepKey, len(nextRawKeys))
-		for i, next := range nextRawKeys {
-			nextKeys[i] = BlockAndIdToKey(opts.BlockNumber, next)
-		}
-
-		if len(nextKeys) == 0 {
-			break
-		}
-
-		buffer := make([]types.UpkeepKey, len(keys), len(keys)+len(nextKeys))
-		copy(keys, buffer)
-
-		keys = append(buffer, nextKeys...)
+	keys := make([]types.UpkeepKey, len(ids))
+	for i, id := range ids {
+		keys[i] = BlockAndIdToKey(ref.number, id)
 	}
 
 	return keys, nil
@@ -113,7 +120,7 @@ func (r *evmRegistryv2_0) checkUpkeeps(ctx context.Context, keys []types.UpkeepK
 			return nil, err
 		}
 
-		opts, err := r.buildCallOpts(ctx, block)
+		ref, err := r.blockAt(ctx, block)
 		if err != nil {
 			return nil, err
 		}
@@ -131,7 +138,7 @@ func (r *evmRegistryv2_0) checkUpkeeps(ctx context.Context, keys []types.UpkeepK
 					"to":   r.address.Hex(),
 					"data": hexutil.Bytes(payload),
 				},
-				hexutil.EncodeBig(opts.BlockNumber),
+				ref.callArg(),
 			},
 			Result: &result,
 		}
@@ -185,7 +192,7 @@ func (r *evmRegistryv2_0) simulatePerformUpkeeps(ctx context.Context, checkResul
 			return nil, err
 		}
 
-		opts, err := r.buildCallOpts(ctx, block)
+		ref, err := r.blockAt(ctx, block)
 		if err != nil {
 			return nil, err
 		}
@@ -204,7 +211,7 @@ func (r *evmRegistryv2_0) simulatePerformUpkeeps(ctx context.Context, checkResul
 					"to":   r.address.Hex(),
 					"data": hexutil.Bytes(payload),
 				},
-				hexutil.EncodeBig(opts.BlockNumber),
+				ref.callArg(),
 			},
 			Result: &result,
 		})
@@ -245,6 +252,249 @@ func (r *evmRegistryv2_0) simulatePerformUpkeeps(ctx context.Context, checkResul
 	return checkResults, nil
 }
 
+// populateExecuteGas sets the execute gas of eligible results from the cache.
+// upkeeps missing from the cache are fetched with getUpkeep at the block the
+// cache is updated to.
+func (r *evmRegistryv2_0) populateExecuteGas(ctx context.Context, checkResults []types.UpkeepResult) ([]types.UpkeepResult, error) {
+	var latest *blockRef
+	for _, checkResult := range checkResults {
+		if checkResult.State == types.NotEligible {
+			continue
+		}
+
+		block, _, err := BlockAndIdFromKey(checkResult.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		ref, err := r.blockAt(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+
+		if latest == nil || ref.number.Cmp(latest.number) > 0 {
+			latest = &ref
+		}
+	}
+
+	// no eligible results
+	if latest == nil {
+		return checkResults, nil
+	}
+
+	if err := r.refreshExecuteGas(ctx, *latest); err != nil {
+		return nil, err
+	}
+
+	r.executeGasMu.Lock()
+	cachedAt := r.executeGasBlock
+	block := new(big.Int).SetUint64(cachedAt)
+	r.executeGasMu.Unlock()
+
+	ref, err := r.blockAt(ctx, types.BlockKey(block.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		gasReqs    = make([]rpc.BatchElem, 0)
+		gasResults = make([]*string, 0)
+		gasIds     = make([]*big.Int, 0)
+		requested  = make(map[string]struct{})
+	)
+
+	r.executeGasMu.Lock()
+	for _, checkResult := range checkResults {
+		if checkResult.State == types.NotEligible {
+			continue
+		}
+
+		_, upkeepId, err := BlockAndIdFromKey(checkResult.Key)
+		if err != nil {
+			r.executeGasMu.Unlock()
+			return nil, err
+		}
+
+		if _, ok := r.executeGas[upkeepId.String()]; ok {
+			continue
+		}
+
+		if _, ok := requested[upkeepId.String()]; ok {
+			continue
+		}
+
+		payload, err := keeperRegistryABI.Pack("getUpkeep", upkeepId)
+		if err != nil {
+			r.executeGasMu.Unlock()
+			return nil, err
+		}
+
+		var result string
+		gasReqs = append(gasReqs, rpc.BatchElem{
+			Method: "eth_call",
+			Args: []interface{}{
+				map[string]interface{}{
+					"to":   r.address.Hex(),
+					"data": hexutil.Bytes(payload),
+				},
+				ref.callArg(),
+			},
+			Result: &result,
+		})
+
+		gasResults = append(gasResults, &result)
+		gasIds = append(gasIds, upkeepId)
+		requested[upkeepId.String()] = struct{}{}
+	}
+	r.executeGasMu.Unlock()
+
+	if len(gasReqs) > 0 {
+		if err := r.client.BatchCallContext(ctx, gasReqs); err != nil {
+			return nil, err
+		}
+	}
+
+	fetched := make(map[string]uint32, len(gasReqs))
+
+	for i, req := range gasReqs {
+		if req.Error != nil {
+			if strings.Contains(req.Error.Error(), "reverted") {
+				// upkeep does not exist at the block; execute gas is left at 0
+				continue
+			}
+			// some other error
+			multierr.AppendInto(&err, req.Error)
+			continue
+		}
+
+		info, uErr := unmarshalGetUpkeepResult(*gasResults[i])
+		if uErr != nil {
+			return nil, uErr
+		}
+
+		fetched[gasIds[i].String()] = info.ExecuteGas
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.executeGasMu.Lock()
+	defer r.executeGasMu.Unlock()
+
+	// values fetched at a block that was reorged out while fetching are
+	// not cached
+	if r.executeGasBlock == cachedAt {
+		for id, gas := range fetched {
+			// a value set from an event while fetching is newer
+			if _, ok := r.executeGas[id]; !ok {
+				r.executeGas[id] = executeGasEntry{gas: gas, block: cachedAt}
+			}
+		}
+	}
+
+	for i, checkResult := range checkResults {
+		if checkResult.State == types.NotEligible {
+			continue
+		}
+
+		_, upkeepId, err := BlockAndIdFromKey(checkResult.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, ok := r.executeGas[upkeepId.String()]
+		if !ok {
+			checkResults[i].ExecuteGas = fetched[upkeepId.String()]
+			continue
+		}
+
+		checkResults[i].ExecuteGas = entry.gas
+
+		// used entries are retained
+		if entry.block < r.executeGasBlock {
+			entry.block = r.executeGasBlock
+			r.executeGas[upkeepId.String()] = entry
+		}
+	}
+
+	return checkResults, nil
+}
+
+// refreshExecuteGas updates cached execute gas values from UpkeepGasLimitSet
+// events between the last refreshed block and the provided block. the first
+// refresh only sets the starting block since the cache is empty. the cache is
+// cleared when the last refreshed block was reorged out since events applied
+// to the cache may be from reorged out blocks. entries not used or updated
+// within ExecuteGasCacheBlocks are evicted.
+func (r *evmRegistryv2_0) refreshExecuteGas(ctx context.Context, ref blockRef) error {
+	r.executeGasMu.Lock()
+	defer r.executeGasMu.Unlock()
+
+	if r.executeGasBlock != 0 {
+		reorged, err := r.blockReorged(ctx, r.executeGasBlock, r.executeGasHash)
+		if err != nil {
+			return err
+		}
+
+		if reorged {
+			r.executeGas = make(map[string]executeGasEntry)
+			r.executeGasBlock = 0
+		}
+	}
+
+	end := ref.number.Uint64()
+	if r.executeGasBlock == 0 {
+		r.executeGasBlock = end
+		r.executeGasHash = ref.hash
+		return nil
+	}
+
+	if end <= r.executeGasBlock {
+		return nil
+	}
+
+	iter, err := r.filterer.FilterUpkeepGasLimitSet(&bind.FilterOpts{
+		Start:   r.executeGasBlock + 1,
+		End:     &end,
+		Context: ctx,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %s: failed to filter UpkeepGasLimitSet events", err, ErrRegistryCallFailure)
+	}
+
+	defer iter.Close()
+
+	for iter.Next() {
+		r.executeGas[iter.Event.Id.String()] = executeGasEntry{
+			gas:   uint32(iter.Event.GasLimit.Uint64()),
+			block: iter.Event.Raw.BlockNumber,
+		}
+	}
+
+	if err := iter.Error(); err != nil {
+		return fmt.Errorf("%w: %s: failed to read UpkeepGasLimitSet events", err, ErrRegistryCallFailure)
+	}
+
+	r.executeGasBlock = end
+	r.executeGasHash = ref.hash
+
+	for id, entry := range r.executeGas {
+		if entry.block+ExecuteGasCacheBlocks < end {
+			delete(r.executeGas, id)
+		}
+	}
+
+	return nil
+}
+
+// executeGasEntry is a cached execute gas value and the last block the value
+// was used or updated at
+type executeGasEntry struct {
+	gas   uint32
+	block uint64
+}
+
 func (r *evmRegistryv2_0) check(ctx context.Context, keys []types.UpkeepKey, ch chan outStruct) {
 	upkeepResults, err := r.checkUpkeeps(ctx, keys)
 	if err != nil {
@@ -262,6 +512,14 @@ func (r *evmRegistryv2_0) check(ctx context.Context, keys []types.UpkeepKey, ch
 		return
 	}
 
+	upkeepResults, err = r.populateExecuteGas(ctx, upkeepResults)
+	if err != nil {
+		ch <- outStruct{
+			err: err,
+		}
+		return
+	}
+
 	ch <- outStruct{
 		ur: upkeepResults,
 	}
@@ -269,7 +527,19 @@ func (r *evmRegistryv2_0) check(ctx context.Context, keys []types.UpkeepKey, ch
 
 func (r *evmRegistryv2_0) CheckUpkeep(ctx context.Context, keys ...types.UpkeepKey) (types.UpkeepResults, error) {
 	chResult := make(chan outStruct, 1)
-	go r.check(ctx, keys, chResult)
+	go func() {
+		// a panic decoding a bad RPC response fails the check instead of
+		// the node process
+		var err error
+		defer func() {
+			if err != nil {
+				chResult <- outStruct{err: fmt.Errorf("%w: %s: failed to check upkeeps", err, ErrRegistryCallFailure)}
+			}
+		}()
+		defer util.RecoverPanic(&err)
+
+		r.check(ctx, keys, chResult)
+	}()
 
 	select {
 	case rs := <-chResult:
@@ -293,28 +563,94 @@ func (r *evmRegistryv2_0) IdentifierFromKey(key types.UpkeepKey) (types.UpkeepId
 	return id.Bytes(), nil
 }
 
-func (r *evmRegistryv2_0) buildCallOpts(ctx context.Context, block types.BlockKey) (*bind.CallOpts, error) {
-	b := new(big.Int)
-	_, ok := b.SetString(string(block), 10)
+// ParseIdentifier parses a decimal upkeep id into the identifier returned by
+// IdentifierFromKey
+func (r *evmRegistryv2_0) ParseIdentifier(id string) (types.UpkeepIdentifier, error) {
+	value, ok := new(big.Int).SetString(id, 10)
+	if !ok || value.Sign() < 0 {
+		return nil, fmt.Errorf("%w: must be a non-negative big int: '%s'", ErrUpkeepKeyNotParsable, id)
+	}
+
+	return value.Bytes(), nil
+}
+
+func (r *evmRegistryv2_0) BlockFromKey(key types.UpkeepKey) (types.BlockKey, error) {
+	block, _, err := BlockAndIdFromKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return block, nil
+}
 
+// MakeKey builds a key from a block number and an identifier returned by
+// IdentifierFromKey
+func (r *evmRegistryv2_0) MakeKey(block types.BlockKey, id types.UpkeepIdentifier) types.UpkeepKey {
+	return types.UpkeepKey(fmt.Sprintf("%s%s%s", block, separator, new(big.Int).SetBytes(id)))
+}
+
+// blockAt resolves a block key to a block reference. Block 0 resolves to the
+// latest block by fetching its header. Other blocks carry the hash of the
+// head delivered by the client at the block number when one exists and are
+// otherwise called by number without fetching the block header.
+func (r *evmRegistryv2_0) blockAt(ctx context.Context, block types.BlockKey) (blockRef, error) {
+	b, ok := new(big.Int).SetString(string(block), 10)
 	if !ok {
-		return nil, fmt.Errorf("%w: requires big int", ErrBlockKeyNotParsable)
+		return blockRef{}, fmt.Errorf("%w: requires big int", ErrBlockKeyNotParsable)
 	}
 
-	if b == nil || b.Int64() == 0 {
-		// fetch the current block number so batched GetActiveUpkeepKeys calls can be performed on the same block
+	if b.Sign() == 0 {
+		// fetch the current block so batched GetActiveUpkeepKeys calls can be performed on the same block
 		header, err := r.client.HeaderByNumber(ctx, nil)
 		if err != nil {
-			return nil, fmt.Errorf("%w: %s: EVM failed to fetch block header", err, ErrRegistryCallFailure)
+			return blockRef{}, fmt.Errorf("%w: %s: EVM failed to fetch block header", err, ErrRegistryCallFailure)
 		}
 
-		b = header.Number
+		return blockRef{number: header.Number, hash: header.Hash()}, nil
 	}
 
-	return &bind.CallOpts{
-		Context:     ctx,
-		BlockNumber: b,
-	}, nil
+	ref := blockRef{number: b}
+	if hasher, ok := r.client.(headHasher); ok {
+		if hash, ok := hasher.headHash(b.Uint64()); ok {
+			ref.hash = hash
+		}
+	}
+
+	return ref, nil
+}
+
+// callerAt returns a registry caller that makes calls at the block by hash
+// when the hash is known and by the block number of the call otherwise
+func (r *evmRegistryv2_0) callerAt(block blockRef) (*keeper_registry_wrapper2_0.KeeperRegistryCaller, error) {
+	if block.hash == (common.Hash{}) {
+		return r.registry, nil
+	}
+
+	caller, err := keeper_registry_wrapper2_0.NewKeeperRegistryCaller(r.address, &blockHashCaller{client: r.client, block: block})
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create caller for address and backend", ErrInitializationFailure)
+	}
+
+	return caller, nil
+}
+
+func (r *evmRegistryv2_0) CompareBlocks(a, b types.BlockKey) (int, error) {
+	return CompareBlockKeys(a, b)
+}
+
+// CompareBlockKeys orders block keys by block number
+func CompareBlockKeys(a, b types.BlockKey) (int, error) {
+	aNum, ok := new(big.Int).SetString(string(a), 10)
+	if !ok {
+		return 0, fmt.Errorf("%w: requires big int: '%s'", ErrBlockKeyNotParsable, a)
+	}
+
+	bNum, ok := new(big.Int).SetString(string(b), 10)
+	if !ok {
+		return 0, fmt.Errorf("%w: requires big int: '%s'", ErrBlockKeyNotParsable, b)
+	}
+
+	return aNum.Cmp(bNum), nil
 }
 
 func BlockAndIdFromKey(key types.UpkeepKey) (types.BlockKey, *big.Int, error) {
@@ -2,10 +2,12 @@ package chain
 
 import (
 	"context"
+	"fmt"
 	"math/big"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	ethtypes "github.com/ethereum/go-ethereum/core/types"
@@ -24,9 +26,6 @@ func TestGetActiveUpkeepKeys(t *testing.T) {
 	kabi, _ := keeper_registry_wrapper2_0.KeeperRegistryMetaData.GetAbi()
 	rec := NewContractMockReceiver(t, mockClient, *kabi)
 
-	block := big.NewInt(4)
-	mockClient.On("HeaderByNumber", ctx, mock.Anything).Return(&ethtypes.Header{Number: block}, nil).Once()
-
 	state := MockGetState
 	state.State.NumUpkeeps = big.NewInt(4)
 	ids := []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3), big.NewInt(4)}
@@ -34,19 +33,283 @@ func TestGetActiveUpkeepKeys(t *testing.T) {
 	rec.MockResponse("getState", state)
 	rec.MockResponse("getActiveUpkeepIDs", ids)
 
+	// upkeep 3 is paused
+	mockClient.On("BatchCallContext", ctx, mock.Anything).
+		Run(func(args mock.Arguments) {
+			batchElems := args.Get(1).([]rpc.BatchElem)
+			assert.Len(t, batchElems, 4)
+			for i, batchElem := range batchElems {
+				*batchElem.Result.(*string) = mustEncodeUpkeepPaused(t, i == 2)
+			}
+		}).Return(nil)
+
 	reg, err := NewEVMRegistryV2_0(common.Address{}, mockClient)
 	if err != nil {
 		t.FailNow()
 	}
 
-	keys, err := reg.GetActiveUpkeepKeys(ctx, types.BlockKey("0"))
+	keys, err := reg.GetActiveUpkeepKeys(ctx, types.BlockKey("4"))
 	if err != nil {
 		t.Logf("error: %s", err)
 		t.FailNow()
 	}
 
-	assert.Len(t, keys, 4)
+	assert.Equal(t, []types.UpkeepKey{types.UpkeepKey("4|1"), types.UpkeepKey("4|2"), types.UpkeepKey("4|4")}, keys)
+	mockClient.Mock.AssertNumberOfCalls(t, "CallContract", 2)
+
+	// later blocks apply registry events to the scanned upkeeps
+	mockClient.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return q.FromBlock.Int64() == 5 && q.ToBlock.Int64() == 6 && len(q.Topics) == 1 && len(q.Topics[0]) == len(activeUpkeepTopics)
+	})).Return([]ethtypes.Log{
+		mustEncodeRegistryLog(t, "UpkeepRegistered", []common.Hash{common.BigToHash(big.NewInt(5))}, uint32(100_000), common.Address{}),
+		mustEncodeRegistryLog(t, "UpkeepPaused", []common.Hash{common.BigToHash(big.NewInt(1))}),
+		mustEncodeRegistryLog(t, "UpkeepUnpaused", []common.Hash{common.BigToHash(big.NewInt(3))}),
+		mustEncodeRegistryLog(t, "UpkeepCanceled", []common.Hash{common.BigToHash(big.NewInt(2)), common.BigToHash(big.NewInt(5))}),
+		mustEncodeRegistryLog(t, "UpkeepMigrated", []common.Hash{common.BigToHash(big.NewInt(4))}, big.NewInt(0), common.Address{}),
+	}, nil).Once()
+
+	keys, err = reg.GetActiveUpkeepKeys(ctx, types.BlockKey("6"))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.UpkeepKey{types.UpkeepKey("6|3"), types.UpkeepKey("6|5")}, keys)
+	mockClient.Mock.AssertNumberOfCalls(t, "CallContract", 2)
+
+	// the same block does not fetch events again
+	keys, err = reg.GetActiveUpkeepKeys(ctx, types.BlockKey("6"))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.UpkeepKey{types.UpkeepKey("6|3"), types.UpkeepKey("6|5")}, keys)
+
+	// an earlier block is scanned without changing the tracked upkeeps
+	keys, err = reg.GetActiveUpkeepKeys(ctx, types.BlockKey("5"))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.UpkeepKey{types.UpkeepKey("5|1"), types.UpkeepKey("5|2"), types.UpkeepKey("5|4")}, keys)
+	assert.Equal(t, uint64(6), reg.activeUpkeeps.block)
+	assert.Len(t, reg.activeUpkeeps.active, 2)
+
+	// the tracked upkeeps are replaced by a full scan after the reconcile
+	// interval
+	reconcile := 4 + ActiveUpkeepReconcileBlocks
+	keys, err = reg.GetActiveUpkeepKeys(ctx, types.BlockKey(fmt.Sprint(reconcile)))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.UpkeepKey{
+		BlockAndIdToKey(new(big.Int).SetUint64(reconcile), big.NewInt(1)),
+		BlockAndIdToKey(new(big.Int).SetUint64(reconcile), big.NewInt(2)),
+		BlockAndIdToKey(new(big.Int).SetUint64(reconcile), big.NewInt(4)),
+	}, keys)
+	assert.Equal(t, reconcile, reg.activeUpkeeps.scanned)
+
 	mockClient.Mock.AssertExpectations(t)
+
+	t.Run("Failed Event Poll", func(t *testing.T) {
+		mockClient.On("FilterLogs", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("rpc error")).Once()
+
+		_, err := reg.GetActiveUpkeepKeys(ctx, types.BlockKey(fmt.Sprint(reconcile+1)))
+		assert.ErrorContains(t, err, "failed to filter active upkeep events")
+
+		// the failed blocks are fetched again
+		mockClient.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+			return q.FromBlock.Uint64() == reconcile+1 && q.ToBlock.Uint64() == reconcile+2
+		})).Return([]ethtypes.Log{}, nil).Once()
+
+		keys, err := reg.GetActiveUpkeepKeys(ctx, types.BlockKey(fmt.Sprint(reconcile+2)))
+		assert.NoError(t, err)
+		assert.Len(t, keys, 3)
+	})
+}
+
+func TestGetActiveUpkeepKeys_Reorg(t *testing.T) {
+	ctx := context.Background()
+	mockClient := &headHashClient{
+		MockEVMClient: types.NewMockEVMClient(t),
+		hashes:        map[uint64]common.Hash{4: common.HexToHash("0x4a")},
+	}
+
+	kabi, _ := keeper_registry_wrapper2_0.KeeperRegistryMetaData.GetAbi()
+	rec := NewContractMockReceiver(t, mockClient.MockEVMClient, *kabi)
+
+	state := MockGetState
+	state.State.NumUpkeeps = big.NewInt(2)
+
+	// calls at heads are made by hash in batch calls
+	responses := map[string]string{
+		hexutil.Encode(kabi.Methods["getState"].ID):           hexutil.Encode(rec.mustEncodeResponse("getState", state)),
+		hexutil.Encode(kabi.Methods["getActiveUpkeepIDs"].ID): hexutil.Encode(rec.mustEncodeResponse("getActiveUpkeepIDs", []*big.Int{big.NewInt(1), big.NewInt(2)})),
+		hexutil.Encode(kabi.Methods["getUpkeep"].ID):          mustEncodeUpkeepPaused(t, false),
+	}
+
+	mockClient.On("BatchCallContext", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			for _, batchElem := range args.Get(1).([]rpc.BatchElem) {
+				data := batchElem.Args[0].(map[string]interface{})["data"].(hexutil.Bytes)
+				*batchElem.Result.(*string) = responses[hexutil.Encode(data[:4])]
+			}
+		}).Return(nil)
+
+	reg, err := NewEVMRegistryV2_0(common.Address{}, mockClient)
+	require.NoError(t, err)
+
+	keys, err := reg.GetActiveUpkeepKeys(ctx, types.BlockKey("4"))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.UpkeepKey{types.UpkeepKey("4|1"), types.UpkeepKey("4|2")}, keys)
+	assert.Equal(t, common.HexToHash("0x4a"), reg.activeUpkeeps.hash)
+
+	// events are applied on the next head
+	mockClient.hashes[5] = common.HexToHash("0x5a")
+	mockClient.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return q.FromBlock.Int64() == 5 && q.ToBlock.Int64() == 5
+	})).Return([]ethtypes.Log{
+		mustEncodeRegistryLog(t, "UpkeepCanceled", []common.Hash{common.BigToHash(big.NewInt(2)), common.BigToHash(big.NewInt(5))}),
+	}, nil).Once()
+
+	keys, err = reg.GetActiveUpkeepKeys(ctx, types.BlockKey("5"))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.UpkeepKey{types.UpkeepKey("5|1")}, keys)
+
+	// block 5 is replaced by a reorg such that the cancel is reorged out
+	// and the set is scanned again
+	mockClient.hashes[5] = common.HexToHash("0x5b")
+	mockClient.hashes[6] = common.HexToHash("0x6b")
+
+	keys, err = reg.GetActiveUpkeepKeys(ctx, types.BlockKey("6"))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.UpkeepKey{types.UpkeepKey("6|1"), types.UpkeepKey("6|2")}, keys)
+	assert.Equal(t, uint64(6), reg.activeUpkeeps.scanned)
+
+	// a removed log cannot be rolled back and the set is scanned again
+	mockClient.hashes[7] = common.HexToHash("0x7b")
+	removed := mustEncodeRegistryLog(t, "UpkeepPaused", []common.Hash{common.BigToHash(big.NewInt(1))})
+	removed.Removed = true
+
+	mockClient.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return q.FromBlock.Int64() == 7 && q.ToBlock.Int64() == 7
+	})).Return([]ethtypes.Log{removed}, nil).Once()
+
+	keys, err = reg.GetActiveUpkeepKeys(ctx, types.BlockKey("7"))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.UpkeepKey{types.UpkeepKey("7|1"), types.UpkeepKey("7|2")}, keys)
+	assert.Equal(t, uint64(7), reg.activeUpkeeps.scanned)
+}
+
+func TestPausedUpkeeps_Batches(t *testing.T) {
+	mockClient := types.NewMockEVMClient(t)
+	ctx := context.Background()
+
+	reg, err := NewEVMRegistryV2_0(common.Address{}, mockClient)
+	require.NoError(t, err)
+
+	ids := make([]*big.Int, UpkeepInfoBatchSize+1)
+	for i := range ids {
+		ids[i] = big.NewInt(int64(i))
+	}
+
+	mockClient.On("BatchCallContext", ctx, mock.Anything).
+		Run(func(args mock.Arguments) {
+			batchElems := args.Get(1).([]rpc.BatchElem)
+			assert.LessOrEqual(t, len(batchElems), UpkeepInfoBatchSize)
+			for _, batchElem := range batchElems {
+				*batchElem.Result.(*string) = mustEncodeUpkeepPaused(t, true)
+			}
+		}).Return(nil).Twice()
+
+	paused, err := reg.pausedUpkeeps(ctx, blockRef{number: big.NewInt(1)}, ids)
+	assert.NoError(t, err)
+	assert.Len(t, paused, len(ids))
+}
+
+// headHashClient is a client that delivered heads with the provided hashes
+type headHashClient struct {
+	*types.MockEVMClient
+	hashes map[uint64]common.Hash
+}
+
+func (c *headHashClient) headHash(number uint64) (common.Hash, bool) {
+	hash, ok := c.hashes[number]
+	return hash, ok
+}
+
+func TestBlockAt(t *testing.T) {
+	ctx := context.Background()
+	headHash := common.HexToHash("0x05")
+	mockClient := &headHashClient{
+		MockEVMClient: types.NewMockEVMClient(t),
+		hashes:        map[uint64]common.Hash{5: headHash},
+	}
+
+	reg, err := NewEVMRegistryV2_0(common.Address{}, mockClient)
+	require.NoError(t, err)
+
+	t.Run("latest block", func(t *testing.T) {
+		header := &ethtypes.Header{Number: big.NewInt(4)}
+		mockClient.On("HeaderByNumber", ctx, (*big.Int)(nil)).Return(header, nil).Once()
+
+		ref, err := reg.blockAt(ctx, types.BlockKey("0"))
+		assert.NoError(t, err)
+		assert.Equal(t, big.NewInt(4), ref.number)
+		assert.Equal(t, header.Hash(), ref.hash)
+	})
+
+	t.Run("latest block header fails", func(t *testing.T) {
+		mockClient.On("HeaderByNumber", ctx, (*big.Int)(nil)).Return(nil, fmt.Errorf("rpc error")).Once()
+
+		_, err := reg.blockAt(ctx, types.BlockKey("0"))
+		assert.ErrorContains(t, err, "failed to fetch block header")
+	})
+
+	t.Run("delivered head", func(t *testing.T) {
+		ref, err := reg.blockAt(ctx, types.BlockKey("5"))
+		assert.NoError(t, err)
+		assert.Equal(t, big.NewInt(5), ref.number)
+		assert.Equal(t, headHash, ref.hash)
+	})
+
+	t.Run("block without a head is called by number", func(t *testing.T) {
+		ref, err := reg.blockAt(ctx, types.BlockKey("6"))
+		assert.NoError(t, err)
+		assert.Equal(t, big.NewInt(6), ref.number)
+		assert.Equal(t, common.Hash{}, ref.hash)
+	})
+
+	t.Run("invalid block", func(t *testing.T) {
+		_, err := reg.blockAt(ctx, types.BlockKey("0x05"))
+		assert.ErrorIs(t, err, ErrBlockKeyNotParsable)
+	})
+
+	t.Run("checks at a delivered head are called by hash", func(t *testing.T) {
+		mockClient.On("BatchCallContext", ctx, mock.Anything).
+			Once().
+			Run(func(args mock.Arguments) {
+				batchElems := args.Get(1).([]rpc.BatchElem)
+				assert.Len(t, batchElems, 2)
+				assert.Equal(t, rpc.BlockNumberOrHashWithHash(headHash, true), batchElems[0].Args[1])
+				assert.Equal(t, hexutil.EncodeBig(big.NewInt(6)), batchElems[1].Args[1])
+
+				out, err := keeperRegistryABI.Methods["checkUpkeep"].
+					Outputs.PackValues([]interface{}{false, []byte{}, uint8(4), big.NewInt(0), big.NewInt(0), big.NewInt(0)})
+				assert.NoError(t, err)
+
+				for _, batchElem := range batchElems {
+					*batchElem.Result.(*string) = hexutil.Encode(out)
+				}
+			}).Return(nil)
+
+		_, err := reg.checkUpkeeps(ctx, []types.UpkeepKey{types.UpkeepKey("5|1"), types.UpkeepKey("6|1")})
+		assert.NoError(t, err)
+	})
+}
+
+func TestCheckUpkeep_RecoversPanic(t *testing.T) {
+	mockClient := types.NewMockEVMClient(t)
+	ctx := context.Background()
+
+	reg, err := NewEVMRegistryV2_0(common.Address{}, mockClient)
+	require.NoError(t, err)
+
+	mockClient.On("BatchCallContext", ctx, mock.Anything).
+		Run(func(args mock.Arguments) {
+			panic("bad response")
+		}).Return(nil).Once()
+
+	_, err = reg.CheckUpkeep(ctx, types.UpkeepKey("1|1234"))
+	assert.ErrorContains(t, err, "recovered panic: bad response")
 }
 
 func TestCheckUpkeep(t *testing.T) {
@@ -66,6 +329,9 @@ func TestCheckUpkeep(t *testing.T) {
 	performPayload, err := keeperRegistryABI.Pack("simulatePerformUpkeep", expectedUpkeep, ret0.Result.PerformData)
 	require.NoError(t, err)
 
+	getUpkeepPayload, err := keeperRegistryABI.Pack("getUpkeep", expectedUpkeep)
+	require.NoError(t, err)
+
 	t.Run("Perform", func(t *testing.T) {
 		mockClient := types.NewMockEVMClient(t)
 		ctx := context.Background()
@@ -132,10 +398,26 @@ func TestCheckUpkeep(t *testing.T) {
 				}
 			}).Return(nil)
 
+		// getUpkeep returns the upkeep info with execute gas
+		mockClient.On("BatchCallContext", ctx, mock.Anything).
+			Once().
+			Run(func(args mock.Arguments) {
+				batchElems, ok := args.Get(1).([]rpc.BatchElem)
+				assert.True(t, ok)
+				assert.Len(t, batchElems, 1)
+				for _, batchElem := range batchElems {
+					assert.Equal(t, hexutil.Bytes(getUpkeepPayload), batchElem.Args[0].(map[string]interface{})["data"])
+					assert.Equal(t, hexutil.EncodeBig(big.NewInt(1)), batchElem.Args[1])
+
+					*batchElem.Result.(*string) = mustEncodeUpkeepInfo(t, 500_000)
+				}
+			}).Return(nil)
+
 		upkeep, err := reg.CheckUpkeep(ctx, upkeepKey)
 		assert.NoError(t, err)
 		assert.Len(t, upkeep, 1)
 		assert.Equal(t, types.Eligible, upkeep[0].State)
+		assert.Equal(t, uint32(500_000), upkeep[0].ExecuteGas)
 	})
 
 	t.Run("UPKEEP_NOT_NEEDED", func(t *testing.T) {
@@ -281,6 +563,156 @@ func TestCheckUpkeep(t *testing.T) {
 	})
 }
 
+func TestPopulateExecuteGas(t *testing.T) {
+	mockClient := types.NewMockEVMClient(t)
+	ctx := context.Background()
+
+	reg, err := NewEVMRegistryV2_0(common.Address{}, mockClient)
+	require.NoError(t, err)
+
+	results := func(block int64) []types.UpkeepResult {
+		return []types.UpkeepResult{
+			{Key: BlockAndIdToKey(big.NewInt(block), big.NewInt(1)), State: types.Eligible},
+			{Key: BlockAndIdToKey(big.NewInt(block), big.NewInt(2)), State: types.Eligible},
+			{Key: BlockAndIdToKey(big.NewInt(block), big.NewInt(3)), State: types.NotEligible},
+		}
+	}
+
+	// the first call fetches all eligible upkeeps at the check block
+	mockClient.On("BatchCallContext", ctx, mock.Anything).
+		Once().
+		Run(func(args mock.Arguments) {
+			batchElems := args.Get(1).([]rpc.BatchElem)
+			assert.Len(t, batchElems, 2)
+			for i, batchElem := range batchElems {
+				assert.Equal(t, hexutil.EncodeBig(big.NewInt(10)), batchElem.Args[1])
+				*batchElem.Result.(*string) = mustEncodeUpkeepInfo(t, uint32(100_000*(i+1)))
+			}
+		}).Return(nil)
+
+	populated, err := reg.populateExecuteGas(ctx, results(10))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(100_000), populated[0].ExecuteGas)
+	assert.Equal(t, uint32(200_000), populated[1].ExecuteGas)
+	assert.Equal(t, uint32(0), populated[2].ExecuteGas)
+
+	// later calls use the cache refreshed by UpkeepGasLimitSet events
+	event := keeperRegistryABI.Events["UpkeepGasLimitSet"]
+	data, err := event.Inputs.NonIndexed().Pack(big.NewInt(300_000))
+	require.NoError(t, err)
+
+	mockClient.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return q.FromBlock.Int64() == 11 && q.ToBlock.Int64() == 12
+	})).Return([]ethtypes.Log{
+		{
+			Topics:      []common.Hash{event.ID, common.BigToHash(big.NewInt(2))},
+			Data:        data,
+			BlockNumber: 11,
+		},
+	}, nil).Once()
+
+	populated, err = reg.populateExecuteGas(ctx, results(12))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(100_000), populated[0].ExecuteGas)
+	assert.Equal(t, uint32(300_000), populated[1].ExecuteGas)
+}
+
+func TestPopulateExecuteGas_Reorg(t *testing.T) {
+	ctx := context.Background()
+	mockClient := &headHashClient{
+		MockEVMClient: types.NewMockEVMClient(t),
+		hashes:        map[uint64]common.Hash{10: common.HexToHash("0x0a")},
+	}
+
+	reg, err := NewEVMRegistryV2_0(common.Address{}, mockClient)
+	require.NoError(t, err)
+
+	results := func(block uint64) []types.UpkeepResult {
+		return []types.UpkeepResult{
+			{Key: BlockAndIdToKey(new(big.Int).SetUint64(block), big.NewInt(1)), State: types.Eligible},
+		}
+	}
+
+	expectFetch := func(blockArg interface{}, executeGas uint32) {
+		mockClient.On("BatchCallContext", ctx, mock.Anything).
+			Once().
+			Run(func(args mock.Arguments) {
+				batchElems := args.Get(1).([]rpc.BatchElem)
+				assert.Len(t, batchElems, 1)
+				assert.Equal(t, blockArg, batchElems[0].Args[1])
+				*batchElems[0].Result.(*string) = mustEncodeUpkeepInfo(t, executeGas)
+			}).Return(nil)
+	}
+
+	expectFetch(rpc.BlockNumberOrHashWithHash(common.HexToHash("0x0a"), true), 100_000)
+
+	populated, err := reg.populateExecuteGas(ctx, results(10))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(100_000), populated[0].ExecuteGas)
+
+	// the cached block is reorged out and the cache is fetched again at the
+	// new block instead of applying events to values from the old chain
+	mockClient.hashes = map[uint64]common.Hash{
+		10: common.HexToHash("0x0b"),
+		12: common.HexToHash("0x0c"),
+	}
+
+	expectFetch(rpc.BlockNumberOrHashWithHash(common.HexToHash("0x0c"), true), 200_000)
+
+	populated, err = reg.populateExecuteGas(ctx, results(12))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(200_000), populated[0].ExecuteGas)
+
+	// entries not used within the cache window are evicted and fetched again
+	end := 13 + ExecuteGasCacheBlocks
+	mockClient.On("FilterLogs", mock.Anything, mock.Anything).Return([]ethtypes.Log{}, nil).Once()
+	expectFetch(hexutil.EncodeBig(new(big.Int).SetUint64(end)), 300_000)
+
+	populated, err = reg.populateExecuteGas(ctx, results(end))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(300_000), populated[0].ExecuteGas)
+}
+
+func mustEncodeUpkeepInfo(t *testing.T, executeGas uint32) string {
+	out, err := keeperRegistryABI.Methods["getUpkeep"].Outputs.Pack(keeper_registry_wrapper2_0.UpkeepInfo{
+		ExecuteGas:     executeGas,
+		CheckData:      []byte{},
+		Balance:        big.NewInt(0),
+		AmountSpent:    big.NewInt(0),
+		OffchainConfig: []byte{},
+	})
+	require.NoError(t, err)
+
+	return hexutil.Encode(out)
+}
+
+func mustEncodeUpkeepPaused(t *testing.T, paused bool) string {
+	out, err := keeperRegistryABI.Methods["getUpkeep"].Outputs.Pack(keeper_registry_wrapper2_0.UpkeepInfo{
+		CheckData:      []byte{},
+		Balance:        big.NewInt(0),
+		AmountSpent:    big.NewInt(0),
+		Paused:         paused,
+		OffchainConfig: []byte{},
+	})
+	require.NoError(t, err)
+
+	return hexutil.Encode(out)
+}
+
+// mustEncodeRegistryLog encodes a registry event with the provided indexed
+// topics and non-indexed values
+func mustEncodeRegistryLog(t *testing.T, name string, topics []common.Hash, values ...interface{}) ethtypes.Log {
+	event := keeperRegistryABI.Events[name]
+
+	data, err := event.Inputs.NonIndexed().Pack(values...)
+	require.NoError(t, err)
+
+	return ethtypes.Log{
+		Topics: append([]common.Hash{event.ID}, topics...),
+		Data:   data,
+	}
+}
+
 var MockRegistryState = keeper_registry_wrapper2_0.State{
 	Nonce:                   uint32(0),
 	OwnerLinkBalance:        big.NewInt(1000000000000000000),
@@ -317,3 +749,48 @@ var MockGetState = keeper_registry_wrapper2_0.GetState{
 	Transmitters: []common.Address{},
 	F:            uint8(4),
 }
+
+func TestKeyCodec(t *testing.T) {
+	r := &evmRegistryv2_0{}
+
+	key := types.UpkeepKey("42|1234")
+
+	block, err := r.BlockFromKey(key)
+	assert.NoError(t, err)
+	assert.Equal(t, types.BlockKey("42"), block)
+
+	id, err := r.IdentifierFromKey(key)
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(1234).Bytes(), []byte(id))
+
+	assert.Equal(t, key, r.MakeKey(block, id))
+
+	_, err = r.BlockFromKey(types.UpkeepKey("42"))
+	assert.ErrorIs(t, err, ErrUpkeepKeyNotParsable)
+
+	parsed, err := r.ParseIdentifier("1234")
+	assert.NoError(t, err)
+	assert.Equal(t, id, parsed, "parsed ids match ids from keys")
+
+	_, err = r.ParseIdentifier("-1")
+	assert.ErrorIs(t, err, ErrUpkeepKeyNotParsable)
+}
+
+func TestCompareBlocks(t *testing.T) {
+	r := &evmRegistryv2_0{}
+
+	cmp, err := r.CompareBlocks(types.BlockKey("1000"), types.BlockKey("999"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cmp, "blocks are ordered by number and not as strings")
+
+	cmp, err = r.CompareBlocks(types.BlockKey("999"), types.BlockKey("1000"))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, cmp)
+
+	cmp, err = r.CompareBlocks(types.BlockKey("42"), types.BlockKey("42"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cmp)
+
+	_, err = r.CompareBlocks(types.BlockKey("0x2a"), types.BlockKey("42"))
+	assert.ErrorIs(t, err, ErrBlockKeyNotParsable)
+}
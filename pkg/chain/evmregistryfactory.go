@@ -0,0 +1,337 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+// detectVersionTimeout is the time allowed to detect the registry version
+// when constructing a registry
+const detectVersionTimeout = 10 * time.Second
+
+var (
+	ErrUnsupportedRegistryVersion = fmt.Errorf("unsupported registry version")
+
+	registryVersionsMu sync.RWMutex
+	registryVersions   = make(map[string]RegistryConstructor)
+
+	// registryChangeTopics are the events after which the registry version is
+	// detected again. event signatures are shared across registry versions.
+	registryChangeTopics = []common.Hash{
+		keeperRegistryABI.Events["ConfigSet"].ID,
+		keeperRegistryABI.Events["UpkeepMigrated"].ID,
+	}
+)
+
+func init() {
+	RegisterRegistryVersion("KeeperRegistry 2.0", func(address common.Address, client types.EVMClient, logger *log.Logger) (types.Registry, types.ReportEncoder, error) {
+		registry, err := NewEVMRegistryV2_0(address, client)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		encoder, err := NewEVMReportEncoderWithConfig(EVMReportEncoderConfig{
+			Blocks: registry,
+			Logger: logger,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return registry, encoder, nil
+	})
+}
+
+// RegistryConstructor creates a registry and report encoder for a single
+// registry version at the provided address. The logger receives debug logs
+// of the report encoder.
+type RegistryConstructor func(common.Address, types.EVMClient, *log.Logger) (types.Registry, types.ReportEncoder, error)
+
+// RegisterRegistryVersion adds a constructor for registries that report the
+// provided type and version from typeAndVersion. A version without a patch
+// or minor component matches all patch or minor versions, such that
+// 'KeeperRegistry 2.0' matches 'KeeperRegistry 2.0.1'. Registering a type and
+// version again replaces the existing constructor.
+func RegisterRegistryVersion(typeAndVersion string, constructor RegistryConstructor) {
+	registryVersionsMu.Lock()
+	defer registryVersionsMu.Unlock()
+
+	registryVersions[typeAndVersion] = constructor
+}
+
+// lookupRegistryVersion returns the constructor registered for the most
+// specific match of the provided type and version
+func lookupRegistryVersion(typeAndVersion string) (RegistryConstructor, bool) {
+	registryVersionsMu.RLock()
+	defer registryVersionsMu.RUnlock()
+
+	key := strings.TrimSpace(typeAndVersion)
+	for {
+		if constructor, ok := registryVersions[key]; ok {
+			return constructor, true
+		}
+
+		// only trim version components following the type
+		idx := strings.LastIndex(key, ".")
+		if idx < 0 || idx < strings.LastIndex(key, " ") {
+			return nil, false
+		}
+
+		key = key[:idx]
+	}
+}
+
+// DetectRegistryVersion returns the type and version reported by the registry
+// at the provided address. A nil block results in the latest block.
+func DetectRegistryVersion(ctx context.Context, address common.Address, client types.EVMClient, block *big.Int) (string, error) {
+	payload, err := keeperRegistryABI.Pack("typeAndVersion")
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: payload}, block)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: failed to call typeAndVersion", err, ErrRegistryCallFailure)
+	}
+
+	out, err := keeperRegistryABI.Unpack("typeAndVersion", raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to unpack typeAndVersion", err)
+	}
+
+	typeAndVersion, ok := out[0].(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected typeAndVersion result type %T", out[0])
+	}
+
+	return typeAndVersion, nil
+}
+
+// evmVersionedRegistry implements types.Registry interface by delegating to
+// the registry matching the detected registry version. The version is
+// detected again after ConfigSet or UpkeepMigrated events.
+type evmVersionedRegistry struct {
+	address common.Address
+	client  types.EVMClient
+	logger  *log.Logger
+
+	mu             sync.RWMutex
+	typeAndVersion string
+	registry       types.Registry
+	encoder        types.ReportEncoder
+	// lastBlock is the last block registry events were polled at
+	lastBlock uint64
+}
+
+var _ types.IdentifierParser = (*evmVersionedRegistry)(nil)
+
+// NewEVMRegistry detects the version of the registry at the provided address
+// and returns a registry and report encoder for that version. Both follow
+// the registry to a new version when one is detected. The logger receives
+// debug logs of the report encoder.
+func NewEVMRegistry(address common.Address, client types.EVMClient, logger *log.Logger) (types.Registry, types.ReportEncoder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), detectVersionTimeout)
+	defer cancel()
+
+	r := &evmVersionedRegistry{
+		address: address,
+		client:  client,
+		logger:  logger,
+	}
+
+	if err := r.detect(ctx, nil); err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to detect registry version", err)
+	}
+
+	return r, &evmVersionedReportEncoder{registry: r}, nil
+}
+
+// TypeAndVersion returns the last detected type and version of the registry
+func (r *evmVersionedRegistry) TypeAndVersion() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.typeAndVersion
+}
+
+func (r *evmVersionedRegistry) GetActiveUpkeepKeys(ctx context.Context, block types.BlockKey) ([]types.UpkeepKey, error) {
+	if err := r.refresh(ctx, block); err != nil {
+		return nil, err
+	}
+
+	return r.current().GetActiveUpkeepKeys(ctx, block)
+}
+
+func (r *evmVersionedRegistry) CheckUpkeep(ctx context.Context, keys ...types.UpkeepKey) (types.UpkeepResults, error) {
+	return r.current().CheckUpkeep(ctx, keys...)
+}
+
+func (r *evmVersionedRegistry) IdentifierFromKey(key types.UpkeepKey) (types.UpkeepIdentifier, error) {
+	return r.current().IdentifierFromKey(key)
+}
+
+// ParseIdentifier parses an upkeep id with the current registry version
+func (r *evmVersionedRegistry) ParseIdentifier(id string) (types.UpkeepIdentifier, error) {
+	parser, ok := r.current().(types.IdentifierParser)
+	if !ok {
+		return nil, fmt.Errorf("registry version cannot parse upkeep ids")
+	}
+
+	return parser.ParseIdentifier(id)
+}
+
+func (r *evmVersionedRegistry) BlockFromKey(key types.UpkeepKey) (types.BlockKey, error) {
+	return r.current().BlockFromKey(key)
+}
+
+func (r *evmVersionedRegistry) CompareBlocks(a, b types.BlockKey) (int, error) {
+	return r.current().CompareBlocks(a, b)
+}
+
+func (r *evmVersionedRegistry) MakeKey(block types.BlockKey, id types.UpkeepIdentifier) types.UpkeepKey {
+	return r.current().MakeKey(block, id)
+}
+
+func (r *evmVersionedRegistry) current() types.Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.registry
+}
+
+func (r *evmVersionedRegistry) currentEncoder() types.ReportEncoder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.encoder
+}
+
+// refresh polls registry events between the last polled block and the
+// provided block and detects the registry version again if any are found.
+// The first refresh only sets the starting block.
+func (r *evmVersionedRegistry) refresh(ctx context.Context, block types.BlockKey) error {
+	end, ok := new(big.Int).SetString(string(block), 10)
+	if !ok {
+		return fmt.Errorf("%w: requires big int", ErrBlockKeyNotParsable)
+	}
+
+	if end.Sign() == 0 {
+		header, err := r.client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("%w: %s: EVM failed to fetch block header", err, ErrRegistryCallFailure)
+		}
+
+		end = header.Number
+	}
+
+	r.mu.Lock()
+	last := r.lastBlock
+	if last == 0 {
+		r.lastBlock = end.Uint64()
+	}
+	r.mu.Unlock()
+
+	if last == 0 || end.Uint64() <= last {
+		return nil
+	}
+
+	logs, err := r.client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(last + 1),
+		ToBlock:   end,
+		Addresses: []common.Address{r.address},
+		Topics:    [][]common.Hash{registryChangeTopics},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s: failed to filter registry change events", err, ErrRegistryCallFailure)
+	}
+
+	changed := false
+	for _, log := range logs {
+		if !log.Removed {
+			changed = true
+			break
+		}
+	}
+
+	if changed {
+		if err := r.detect(ctx, end); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	if end.Uint64() > r.lastBlock {
+		r.lastBlock = end.Uint64()
+	}
+	r.mu.Unlock()
+
+	return nil
+}
+
+// detect sets the registry and encoder for the type and version reported by
+// the registry at the provided block. Both are kept when the type and version
+// did not change.
+func (r *evmVersionedRegistry) detect(ctx context.Context, block *big.Int) error {
+	typeAndVersion, err := DetectRegistryVersion(ctx, r.address, r.client, block)
+	if err != nil {
+		return err
+	}
+
+	if typeAndVersion == r.TypeAndVersion() {
+		return nil
+	}
+
+	constructor, ok := lookupRegistryVersion(typeAndVersion)
+	if !ok {
+		return fmt.Errorf("%w: '%s'", ErrUnsupportedRegistryVersion, typeAndVersion)
+	}
+
+	registry, encoder, err := constructor(r.address, r.client, r.logger)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.typeAndVersion = typeAndVersion
+	r.registry = registry
+	r.encoder = encoder
+
+	return nil
+}
+
+// evmVersionedReportEncoder implements types.ReportEncoder interface with the
+// encoder of the detected registry version
+type evmVersionedReportEncoder struct {
+	registry *evmVersionedRegistry
+}
+
+func (e *evmVersionedReportEncoder) EncodeReport(results []types.UpkeepResult) ([]byte, error) {
+	return e.registry.currentEncoder().EncodeReport(results)
+}
+
+func (e *evmVersionedReportEncoder) DecodeReport(report []byte) ([]types.UpkeepResult, error) {
+	return e.registry.currentEncoder().DecodeReport(report)
+}
+
+// EarliestCheckBlock implements the types.CheckBlockWindow interface with the
+// window of the encoder of the detected registry version. Any check block is
+// accepted if that encoder has no window.
+func (e *evmVersionedReportEncoder) EarliestCheckBlock(latest types.BlockKey) (types.BlockKey, error) {
+	if window, ok := e.registry.currentEncoder().(types.CheckBlockWindow); ok {
+		return window.EarliestCheckBlock(latest)
+	}
+
+	return types.BlockKey("0"), nil
+}
@@ -0,0 +1,133 @@
+package chain
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+func TestNewEVMRegistry(t *testing.T) {
+	t.Run("KeeperRegistry 2.0", func(t *testing.T) {
+		mockClient := types.NewMockEVMClient(t)
+		receiver := NewContractMockReceiver(t, mockClient, keeperRegistryABI)
+		receiver.MockResponse("typeAndVersion", "KeeperRegistry 2.0.0").Once()
+
+		registry, encoder, err := NewEVMRegistry(common.Address{}, mockClient, nil)
+		require.NoError(t, err)
+
+		versioned, ok := registry.(*evmVersionedRegistry)
+		require.True(t, ok)
+
+		assert.Equal(t, "KeeperRegistry 2.0.0", versioned.TypeAndVersion())
+		assert.IsType(t, &evmRegistryv2_0{}, versioned.current())
+		assert.IsType(t, &evmReportEncoder{}, encoder.(*evmVersionedReportEncoder).registry.currentEncoder())
+	})
+
+	t.Run("Unsupported Version", func(t *testing.T) {
+		mockClient := types.NewMockEVMClient(t)
+		receiver := NewContractMockReceiver(t, mockClient, keeperRegistryABI)
+		receiver.MockResponse("typeAndVersion", "KeeperRegistry 1.2.0").Once()
+
+		_, _, err := NewEVMRegistry(common.Address{}, mockClient, nil)
+		assert.ErrorIs(t, err, ErrUnsupportedRegistryVersion)
+	})
+}
+
+func TestLookupRegistryVersion(t *testing.T) {
+	tests := []struct {
+		TypeAndVersion string
+		Found          bool
+	}{
+		{TypeAndVersion: "KeeperRegistry 2.0", Found: true},
+		{TypeAndVersion: "KeeperRegistry 2.0.0", Found: true},
+		{TypeAndVersion: "KeeperRegistry 2.0.12", Found: true},
+		{TypeAndVersion: "KeeperRegistry 2.1.0", Found: false},
+		{TypeAndVersion: "KeeperRegistry 2", Found: false},
+		{TypeAndVersion: "KeeperRegistry", Found: false},
+		{TypeAndVersion: "", Found: false},
+	}
+
+	for _, test := range tests {
+		_, ok := lookupRegistryVersion(test.TypeAndVersion)
+		assert.Equal(t, test.Found, ok, test.TypeAndVersion)
+	}
+}
+
+func TestEVMVersionedRegistry_Redetect(t *testing.T) {
+	ctx := context.Background()
+	mockClient := types.NewMockEVMClient(t)
+
+	registries := map[string]*types.MockRegistry{
+		"TestRegistry 1.0": types.NewMockRegistry(t),
+		"TestRegistry 1.1": types.NewMockRegistry(t),
+	}
+
+	encoders := map[string]*types.MockReportEncoder{
+		"TestRegistry 1.0": types.NewMockReportEncoder(t),
+		"TestRegistry 1.1": types.NewMockReportEncoder(t),
+	}
+
+	for version := range registries {
+		version := version
+		RegisterRegistryVersion(version, func(common.Address, types.EVMClient, *log.Logger) (types.Registry, types.ReportEncoder, error) {
+			return registries[version], encoders[version], nil
+		})
+	}
+
+	receiver := NewContractMockReceiver(t, mockClient, keeperRegistryABI)
+	receiver.MockResponse("typeAndVersion", "TestRegistry 1.0.0").Once()
+
+	registry, encoder, err := NewEVMRegistry(common.Address{}, mockClient, nil)
+	require.NoError(t, err)
+
+	// the first call only sets the block events are polled from
+	registries["TestRegistry 1.0"].Mock.On("GetActiveUpkeepKeys", ctx, types.BlockKey("10")).Return([]types.UpkeepKey{}, nil).Once()
+
+	_, err = registry.GetActiveUpkeepKeys(ctx, types.BlockKey("10"))
+	assert.NoError(t, err)
+
+	// no change events keeps the current version
+	mockClient.On("FilterLogs", ctx, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return q.FromBlock.Int64() == 11 && q.ToBlock.Int64() == 11
+	})).Return([]ethtypes.Log{}, nil).Once()
+	registries["TestRegistry 1.0"].Mock.On("GetActiveUpkeepKeys", ctx, types.BlockKey("11")).Return([]types.UpkeepKey{}, nil).Once()
+
+	_, err = registry.GetActiveUpkeepKeys(ctx, types.BlockKey("11"))
+	assert.NoError(t, err)
+
+	// a ConfigSet event results in detecting the version again
+	mockClient.On("FilterLogs", ctx, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return q.FromBlock.Int64() == 12 && q.ToBlock.Int64() == 13
+	})).Return([]ethtypes.Log{{Topics: []common.Hash{keeperRegistryABI.Events["ConfigSet"].ID}, BlockNumber: 13}}, nil).Once()
+	receiver.MockResponse("typeAndVersion", "TestRegistry 1.1.0").Once()
+	registries["TestRegistry 1.1"].Mock.On("GetActiveUpkeepKeys", ctx, types.BlockKey("13")).Return([]types.UpkeepKey{types.UpkeepKey("13|1")}, nil).Once()
+
+	keys, err := registry.GetActiveUpkeepKeys(ctx, types.BlockKey("13"))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.UpkeepKey{types.UpkeepKey("13|1")}, keys)
+	assert.Equal(t, "TestRegistry 1.1.0", registry.(*evmVersionedRegistry).TypeAndVersion())
+
+	// the encoder follows the detected version
+	encoders["TestRegistry 1.1"].Mock.On("EncodeReport", mock.Anything).Return([]byte("report"), nil).Once()
+
+	b, err := encoder.EncodeReport([]types.UpkeepResult{})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("report"), b)
+
+	// a block key of 0 polls events up to the latest block
+	mockClient.On("HeaderByNumber", ctx, (*big.Int)(nil)).Return(&ethtypes.Header{Number: big.NewInt(13)}, nil).Once()
+	registries["TestRegistry 1.1"].Mock.On("GetActiveUpkeepKeys", ctx, types.BlockKey("0")).Return([]types.UpkeepKey{}, nil).Once()
+
+	_, err = registry.GetActiveUpkeepKeys(ctx, types.BlockKey("0"))
+	assert.NoError(t, err)
+}
@@ -2,19 +2,82 @@ package chain
 
 import (
 	"fmt"
+	"log"
 	"math/big"
+	"sort"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
 
 	ktypes "github.com/smartcontractkit/ocr2keepers/pkg/types"
 )
 
-type evmReportEncoder struct{}
+// BaseValuesPolicy selects the fastGasWei and linkNative values included in a
+// report from the values of each check result
+type BaseValuesPolicy string
+
+const (
+	// BaseValuesLatest selects the values from results at the latest check
+	// block. The median is used if results at that block differ.
+	BaseValuesLatest BaseValuesPolicy = "latest"
+	// BaseValuesMedian selects the median of the values from all results
+	BaseValuesMedian BaseValuesPolicy = "median"
+
+	// defaultMaxBaseValuesLag is the default number of blocks base values can
+	// be behind the latest check block
+	defaultMaxBaseValuesLag = 10
+)
+
+var (
+	ErrStaleBaseValues   = fmt.Errorf("base values are stale")
+	ErrMissingBaseValues = fmt.Errorf("base values missing from results")
+)
+
+// EVMReportEncoderConfig configures how base values are selected for reports
+type EVMReportEncoderConfig struct {
+	// BaseValues is the policy to select fastGasWei and linkNative with. The
+	// default is BaseValuesLatest.
+	BaseValues BaseValuesPolicy
+	// MaxBaseValuesLag is the max number of blocks the check block of a
+	// result can be behind the latest check block in a report. Reports with
+	// results checked at earlier blocks are not encoded. The default is 10
+	// blocks.
+	MaxBaseValuesLag uint32
+	// Blocks orders the check blocks of results. The default orders blocks
+	// by block number.
+	Blocks ktypes.BlockComparer
+	// Logger receives debug logs on selected base values. Logs are discarded
+	// if not set.
+	Logger *log.Logger
+}
+
+type evmReportEncoder struct {
+	policy BaseValuesPolicy
+	maxLag uint32
+	blocks ktypes.BlockComparer
+	logger *log.Logger
+}
 
 func NewEVMReportEncoder() *evmReportEncoder {
 	return &evmReportEncoder{}
 }
 
+func NewEVMReportEncoderWithConfig(config EVMReportEncoderConfig) (*evmReportEncoder, error) {
+	switch config.BaseValues {
+	case "", BaseValuesLatest, BaseValuesMedian:
+	default:
+		return nil, fmt.Errorf("unknown base values policy '%s'", config.BaseValues)
+	}
+
+	return &evmReportEncoder{
+		policy: config.BaseValues,
+		maxLag: config.MaxBaseValuesLag,
+		blocks: config.Blocks,
+		logger: config.Logger,
+	}, nil
+}
+
+var _ ktypes.CheckBlockWindow = (*evmReportEncoder)(nil)
+
 var (
 	Uint256, _                = abi.NewType("uint256", "", nil)
 	Uint256Arr, _             = abi.NewType("uint256[]", "", nil)
@@ -38,15 +101,10 @@ func (b *evmReportEncoder) EncodeReport(toReport []ktypes.UpkeepResult) ([]byte,
 		{Name: "wrappedPerformDatas", Type: PerformDataArr},
 	}
 
-	var baseValuesIdx int
-	for i, rpt := range toReport {
-		if rpt.CheckBlockNumber > uint32(baseValuesIdx) {
-			baseValuesIdx = i
-		}
+	if err := b.checkStale(toReport); err != nil {
+		return nil, fmt.Errorf("%w: report encoding error", err)
 	}
 
-	fastGas := toReport[baseValuesIdx].FastGasWei
-	link := toReport[baseValuesIdx].LinkNative
 	ids := make([]*big.Int, len(toReport))
 	data := make([]wrappedPerform, len(toReport))
 
@@ -64,6 +122,11 @@ func (b *evmReportEncoder) EncodeReport(toReport []ktypes.UpkeepResult) ([]byte,
 		}
 	}
 
+	fastGas, link, err := b.baseValues(toReport)
+	if err != nil {
+		return nil, fmt.Errorf("%w: report encoding error", err)
+	}
+
 	bts, err := reportArgs.Pack(fastGas, link, ids, data)
 	if err != nil {
 		return []byte{}, fmt.Errorf("%w: failed to pack report data", err)
@@ -72,6 +135,229 @@ func (b *evmReportEncoder) EncodeReport(toReport []ktypes.UpkeepResult) ([]byte,
 	return bts, nil
 }
 
+// EarliestCheckBlock implements the types.CheckBlockWindow interface. Results
+// checked more than the max lag before the latest check block of a report
+// result in stale base values.
+func (b *evmReportEncoder) EarliestCheckBlock(latest ktypes.BlockKey) (ktypes.BlockKey, error) {
+	number, ok := new(big.Int).SetString(string(latest), 10)
+	if !ok {
+		return "", fmt.Errorf("%w: requires big int: '%s'", ErrBlockKeyNotParsable, latest)
+	}
+
+	number.Sub(number, big.NewInt(int64(b.lag())))
+	if number.Sign() < 0 {
+		number.SetInt64(0)
+	}
+
+	return ktypes.BlockKey(number.String()), nil
+}
+
+// checkStale returns an error if any result is checked more than the max lag
+// before the latest check block
+func (b *evmReportEncoder) checkStale(toReport []ktypes.UpkeepResult) error {
+	latest, err := b.latestResult(toReport)
+	if err != nil {
+		return err
+	}
+
+	block, _, err := BlockAndIdFromKey(toReport[latest].Key)
+	if err != nil {
+		return err
+	}
+
+	earliest, err := b.EarliestCheckBlock(block)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range toReport {
+		block, _, err := BlockAndIdFromKey(result.Key)
+		if err != nil {
+			return err
+		}
+
+		cmp, err := b.comparer().CompareBlocks(block, earliest)
+		if err != nil {
+			return err
+		}
+
+		if cmp < 0 {
+			return fmt.Errorf("%w: result %s checked before block %s", ErrStaleBaseValues, result.Key, earliest)
+		}
+	}
+
+	return nil
+}
+
+func (b *evmReportEncoder) lag() uint32 {
+	if b.maxLag == 0 {
+		return defaultMaxBaseValuesLag
+	}
+
+	return b.maxLag
+}
+
+// latestResult returns the index of the first result at the latest check
+// block in the order of the block comparer
+func (b *evmReportEncoder) latestResult(results []ktypes.UpkeepResult) (int, error) {
+	var (
+		latest      int
+		latestBlock ktypes.BlockKey
+	)
+
+	for i, result := range results {
+		block, _, err := BlockAndIdFromKey(result.Key)
+		if err != nil {
+			return 0, err
+		}
+
+		if i == 0 {
+			latestBlock = block
+			continue
+		}
+
+		after, err := ktypes.BlockAfter(b.comparer(), block, latestBlock)
+		if err != nil {
+			return 0, err
+		}
+
+		if after {
+			latest, latestBlock = i, block
+		}
+	}
+
+	return latest, nil
+}
+
+func (b *evmReportEncoder) comparer() ktypes.BlockComparer {
+	if b.blocks == nil {
+		return evmBlockComparer{}
+	}
+
+	return b.blocks
+}
+
+// baseValues selects fastGasWei and linkNative for a report according to the
+// configured policy. The selection does not depend on the order of results so
+// all nodes select the same values for the same set of results.
+func (b *evmReportEncoder) baseValues(toReport []ktypes.UpkeepResult) (*big.Int, *big.Int, error) {
+	idx, err := b.latestResult(toReport)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	latest, _, err := BlockAndIdFromKey(toReport[idx].Key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	policy := b.policy
+	if policy == "" {
+		policy = BaseValuesLatest
+	}
+
+	candidates := toReport
+	if policy == BaseValuesLatest {
+		candidates = make([]ktypes.UpkeepResult, 0, len(toReport))
+		for _, result := range toReport {
+			block, _, err := BlockAndIdFromKey(result.Key)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			cmp, err := b.comparer().CompareBlocks(block, latest)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if cmp == 0 {
+				candidates = append(candidates, result)
+			}
+		}
+	}
+
+	fastGas, fastGasBlock, err := b.medianBaseValue(candidates, func(r ktypes.UpkeepResult) *big.Int { return r.FastGasWei })
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: fastGasWei", err)
+	}
+
+	link, linkBlock, err := b.medianBaseValue(candidates, func(r ktypes.UpkeepResult) *big.Int { return r.LinkNative })
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: linkNative", err)
+	}
+
+	if b.logger != nil {
+		b.logger.Printf("selected base values by %s policy from %d results: fastGasWei %s from block %s, linkNative %s from block %s, latest check block %s", policy, len(toReport), fastGas, fastGasBlock, link, linkBlock, latest)
+	}
+
+	return fastGas, link, nil
+}
+
+// medianBaseValue returns the lower median of the values from the provided
+// results and the check block of the result it was taken from. When multiple
+// results have the median value, the latest check block is returned. Results
+// without a value are ignored.
+func (b *evmReportEncoder) medianBaseValue(results []ktypes.UpkeepResult, value func(ktypes.UpkeepResult) *big.Int) (*big.Int, ktypes.BlockKey, error) {
+	type blockValue struct {
+		value *big.Int
+		block ktypes.BlockKey
+	}
+
+	values := make([]blockValue, 0, len(results))
+	for _, result := range results {
+		if v := value(result); v != nil {
+			block, _, err := BlockAndIdFromKey(result.Key)
+			if err != nil {
+				return nil, "", err
+			}
+
+			values = append(values, blockValue{value: v, block: block})
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, "", ErrMissingBaseValues
+	}
+
+	var cmpErr error
+	sort.Slice(values, func(i, j int) bool {
+		if c := values[i].value.Cmp(values[j].value); c != 0 {
+			return c < 0
+		}
+
+		after, err := ktypes.BlockAfter(b.comparer(), values[i].block, values[j].block)
+		if err != nil {
+			cmpErr = err
+		}
+
+		return after
+	})
+
+	if cmpErr != nil {
+		return nil, "", cmpErr
+	}
+
+	median := values[(len(values)-1)/2]
+
+	// prefer the latest block among results with the same value
+	for _, v := range values {
+		if v.value.Cmp(median.value) != 0 {
+			continue
+		}
+
+		after, err := ktypes.BlockAfter(b.comparer(), v.block, median.block)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if after {
+			median.block = v.block
+		}
+	}
+
+	return median.value, median.block, nil
+}
+
 func (b *evmReportEncoder) DecodeReport(report []byte) ([]ktypes.UpkeepResult, error) {
 	mKeys := []string{"fastGasWei", "linkNative", "upkeepIds", "wrappedPerformDatas"}
 
@@ -147,6 +433,13 @@ func (b *evmReportEncoder) DecodeReport(report []byte) ([]ktypes.UpkeepResult, e
 	return res, nil
 }
 
+// evmBlockComparer orders EVM block keys by block number
+type evmBlockComparer struct{}
+
+func (evmBlockComparer) CompareBlocks(a, b ktypes.BlockKey) (int, error) {
+	return CompareBlockKeys(a, b)
+}
+
 type wrappedPerform struct {
 	CheckBlockNumber uint32   `abi:"checkBlockNumber"`
 	CheckBlockhash   [32]byte `abi:"checkBlockhash"`
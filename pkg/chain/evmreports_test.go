@@ -2,6 +2,7 @@ package chain
 
 import (
 	"bytes"
+	"log"
 	"math/big"
 	"math/rand"
 	"testing"
@@ -122,6 +123,183 @@ func TestEncodeReport_EmptyPerformData(t *testing.T) {
 	assert.Equal(t, expected, b)
 }
 
+func TestEncodeReport_BaseValues(t *testing.T) {
+	result := func(key string, block uint32, fastGas, link int64) ktypes.UpkeepResult {
+		return ktypes.UpkeepResult{
+			Key:              ktypes.UpkeepKey(key),
+			PerformData:      []byte("hello"),
+			FastGasWei:       big.NewInt(fastGas),
+			LinkNative:       big.NewInt(link),
+			CheckBlockNumber: block,
+		}
+	}
+
+	tests := []struct {
+		Name            string
+		Config          EVMReportEncoderConfig
+		Input           []ktypes.UpkeepResult
+		ExpectedFastGas int64
+		ExpectedLink    int64
+		ExpectedErr     error
+	}{
+		{
+			Name:   "Latest",
+			Config: EVMReportEncoderConfig{BaseValues: BaseValuesLatest},
+			Input: []ktypes.UpkeepResult{
+				result("43|2", 43, 8, 16),
+				result("42|1", 42, 16, 8),
+			},
+			ExpectedFastGas: 8,
+			ExpectedLink:    16,
+		},
+		{
+			Name:   "Latest Median At Block",
+			Config: EVMReportEncoderConfig{BaseValues: BaseValuesLatest},
+			Input: []ktypes.UpkeepResult{
+				result("43|1", 43, 30, 1),
+				result("43|2", 43, 10, 3),
+				result("43|3", 43, 20, 2),
+				result("42|4", 42, 5, 5),
+			},
+			ExpectedFastGas: 20,
+			ExpectedLink:    2,
+		},
+		{
+			Name:   "Median",
+			Config: EVMReportEncoderConfig{BaseValues: BaseValuesMedian},
+			Input: []ktypes.UpkeepResult{
+				result("43|1", 43, 30, 1),
+				result("42|2", 42, 10, 3),
+				result("41|3", 41, 20, 2),
+				result("40|4", 40, 40, 4),
+			},
+			ExpectedFastGas: 20,
+			ExpectedLink:    2,
+		},
+		{
+			Name:   "Missing Values",
+			Config: EVMReportEncoderConfig{},
+			Input: []ktypes.UpkeepResult{
+				{Key: ktypes.UpkeepKey("43|1"), CheckBlockNumber: 43},
+			},
+			ExpectedErr: ErrMissingBaseValues,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var logs bytes.Buffer
+			test.Config.Logger = log.New(&logs, "", 0)
+
+			encoder, err := NewEVMReportEncoderWithConfig(test.Config)
+			assert.NoError(t, err)
+
+			b, err := encoder.EncodeReport(test.Input)
+			if test.ExpectedErr != nil {
+				assert.ErrorIs(t, err, test.ExpectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+
+			decoded, err := encoder.DecodeReport(b)
+			assert.NoError(t, err)
+			assert.Equal(t, big.NewInt(test.ExpectedFastGas), decoded[0].FastGasWei)
+			assert.Equal(t, big.NewInt(test.ExpectedLink), decoded[0].LinkNative)
+			assert.Contains(t, logs.String(), "selected base values")
+
+			// the order of results does not change the selected values
+			reversed := make([]ktypes.UpkeepResult, len(test.Input))
+			for i, r := range test.Input {
+				reversed[len(test.Input)-1-i] = r
+			}
+
+			fastGas, link, err := encoder.baseValues(reversed)
+			assert.NoError(t, err)
+			assert.Equal(t, big.NewInt(test.ExpectedFastGas), fastGas)
+			assert.Equal(t, big.NewInt(test.ExpectedLink), link)
+		})
+	}
+}
+
+func TestEncodeReport_StaleResults(t *testing.T) {
+	result := func(key string, block uint32, fastGas, link int64) ktypes.UpkeepResult {
+		return ktypes.UpkeepResult{
+			Key:              ktypes.UpkeepKey(key),
+			PerformData:      []byte("hello"),
+			FastGasWei:       big.NewInt(fastGas),
+			LinkNative:       big.NewInt(link),
+			CheckBlockNumber: block,
+		}
+	}
+
+	encoder, err := NewEVMReportEncoderWithConfig(EVMReportEncoderConfig{
+		BaseValues:       BaseValuesMedian,
+		MaxBaseValuesLag: 1,
+	})
+	assert.NoError(t, err)
+
+	input := []ktypes.UpkeepResult{
+		result("43|1", 43, 30, 1),
+		result("42|2", 42, 10, 3),
+		result("41|3", 41, 20, 2),
+	}
+
+	// a result more than 1 block behind the latest fails the report and the
+	// provided results are not changed
+	_, err = encoder.EncodeReport(input)
+	assert.ErrorIs(t, err, ErrStaleBaseValues)
+	assert.Len(t, input, 3)
+
+	_, err = encoder.EncodeReport(input[:2])
+	assert.NoError(t, err)
+}
+
+func TestEncodeReport_BlockComparer(t *testing.T) {
+	blocks := new(recordingBlockComparer)
+	encoder, err := NewEVMReportEncoderWithConfig(EVMReportEncoderConfig{Blocks: blocks})
+	assert.NoError(t, err)
+
+	// check blocks that differ in digit count are ordered by the comparer
+	b, err := encoder.EncodeReport([]ktypes.UpkeepResult{
+		{Key: ktypes.UpkeepKey("1000|2"), FastGasWei: big.NewInt(8), LinkNative: big.NewInt(16), CheckBlockNumber: 1000},
+		{Key: ktypes.UpkeepKey("999|1"), FastGasWei: big.NewInt(16), LinkNative: big.NewInt(8), CheckBlockNumber: 999},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, blocks.compared, ktypes.BlockKey("1000"))
+
+	decoded, err := encoder.DecodeReport(b)
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(8), decoded[0].FastGasWei)
+	assert.Equal(t, big.NewInt(16), decoded[0].LinkNative)
+}
+
+func TestEarliestCheckBlock(t *testing.T) {
+	encoder, err := NewEVMReportEncoderWithConfig(EVMReportEncoderConfig{MaxBaseValuesLag: 5})
+	assert.NoError(t, err)
+
+	earliest, err := encoder.EarliestCheckBlock(ktypes.BlockKey("43"))
+	assert.NoError(t, err)
+	assert.Equal(t, ktypes.BlockKey("38"), earliest)
+
+	earliest, err = encoder.EarliestCheckBlock(ktypes.BlockKey("3"))
+	assert.NoError(t, err)
+	assert.Equal(t, ktypes.BlockKey("0"), earliest)
+
+	_, err = encoder.EarliestCheckBlock(ktypes.BlockKey("0x2b"))
+	assert.ErrorIs(t, err, ErrBlockKeyNotParsable)
+
+	// the default lag is 10 blocks
+	earliest, err = NewEVMReportEncoder().EarliestCheckBlock(ktypes.BlockKey("43"))
+	assert.NoError(t, err)
+	assert.Equal(t, ktypes.BlockKey("33"), earliest)
+}
+
+func TestNewEVMReportEncoderWithConfig_Error(t *testing.T) {
+	_, err := NewEVMReportEncoderWithConfig(EVMReportEncoderConfig{BaseValues: BaseValuesPolicy("unknown")})
+	assert.Error(t, err)
+}
+
 func TestDecodeReport(t *testing.T) {
 	expected := []ktypes.UpkeepResult{
 		{
@@ -206,3 +384,14 @@ func BenchmarkEncodeReport(b *testing.B) {
 		})
 	}
 }
+
+// recordingBlockComparer orders blocks by block number and records the
+// compared blocks
+type recordingBlockComparer struct {
+	compared []ktypes.BlockKey
+}
+
+func (c *recordingBlockComparer) CompareBlocks(a, b ktypes.BlockKey) (int, error) {
+	c.compared = append(c.compared, a, b)
+	return CompareBlockKeys(a, b)
+}
@@ -0,0 +1,197 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/libocr/offchainreporting2/chains/evmutil"
+	ocr2types "github.com/smartcontractkit/libocr/offchainreporting2/types"
+
+	"github.com/smartcontractkit/ocr2keepers/pkg/chain/gethwrappers/keeper_registry_wrapper2_0"
+	"github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+// maxTransmitSignatures is the max number of signatures that fit in the packed
+// v values of a transmit call
+const maxTransmitSignatures = 32
+
+// EVMTransactionSender signs and sends transactions from a single account
+type EVMTransactionSender interface {
+	// From returns the address transactions are sent from
+	From() common.Address
+	// SendTransaction signs a transaction to the provided address with the
+	// provided calldata and submits it to the chain
+	SendTransaction(ctx context.Context, to common.Address, calldata []byte) error
+}
+
+// bindTransactionSender implements EVMTransactionSender with go-ethereum
+// transact opts
+type bindTransactionSender struct {
+	backend bind.ContractBackend
+	opts    bind.TransactOpts
+}
+
+// NewEVMTransactionSender is the constructor of bindTransactionSender.
+// Transactions are signed with the signer of the provided opts. Gas price,
+// gas limit, and nonce are estimated by the backend when not set in opts.
+func NewEVMTransactionSender(backend bind.ContractBackend, opts *bind.TransactOpts) (*bindTransactionSender, error) {
+	if opts == nil || opts.Signer == nil {
+		return nil, fmt.Errorf("%w: transact opts with a signer are required", ErrInitializationFailure)
+	}
+
+	return &bindTransactionSender{
+		backend: backend,
+		opts:    *opts,
+	}, nil
+}
+
+func (s *bindTransactionSender) From() common.Address {
+	return s.opts.From
+}
+
+func (s *bindTransactionSender) SendTransaction(ctx context.Context, to common.Address, calldata []byte) error {
+	opts := s.opts
+	opts.Context = ctx
+
+	contract := bind.NewBoundContract(to, abi.ABI{}, s.backend, s.backend, s.backend)
+	if _, err := contract.RawTransact(&opts, calldata); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// evmContractTransmitter implements ocr2types.ContractTransmitter interface
+// for the keeper registry 2.0
+type evmContractTransmitter struct {
+	address  common.Address
+	registry *keeper_registry_wrapper2_0.KeeperRegistryCaller
+	filterer *keeper_registry_wrapper2_0.KeeperRegistryFilterer
+	sender   EVMTransactionSender
+}
+
+// NewEVMContractTransmitter is the constructor of evmContractTransmitter.
+// Reports are transmitted to the registry at the provided address with the
+// provided sender.
+func NewEVMContractTransmitter(address common.Address, client types.EVMClient, sender EVMTransactionSender) (*evmContractTransmitter, error) {
+	registry, err := keeper_registry_wrapper2_0.NewKeeperRegistryCaller(address, client)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create caller for address and backend", ErrInitializationFailure)
+	}
+
+	filterer, err := keeper_registry_wrapper2_0.NewKeeperRegistryFilterer(address, client)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create filterer for address and backend", ErrInitializationFailure)
+	}
+
+	if sender == nil {
+		return nil, fmt.Errorf("%w: transaction sender is required", ErrInitializationFailure)
+	}
+
+	return &evmContractTransmitter{
+		address:  address,
+		registry: registry,
+		filterer: filterer,
+		sender:   sender,
+	}, nil
+}
+
+// Transmit packs the report, report context, and signatures into a call to
+// transmit on the registry and sends it
+func (t *evmContractTransmitter) Transmit(ctx context.Context, reportCtx ocr2types.ReportContext, report ocr2types.Report, signatures []ocr2types.AttributedOnchainSignature) error {
+	calldata, err := packTransmit(reportCtx, report, signatures)
+	if err != nil {
+		return err
+	}
+
+	if err := t.sender.SendTransaction(ctx, t.address, calldata); err != nil {
+		return fmt.Errorf("%w: failed to send transmit transaction", err)
+	}
+
+	return nil
+}
+
+// LatestConfigDigestAndEpoch returns the config digest and epoch of the latest
+// transmission. When the registry does not store them, they are read from the
+// Transmitted events since the latest config was set.
+func (t *evmContractTransmitter) LatestConfigDigestAndEpoch(ctx context.Context) (ocr2types.ConfigDigest, uint32, error) {
+	opts := &bind.CallOpts{Context: ctx}
+
+	latest, err := t.registry.LatestConfigDigestAndEpoch(opts)
+	if err != nil {
+		return ocr2types.ConfigDigest{}, 0, fmt.Errorf("%w: %s: failed to get latest config digest and epoch", err, ErrRegistryCallFailure)
+	}
+
+	if !latest.ScanLogs {
+		return latest.ConfigDigest, latest.Epoch, nil
+	}
+
+	details, err := t.registry.LatestConfigDetails(opts)
+	if err != nil {
+		return ocr2types.ConfigDigest{}, 0, fmt.Errorf("%w: %s: failed to get latest config details", err, ErrRegistryCallFailure)
+	}
+
+	iter, err := t.filterer.FilterTransmitted(&bind.FilterOpts{
+		Start:   uint64(details.BlockNumber),
+		Context: ctx,
+	})
+	if err != nil {
+		return ocr2types.ConfigDigest{}, 0, fmt.Errorf("%w: %s: failed to filter Transmitted events", err, ErrRegistryCallFailure)
+	}
+
+	// no transmissions for the latest config results in epoch 0
+	var epoch uint32
+	for iter.Next() {
+		if iter.Event.Raw.Removed || iter.Event.ConfigDigest != details.ConfigDigest {
+			continue
+		}
+
+		epoch = iter.Event.Epoch
+	}
+
+	if err := closeIterator(iter.Error(), iter.Close()); err != nil {
+		return ocr2types.ConfigDigest{}, 0, fmt.Errorf("%w: %s: failed to read Transmitted events", err, ErrRegistryCallFailure)
+	}
+
+	return details.ConfigDigest, epoch, nil
+}
+
+// FromAccount returns the account transmissions are sent from
+func (t *evmContractTransmitter) FromAccount() ocr2types.Account {
+	return ocr2types.Account(t.sender.From().Hex())
+}
+
+// packTransmit abi encodes a call to transmit on the registry. The v values of
+// all signatures are packed into a single 32 byte word.
+func packTransmit(reportCtx ocr2types.ReportContext, report ocr2types.Report, signatures []ocr2types.AttributedOnchainSignature) ([]byte, error) {
+	if len(signatures) > maxTransmitSignatures {
+		return nil, fmt.Errorf("too many signatures: %d exceeds max of %d", len(signatures), maxTransmitSignatures)
+	}
+
+	var (
+		rs    = make([][32]byte, len(signatures))
+		ss    = make([][32]byte, len(signatures))
+		rawVs [32]byte
+	)
+
+	for i, sig := range signatures {
+		r, s, v, err := evmutil.SplitSignature(sig.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to split signature of oracle %d", err, sig.Signer)
+		}
+
+		rs[i] = r
+		ss[i] = s
+		rawVs[i] = v
+	}
+
+	calldata, err := keeperRegistryABI.Pack("transmit", evmutil.RawReportContext(reportCtx), []byte(report), rs, ss, rawVs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to pack transmit call", err)
+	}
+
+	return calldata, nil
+}
@@ -0,0 +1,196 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	ocr2types "github.com/smartcontractkit/libocr/offchainreporting2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/ocr2keepers/pkg/types"
+)
+
+type sentTransaction struct {
+	to       common.Address
+	calldata []byte
+}
+
+type mockTransactionSender struct {
+	from common.Address
+	sent []sentTransaction
+	err  error
+}
+
+func (s *mockTransactionSender) From() common.Address {
+	return s.from
+}
+
+func (s *mockTransactionSender) SendTransaction(_ context.Context, to common.Address, calldata []byte) error {
+	s.sent = append(s.sent, sentTransaction{to: to, calldata: calldata})
+	return s.err
+}
+
+func TestEVMContractTransmitter_Transmit(t *testing.T) {
+	ctx := context.Background()
+	address := common.HexToAddress("0x01")
+	sender := &mockTransactionSender{from: common.HexToAddress("0x02")}
+
+	transmitter, err := NewEVMContractTransmitter(address, types.NewMockEVMClient(t), sender)
+	require.NoError(t, err)
+
+	assert.Equal(t, ocr2types.Account(common.HexToAddress("0x02").Hex()), transmitter.FromAccount())
+
+	sig := func(b byte) []byte {
+		s := make([]byte, 65)
+		s[0], s[32], s[64] = b, b+1, 1
+		return s
+	}
+
+	reportCtx := ocr2types.ReportContext{
+		ReportTimestamp: ocr2types.ReportTimestamp{ConfigDigest: ocr2types.ConfigDigest{0x01}, Epoch: 2, Round: 3},
+	}
+
+	err = transmitter.Transmit(ctx, reportCtx, ocr2types.Report("report"), []ocr2types.AttributedOnchainSignature{
+		{Signature: sig(1), Signer: 0},
+		{Signature: sig(3), Signer: 2},
+	})
+	require.NoError(t, err)
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, address, sender.sent[0].to)
+
+	method, err := keeperRegistryABI.MethodById(sender.sent[0].calldata)
+	require.NoError(t, err)
+	assert.Equal(t, "transmit", method.Name)
+
+	args, err := method.Inputs.Unpack(sender.sent[0].calldata[4:])
+	require.NoError(t, err)
+	require.Len(t, args, 5)
+
+	assert.Equal(t, [32]byte{0x01}, args[0].([3][32]byte)[0])
+	assert.Equal(t, []byte("report"), args[1])
+	assert.Equal(t, [][32]byte{{1}, {3}}, args[2])
+	assert.Equal(t, [][32]byte{{2}, {4}}, args[3])
+	assert.Equal(t, [32]byte{1, 1}, args[4])
+
+	t.Run("Invalid Signature", func(t *testing.T) {
+		err := transmitter.Transmit(ctx, reportCtx, ocr2types.Report("report"), []ocr2types.AttributedOnchainSignature{{Signature: []byte{0x01}}})
+		assert.Error(t, err)
+	})
+
+	t.Run("Send Error", func(t *testing.T) {
+		sender.err = fmt.Errorf("send failed")
+		err := transmitter.Transmit(ctx, reportCtx, ocr2types.Report("report"), nil)
+		assert.ErrorIs(t, err, sender.err)
+	})
+}
+
+func TestEVMContractTransmitter_LatestConfigDigestAndEpoch(t *testing.T) {
+	ctx := context.Background()
+	digest := [32]byte{0x01}
+
+	t.Run("Stored", func(t *testing.T) {
+		mockClient := types.NewMockEVMClient(t)
+		transmitter, err := NewEVMContractTransmitter(common.Address{}, mockClient, &mockTransactionSender{})
+		require.NoError(t, err)
+
+		receiver := NewContractMockReceiver(t, mockClient, keeperRegistryABI)
+		receiver.MockResponse("latestConfigDigestAndEpoch", false, digest, uint32(4))
+
+		d, epoch, err := transmitter.LatestConfigDigestAndEpoch(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ocr2types.ConfigDigest(digest), d)
+		assert.Equal(t, uint32(4), epoch)
+	})
+
+	t.Run("Scan Logs", func(t *testing.T) {
+		mockClient := types.NewMockEVMClient(t)
+		transmitter, err := NewEVMContractTransmitter(common.Address{}, mockClient, &mockTransactionSender{})
+		require.NoError(t, err)
+
+		receiver := NewContractMockReceiver(t, mockClient, keeperRegistryABI)
+		receiver.MockResponse("latestConfigDigestAndEpoch", true, [32]byte{}, uint32(0))
+		receiver.MockResponse("latestConfigDetails", uint32(1), uint32(10), digest)
+
+		transmitted := keeperRegistryABI.Events["Transmitted"]
+		transmittedLog := func(d [32]byte, epoch uint32) ethtypes.Log {
+			data, err := transmitted.Inputs.Pack(d, epoch)
+			require.NoError(t, err)
+			return ethtypes.Log{Topics: []common.Hash{transmitted.ID}, Data: data}
+		}
+
+		mockClient.On("FilterLogs", ctx, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+			return q.FromBlock.Int64() == 10 && q.ToBlock == nil && q.Topics[0][0] == transmitted.ID
+		})).Return([]ethtypes.Log{
+			transmittedLog(digest, 2),
+			transmittedLog(digest, 3),
+			transmittedLog([32]byte{0x02}, 5),
+		}, nil).Once()
+
+		d, epoch, err := transmitter.LatestConfigDigestAndEpoch(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ocr2types.ConfigDigest(digest), d)
+		assert.Equal(t, uint32(3), epoch)
+	})
+
+	t.Run("Call Error", func(t *testing.T) {
+		mockClient := types.NewMockEVMClient(t)
+		transmitter, err := NewEVMContractTransmitter(common.Address{}, mockClient, &mockTransactionSender{})
+		require.NoError(t, err)
+
+		receiver := NewContractMockReceiver(t, mockClient, keeperRegistryABI)
+		receiver.MockRevertResponse("latestConfigDigestAndEpoch", "")
+
+		_, _, err = transmitter.LatestConfigDigestAndEpoch(ctx)
+		assert.Error(t, err)
+	})
+}
+
+func TestNewEVMContractTransmitter_Error(t *testing.T) {
+	_, err := NewEVMContractTransmitter(common.Address{}, types.NewMockEVMClient(t), nil)
+	assert.ErrorIs(t, err, ErrInitializationFailure)
+}
+
+func TestEVMTransactionSender(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	opts, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	require.NoError(t, err)
+
+	// gas estimation requires code at the destination address
+	to := common.HexToAddress("0x01")
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		opts.From: {Balance: big.NewInt(1_000_000_000_000_000_000)},
+		to:        {Balance: big.NewInt(0), Code: []byte{0x00}},
+	}, 10_000_000)
+	defer backend.Close()
+
+	sender, err := NewEVMTransactionSender(backend, opts)
+	require.NoError(t, err)
+	assert.Equal(t, opts.From, sender.From())
+
+	require.NoError(t, sender.SendTransaction(context.Background(), to, []byte{0x01, 0x02}))
+	backend.Commit()
+
+	block, err := backend.BlockByNumber(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, block.Transactions(), 1)
+
+	tx := block.Transactions()[0]
+	assert.Equal(t, &to, tx.To())
+	assert.Equal(t, []byte{0x01, 0x02}, tx.Data())
+
+	_, err = NewEVMTransactionSender(backend, &bind.TransactOpts{})
+	assert.ErrorIs(t, err, ErrInitializationFailure)
+}
@@ -1,6 +1,7 @@
 package chain
 
 import (
+	"fmt"
 	"math/big"
 	"strings"
 
@@ -8,6 +9,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/pkg/errors"
 
+	"github.com/smartcontractkit/ocr2keepers/pkg/chain/gethwrappers/keeper_registry_wrapper2_0"
 	"github.com/smartcontractkit/ocr2keepers/pkg/types"
 )
 
@@ -96,3 +98,54 @@ func unmarshalPerformUpkeepSimulationResult(raw string) (bool, error) {
 
 	return *abi.ConvertType(out[0], new(bool)).(*bool), nil
 }
+
+func unmarshalGetUpkeepResult(raw string) (keeper_registry_wrapper2_0.UpkeepInfo, error) {
+	out, err := keeperRegistryABI.Methods["getUpkeep"].
+		Outputs.UnpackValues(hexutil.MustDecode(raw))
+	if err != nil {
+		return keeper_registry_wrapper2_0.UpkeepInfo{}, errors.Wrapf(err, "unpack getUpkeep return: %s", raw)
+	}
+
+	return *abi.ConvertType(out[0], new(keeper_registry_wrapper2_0.UpkeepInfo)).(*keeper_registry_wrapper2_0.UpkeepInfo), nil
+}
+
+// decodeTransmitCheckBlocks returns the check block of each upkeep id in the
+// report of transmit calldata
+func decodeTransmitCheckBlocks(input []byte) (map[string]uint32, error) {
+	if len(input) < 4 {
+		return nil, fmt.Errorf("calldata too short")
+	}
+
+	method, err := keeperRegistryABI.MethodById(input[:4])
+	if err != nil {
+		return nil, err
+	}
+
+	if method.Name != "transmit" {
+		return nil, fmt.Errorf("calldata is not for transmit: %s", method.Name)
+	}
+
+	args, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return nil, errors.Wrap(err, "unpack transmit calldata")
+	}
+
+	rawReport := *abi.ConvertType(args[1], new([]byte)).(*[]byte)
+
+	results, err := (&evmReportEncoder{}).DecodeReport(rawReport)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make(map[string]uint32, len(results))
+	for _, result := range results {
+		_, id, err := BlockAndIdFromKey(result.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		blocks[id.String()] = result.CheckBlockNumber
+	}
+
+	return blocks, nil
+}
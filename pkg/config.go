@@ -19,6 +19,9 @@ const (
 	// DefaultServiceQueueLength is the default buffer size for the RPC worker
 	// queue.
 	DefaultServiceQueueLength = 1000
+	// DefaultRPCReportShare is the default share of the RPC rate limits
+	// reserved for checks made while building reports
+	DefaultRPCReportShare = 0.2
 )
 
 var (
@@ -73,4 +76,27 @@ type DelegateConfig struct {
 	// workers or slower RPC responses will cause this queue to build up.
 	// Adding new items to the queue will block if the queue becomes full.
 	ServiceQueueLength int
+	// RPCCallsPerSecond limits the number of registry calls per second made
+	// for sampling and for building reports, such as checking a batch of
+	// upkeeps or getting the active upkeeps. The limit is disabled by
+	// default.
+	RPCCallsPerSecond float64
+	// RPCBatchElementsPerSecond limits the number of upkeeps checked per
+	// second across all registry calls. Getting the active upkeeps counts as
+	// a single element. The limit is disabled by default.
+	RPCBatchElementsPerSecond float64
+	// RPCReportShare is the share of both RPC limits reserved for checks made
+	// while building reports such that sampling cannot starve the report
+	// phase. Report checks also use the sampling share when it is available.
+	// The value must be less than 1 and is DefaultRPCReportShare by default.
+	RPCReportShare float64
+	// CoordinatorStore persists perform lockouts such that a restarted node
+	// does not report upkeeps that are waiting for a transmit to be
+	// confirmed. The store is not closed by the delegate.
+	CoordinatorStore ktypes.CoordinatorStore
+	// CoordinatorStorePath is the path of a file that perform lockouts are
+	// persisted to when no CoordinatorStore is provided. The file is opened
+	// and closed by the delegate. Lockouts are kept in memory only when
+	// neither is set.
+	CoordinatorStorePath string
 }
@@ -3,9 +3,12 @@ package ocr2keepers
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 
 	offchainreporting "github.com/smartcontractkit/libocr/offchainreporting2"
+	"go.uber.org/multierr"
+
 	"github.com/smartcontractkit/ocr2keepers/internal/keepers"
 )
 
@@ -13,7 +16,11 @@ import (
 // the ability to start and stop underlying services associated with the
 // plugin instance.
 type Delegate struct {
-	keeper *offchainreporting.Oracle
+	keeper  *offchainreporting.Oracle
+	factory keepers.ReportingPluginFactory
+	// store is the coordinator store opened by the delegate; nil if the
+	// store was provided or lockouts are kept in memory
+	store io.Closer
 }
 
 // NewDelegate provides a new Delegate from a provided config. A new logger
@@ -31,6 +38,7 @@ func NewDelegate(c DelegateConfig) (*Delegate, error) {
 		CacheEvictionInterval: DefaultCacheClearInterval,
 		MaxServiceWorkers:     DefaultMaxServiceWorkers,
 		ServiceQueueLength:    DefaultServiceQueueLength,
+		RPCReportShare:        DefaultRPCReportShare,
 	}
 
 	// override if set in config
@@ -50,6 +58,35 @@ func NewDelegate(c DelegateConfig) (*Delegate, error) {
 		conf.ServiceQueueLength = c.ServiceQueueLength
 	}
 
+	conf.RPCCallsPerSecond = c.RPCCallsPerSecond
+	conf.RPCBatchElementsPerSecond = c.RPCBatchElementsPerSecond
+
+	if c.RPCReportShare != 0 {
+		conf.RPCReportShare = c.RPCReportShare
+	}
+
+	var store io.Closer
+
+	conf.CoordinatorStore = c.CoordinatorStore
+	if conf.CoordinatorStore == nil && c.CoordinatorStorePath != "" {
+		fileStore, err := keepers.NewFileCoordinatorStore(c.CoordinatorStorePath)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to open coordinator store", err)
+		}
+
+		conf.CoordinatorStore = fileStore
+		store = fileStore
+	}
+
+	factory := keepers.NewReportingPluginFactory(
+		c.HeadSubscriber,
+		c.Registry,
+		c.PerformLogProvider,
+		c.ReportEncoder,
+		l,
+		conf,
+	)
+
 	// create the oracle from config values
 	keeper, err := offchainreporting.NewOracle(offchainreporting.OracleArgs{
 		BinaryNetworkEndpointFactory: c.BinaryNetworkEndpointFactory,
@@ -63,21 +100,18 @@ func NewDelegate(c DelegateConfig) (*Delegate, error) {
 		OffchainConfigDigester:       c.OffchainConfigDigester,
 		OffchainKeyring:              c.OffchainKeyring,
 		OnchainKeyring:               c.OnchainKeyring,
-		ReportingPluginFactory: keepers.NewReportingPluginFactory(
-			c.HeadSubscriber,
-			c.Registry,
-			c.PerformLogProvider,
-			c.ReportEncoder,
-			l,
-			conf,
-		),
+		ReportingPluginFactory:       factory,
 	})
 
 	if err != nil {
+		if store != nil {
+			_ = store.Close()
+		}
+
 		return nil, fmt.Errorf("%w: failed to create new OCR oracle", err)
 	}
 
-	return &Delegate{keeper: keeper}, nil
+	return &Delegate{keeper: keeper, factory: factory, store: store}, nil
 }
 
 // Start starts the OCR oracle and any associated services
@@ -88,10 +122,36 @@ func (d *Delegate) Start(_ context.Context) error {
 	return nil
 }
 
-// Close stops the OCR oracle and any associated services
-func (d *Delegate) Close() error {
-	if err := d.keeper.Close(); err != nil {
-		return fmt.Errorf("%w: failed to close keeper oracle", err)
+// Healthy returns an error naming the background processes of the plugin
+// that failed and are waiting to be restarted
+func (d *Delegate) Healthy() error {
+	if err := d.factory.Healthy(); err != nil {
+		return fmt.Errorf("%w: keeper plugin unhealthy", err)
 	}
 	return nil
 }
+
+// Close stops the OCR oracle and any associated services. Close returns once
+// all plugin instances and their background processes have stopped.
+func (d *Delegate) Close() error {
+	var err error
+
+	// the oracle closes the plugins it runs and waits for them to stop
+	if kErr := d.keeper.Close(); kErr != nil {
+		err = fmt.Errorf("%w: failed to close keeper oracle", kErr)
+	}
+
+	// plugins not closed by the oracle are closed with the factory
+	if fErr := d.factory.Close(); fErr != nil {
+		err = multierr.Append(err, fmt.Errorf("%w: failed to close keeper plugins", fErr))
+	}
+
+	// the store is closed once no plugin writes to it
+	if d.store != nil {
+		if sErr := d.store.Close(); sErr != nil {
+			err = multierr.Append(err, fmt.Errorf("%w: failed to close coordinator store", sErr))
+		}
+	}
+
+	return err
+}
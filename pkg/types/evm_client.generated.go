@@ -84,6 +84,29 @@ func (_m *MockEVMClient) CodeAt(ctx context.Context, contract common.Address, bl
 	return r0, r1
 }
 
+// FilterLogs provides a mock function with given fields: ctx, q
+func (_m *MockEVMClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]coretypes.Log, error) {
+	ret := _m.Called(ctx, q)
+
+	var r0 []coretypes.Log
+	if rf, ok := ret.Get(0).(func(context.Context, ethereum.FilterQuery) []coretypes.Log); ok {
+		r0 = rf(ctx, q)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]coretypes.Log)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, ethereum.FilterQuery) error); ok {
+		r1 = rf(ctx, q)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // HeaderByNumber provides a mock function with given fields: ctx, number
 func (_m *MockEVMClient) HeaderByNumber(ctx context.Context, number *big.Int) (*coretypes.Header, error) {
 	ret := _m.Called(ctx, number)
@@ -121,6 +144,29 @@ func (_m *MockEVMClient) OnNewHead(ctx context.Context, cb func(BlockKey)) error
 	return r0
 }
 
+// SubscribeFilterLogs provides a mock function with given fields: ctx, q, ch
+func (_m *MockEVMClient) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- coretypes.Log) (ethereum.Subscription, error) {
+	ret := _m.Called(ctx, q, ch)
+
+	var r0 ethereum.Subscription
+	if rf, ok := ret.Get(0).(func(context.Context, ethereum.FilterQuery, chan<- coretypes.Log) ethereum.Subscription); ok {
+		r0 = rf(ctx, q, ch)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(ethereum.Subscription)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, ethereum.FilterQuery, chan<- coretypes.Log) error); ok {
+		r1 = rf(ctx, q, ch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewMockEVMClient creates a new instance of MockEVMClient. It also registers the testing.TB interface on the mock and a cleanup function to assert the mocks expectations.
 func NewMockEVMClient(t testing.TB) *MockEVMClient {
 	mock := &MockEVMClient{}
@@ -14,6 +14,27 @@ type MockRegistry struct {
 	mock.Mock
 }
 
+// BlockFromKey provides a mock function with given fields: _a0
+func (_m *MockRegistry) BlockFromKey(_a0 UpkeepKey) (BlockKey, error) {
+	ret := _m.Called(_a0)
+
+	var r0 BlockKey
+	if rf, ok := ret.Get(0).(func(UpkeepKey) BlockKey); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Get(0).(BlockKey)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(UpkeepKey) error); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CheckUpkeep provides a mock function with given fields: _a0, _a1
 func (_m *MockRegistry) CheckUpkeep(_a0 context.Context, _a1 ...UpkeepKey) (UpkeepResults, error) {
 	_va := make([]interface{}, len(_a1))
@@ -44,6 +65,27 @@ func (_m *MockRegistry) CheckUpkeep(_a0 context.Context, _a1 ...UpkeepKey) (Upke
 	return r0, r1
 }
 
+// CompareBlocks provides a mock function with given fields: a, b
+func (_m *MockRegistry) CompareBlocks(a BlockKey, b BlockKey) (int, error) {
+	ret := _m.Called(a, b)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(BlockKey, BlockKey) int); ok {
+		r0 = rf(a, b)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(BlockKey, BlockKey) error); ok {
+		r1 = rf(a, b)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetActiveUpkeepKeys provides a mock function with given fields: _a0, _a1
 func (_m *MockRegistry) GetActiveUpkeepKeys(_a0 context.Context, _a1 BlockKey) ([]UpkeepKey, error) {
 	ret := _m.Called(_a0, _a1)
@@ -90,6 +132,22 @@ func (_m *MockRegistry) IdentifierFromKey(_a0 UpkeepKey) (UpkeepIdentifier, erro
 	return r0, r1
 }
 
+// MakeKey provides a mock function with given fields: _a0, _a1
+func (_m *MockRegistry) MakeKey(_a0 BlockKey, _a1 UpkeepIdentifier) UpkeepKey {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 UpkeepKey
+	if rf, ok := ret.Get(0).(func(BlockKey, UpkeepIdentifier) UpkeepKey); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(UpkeepKey)
+		}
+	}
+
+	return r0
+}
+
 // NewMockRegistry creates a new instance of MockRegistry. It also registers the testing.TB interface on the mock and a cleanup function to assert the mocks expectations.
 func NewMockRegistry(t testing.TB) *MockRegistry {
 	mock := &MockRegistry{}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -22,12 +23,21 @@ type HeadSubscriber interface {
 	OnNewHead(ctx context.Context, cb func(blockKey BlockKey)) error
 }
 
+// HeadHasher is implemented by head subscribers that can identify the heads
+// they delivered by hash such that a head replaced by a reorg at the same
+// height can be told apart from the head it replaced
+type HeadHasher interface {
+	// HeadHash returns the hash of the latest head delivered at the block
+	HeadHash(BlockKey) (string, bool)
+}
+
 // EVMClient represents evm client's behavior
 //
 //go:generate mockery --name EVMClient --inpackage --output . --case=underscore --filename evm_client.generated.go
 type EVMClient interface {
 	HeadSubscriber
 	bind.ContractCaller
+	bind.ContractFilterer
 	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
 	BatchCallContext(ctx context.Context, b []rpc.BatchElem) error
 }
@@ -38,7 +48,49 @@ type EVMClient interface {
 type Registry interface {
 	GetActiveUpkeepKeys(context.Context, BlockKey) ([]UpkeepKey, error)
 	CheckUpkeep(context.Context, ...UpkeepKey) (UpkeepResults, error)
+	KeyCodec
+	BlockComparer
+}
+
+// BlockComparer represents the order of blocks of a chain. The format of a
+// block key is defined by the chain so block keys are never compared as
+// strings.
+type BlockComparer interface {
+	// CompareBlocks returns a negative value if block a is before block b,
+	// 0 if both are the same block, and a positive value if block a is after
+	// block b
+	CompareBlocks(a, b BlockKey) (int, error)
+}
+
+// BlockAfter indicates whether block a is after block b in the order of the
+// provided comparer
+func BlockAfter(c BlockComparer, a, b BlockKey) (bool, error) {
+	cmp, err := c.CompareBlocks(a, b)
+	if err != nil {
+		return false, err
+	}
+
+	return cmp > 0, nil
+}
+
+// KeyCodec represents the layout of upkeep keys. The layout of a key is
+// defined by the chain; the plugin only reads and builds keys through the
+// codec of the registry.
+type KeyCodec interface {
+	// BlockFromKey returns the block an upkeep key is checked at
+	BlockFromKey(UpkeepKey) (BlockKey, error)
+	// IdentifierFromKey returns the upkeep an upkeep key refers to
 	IdentifierFromKey(UpkeepKey) (UpkeepIdentifier, error)
+	// MakeKey builds the key of an upkeep at a block
+	MakeKey(BlockKey, UpkeepIdentifier) UpkeepKey
+}
+
+// IdentifierParser is implemented by registries that can parse upkeep ids
+// in the text form used in configuration
+type IdentifierParser interface {
+	// ParseIdentifier returns the identifier of an upkeep id in the form
+	// returned by IdentifierFromKey
+	ParseIdentifier(string) (UpkeepIdentifier, error)
 }
 
 // ReportEncoder represents the report encoder behaviour
@@ -49,6 +101,16 @@ type ReportEncoder interface {
 	DecodeReport([]byte) ([]UpkeepResult, error)
 }
 
+// CheckBlockWindow is implemented by report encoders that require all results
+// in a report to be checked within a window of blocks that ends at the latest
+// check block of the report. Results checked before the window are dropped
+// before a report is packed.
+type CheckBlockWindow interface {
+	// EarliestCheckBlock returns the earliest check block of a result in a
+	// report where the latest check block is the provided block
+	EarliestCheckBlock(latest BlockKey) (BlockKey, error)
+}
+
 // PerformLogProvider represents the perform log provider
 //
 //go:generate mockery --name PerformLogProvider --inpackage --output . --case=underscore --filename perform_log_provider.generated.go
@@ -56,12 +118,70 @@ type PerformLogProvider interface {
 	PerformLogs(context.Context) ([]PerformLog, error)
 }
 
+// PerformLogChain is implemented by perform log providers that can confirm
+// that a block seen in perform logs was reorged out of the canonical chain
+type PerformLogChain interface {
+	// PerformLogLookback returns the number of blocks polled for perform
+	// logs ending at the head of the poll
+	PerformLogLookback() int64
+	// PolledHead returns the head of the last poll for perform logs
+	PolledHead() int64
+	// BlockHash returns the hash of a block in the canonical chain
+	BlockHash(context.Context, int64) (string, error)
+}
+
 type PerformLog struct {
 	Key             UpkeepKey
 	TransmitBlock   BlockKey
 	Confirmations   int64
 	TransactionHash string
 	BlockNumber     int64
+	// BlockHash is the hash of the block that includes the log
+	BlockHash string
+	// Reorged indicates that the upkeep was transmitted in a report but not
+	// performed because the block the upkeep was checked on is no longer in
+	// the canonical chain
+	Reorged bool
+}
+
+// CoordinatorStore persists the perform lockouts of the report coordinator
+// such that a restarted node does not report upkeeps again that are waiting
+// for a transmit to be confirmed
+type CoordinatorStore interface {
+	// Load returns the stored records that have not expired
+	Load() ([]CoordinatorRecord, error)
+	// Store adds a record and replaces a stored record of the same type and
+	// key
+	Store(CoordinatorRecord) error
+}
+
+type CoordinatorRecordType uint8
+
+const (
+	// IDLockoutRecord locks out an upkeep id from reports until after Block.
+	// An empty block locks out the id until a perform is confirmed.
+	IDLockoutRecord CoordinatorRecordType = iota + 1
+	// TransmitRecord records an upkeep key accepted for transmit and
+	// whether the transmit was confirmed by a perform log
+	TransmitRecord
+)
+
+type CoordinatorRecord struct {
+	Type CoordinatorRecordType `json:"type"`
+	// Key is the upkeep identifier of a lockout or the upkeep key of a
+	// transmit. Identifiers are arbitrary bytes and are kept as bytes such
+	// that they are encoded without loss.
+	Key       []byte   `json:"key"`
+	Block     BlockKey `json:"block,omitempty"`
+	Confirmed bool     `json:"confirmed,omitempty"`
+	// Expires is the time after which the record is discarded; a zero value
+	// never expires
+	Expires time.Time `json:"expires"`
+}
+
+// Expired indicates whether the record expired at the provided time
+func (r CoordinatorRecord) Expired(now time.Time) bool {
+	return !r.Expires.IsZero() && !now.Before(r.Expires)
 }
 
 type BlockKey string
@@ -97,6 +217,70 @@ const (
 	Eligible
 )
 
+// ReportMode selects how check results are obtained when building a report
+type ReportMode string
+
+const (
+	// ReportModeRecheck checks all upkeeps from observations again when
+	// building a report
+	ReportModeRecheck ReportMode = "recheck"
+	// ReportModeObservedDigests includes a digest of each check result in
+	// observations. Reports are built from results that match a digest agreed
+	// on by the observation quorum. Cached results are used where available
+	// and only uncached keys are checked again.
+	ReportModeObservedDigests ReportMode = "observedDigests"
+)
+
+// ReportPackerStrategy selects how eligible upkeeps are packed into a report
+type ReportPackerStrategy string
+
+const (
+	// ReportPackerGreedy adds upkeeps in shuffled order while they fit in the
+	// report gas limit
+	ReportPackerGreedy ReportPackerStrategy = "greedy"
+	// ReportPackerKnapsack selects the largest number of upkeeps that fit in
+	// the report gas limit
+	ReportPackerKnapsack ReportPackerStrategy = "knapsack"
+	// ReportPackerPriority selects upkeeps with the largest total priority
+	// that fit in the report gas limit
+	ReportPackerPriority ReportPackerStrategy = "priority"
+)
+
+// ObservationTruncation selects which eligible upkeeps are kept when more
+// upkeeps are eligible than fit in an observation
+type ObservationTruncation string
+
+const (
+	// TruncateSorted keeps the lowest upkeep keys in lexicographic order. All
+	// nodes keep the same keys but upkeeps with high keys can be starved.
+	TruncateSorted ObservationTruncation = "sorted"
+	// TruncateRotating orders upkeeps by id starting after the last id kept
+	// in the previous observation of the node such that all eligible upkeeps
+	// are observed in turn
+	TruncateRotating ObservationTruncation = "rotating"
+	// TruncateRandom shuffles upkeeps with a seed derived from the config
+	// digest, epoch, and round such that all nodes keep the same random
+	// selection of shared upkeeps in a round
+	TruncateRandom ObservationTruncation = "random"
+	// TruncateLeastRecentlyPerformed keeps the upkeeps with the longest time
+	// since the last perform seen by the node. Upkeeps without a perform are
+	// kept first.
+	TruncateLeastRecentlyPerformed ObservationTruncation = "leastRecentlyPerformed"
+)
+
+// SamplerStrategy selects how each node samples upkeeps from the active set
+// on each head
+type SamplerStrategy string
+
+const (
+	// SamplerRandom samples upkeeps at random on each node independently
+	SamplerRandom SamplerStrategy = "random"
+	// SamplerCoverage partitions the active set across oracles with an
+	// offset that rotates every block such that every upkeep is checked by
+	// the observation quorum within a bounded number of blocks
+	SamplerCoverage SamplerStrategy = "coverage"
+)
+
 type OffchainConfig struct {
 	// PerformLockoutWindow is the window in which a single upkeep cannot be
 	// performed again while waiting for a confirmation. Standard setting is
@@ -114,6 +298,24 @@ type OffchainConfig struct {
 	// calculated
 	TargetInRounds int `json:"targetInRounds"`
 
+	// AdaptiveSampleRatio adjusts the sample ratio to the number of OCR rounds
+	// per block measured by each node. Sampling results are observed once per
+	// block so the ratio is raised when more than one round completes per
+	// block to meet TargetProbability within TargetInRounds.
+	AdaptiveSampleRatio bool `json:"adaptiveSampleRatio"`
+
+	// MinSampleRatio is the lower bound of the adaptive sample ratio. The
+	// default is 0.
+	MinSampleRatio string `json:"minSampleRatio"`
+
+	// MaxSampleRatio is the upper bound of the adaptive sample ratio. The
+	// default is 1.
+	MaxSampleRatio string `json:"maxSampleRatio"`
+
+	// Sampler selects how upkeeps are sampled from the active set on each
+	// head. The default is random.
+	Sampler SamplerStrategy `json:"sampler"`
+
 	// SamplingJobDuration is the time allowed for a sampling run to complete
 	// before forcing a new job on the latest block. Units are in milliseconds.
 	SamplingJobDuration int64 `json:"samplingJobDuration"`
@@ -122,12 +324,42 @@ type OffchainConfig struct {
 	// the provided number of confirmations.
 	MinConfirmations int `json:"minConfirmations"`
 
+	// ReorgDepth is the number of blocks a confirmed perform log is tracked
+	// for reorgs. An upkeep is unlocked for reports when its perform log
+	// vanishes from the canonical chain within this depth. The depth must be
+	// less than the number of blocks polled for perform logs. The default is
+	// 100 blocks.
+	ReorgDepth int64 `json:"reorgDepth"`
+
 	// GasLimitPerReport is the max gas that could be spent per one report.
 	// This is needed for calculation of how many upkeeps could be within report.
 	GasLimitPerReport uint32 `json:"gasLimitPerReport"`
 
 	// GasOverheadPerUpkeep is gas overhead per upkeep taken place in the report.
 	GasOverheadPerUpkeep uint32 `json:"gasOverheadPerUpkeep"`
+
+	// ObservationQuorum is the minimum number of distinct oracles that must
+	// observe an upkeep id before it is considered for a report. The default
+	// of 0 results in f+1. A value of 1 allows a single oracle to propose an
+	// upkeep for a report.
+	ObservationQuorum int `json:"observationQuorum"`
+
+	// ReportMode selects how check results are obtained when building a
+	// report. The default is to check all observed upkeeps again.
+	ReportMode ReportMode `json:"reportMode"`
+
+	// ReportPacker selects the strategy used to pack eligible upkeeps into a
+	// report. The default is greedy.
+	ReportPacker ReportPackerStrategy `json:"reportPacker"`
+
+	// ObservationTruncation selects which eligible upkeeps are kept when more
+	// upkeeps are eligible than fit in an observation. The default is sorted.
+	ObservationTruncation ObservationTruncation `json:"observationTruncation"`
+
+	// UpkeepPriorities maps upkeep ids to a priority used by the priority
+	// report packer. Ids are parsed by the registry; EVM upkeep ids are
+	// decimal. Upkeeps not listed have a priority of 1.
+	UpkeepPriorities map[string]uint32 `json:"upkeepPriorities"`
 }
 
 func DecodeOffchainConfig(b []byte) (OffchainConfig, error) {
@@ -142,6 +374,10 @@ func DecodeOffchainConfig(b []byte) (OffchainConfig, error) {
 		config.PerformLockoutWindow = 100 * 12 * 1000 // default of 100 blocks * 12 second blocks
 	}
 
+	if config.ReorgDepth == 0 {
+		config.ReorgDepth = 100
+	}
+
 	if config.SamplingJobDuration == 0 {
 		config.SamplingJobDuration = 3000 // default of 3 seconds if not set
 	}
@@ -154,6 +390,22 @@ func DecodeOffchainConfig(b []byte) (OffchainConfig, error) {
 		config.GasOverheadPerUpkeep = 300_000
 	}
 
+	if config.ReportMode == "" {
+		config.ReportMode = ReportModeRecheck
+	}
+
+	if config.ReportPacker == "" {
+		config.ReportPacker = ReportPackerGreedy
+	}
+
+	if config.Sampler == "" {
+		config.Sampler = SamplerRandom
+	}
+
+	if config.ObservationTruncation == "" {
+		config.ObservationTruncation = TruncateSorted
+	}
+
 	return config, err
 }
 